@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+)
+
+// answerPrompts describes the prompts an answers file can answer, keyed by
+// the name used in the file.
+var answerPrompts = map[string]string{
+	"install":    "Proceed with install? (y/n)",
+	"aurdeps":    "Build AUR dependencies that were not asked for? (y/n)",
+	"ignored":    "Install a package from IgnorePkg/IgnoreGroup anyway? (y/n)",
+	"addignore":  "Add packages left out of an upgrade to IgnorePkg? (y/n)",
+	"replace":    "Replace a package by its replacement? (y/n)",
+	"removemake": "Remove make dependencies after installing? (y/n)",
+	"remove":     "Remove unneeded dependencies with -Yc? (y/n)",
+	"removal":    "Proceed with a removal previewed with -R --preview? (y/n)",
+	"cleanbuild": "Delete the build directories of removed AUR packages? (y/n)",
+	"importkeys": "Import missing PGP keys? (y/n)",
+	"lint":       "Build a PKGBUILD that failed the lint checks? (y/n)",
+	"rebuilds":   "Rebuild AUR packages linked against libraries an upgrade replaces? (y/n)",
+	"prebuilt":   "Install prebuilt packages from binaryrepos instead of building? (y/n)",
+	"skipfailed": "Skip a package that failed to build and go on? (y/n)",
+	"cycle":      "Break a dependency cycle by building a package without a dependency? (y/n)",
+	"conflict":   "Conflicting packages: r(emove), s(kip) or a(bort)",
+	"checkout":   "Local changes to an updated checkout: r(ebase), k(eep) or t(ake upstream)",
+	"upgrade":    "Upgrade menu",
+	"search":     "Search result menu",
+	"clean":      "Clean build menu",
+	"edit":       "Edit/review menu",
+	"group":      "Group member menu",
+	"orphans":    "Orphan removal menu",
+	"neworphans": "Show the packages a removal from the orphan menu left orphaned? (y/n)",
+	"orphaned":   "Remove the packages a transaction left orphaned? (y/n)",
+}
+
+// answers holds the predetermined answers to prompts loaded with --answers.
+var answers map[string]string
+
+// parseAnswers parses an answers file, a JSON object mapping prompts to
+// their answers.
+func parseAnswers(content []byte) (map[string]string, error) {
+	parsed := make(map[string]string)
+	err := json.Unmarshal(stripComments(content), &parsed)
+	if err != nil {
+		return nil, err
+	}
+
+	unknown := make([]string, 0)
+	for key := range parsed {
+		if _, ok := answerPrompts[key]; !ok {
+			unknown = append(unknown, key)
+		}
+	}
+
+	if len(unknown) != 0 {
+		sort.Strings(unknown)
+		return nil, fmt.Errorf("Unknown prompts: %s", strings.Join(unknown, " "))
+	}
+
+	return parsed, nil
+}
+
+func loadAnswers(path string) error {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	answers, err = parseAnswers(content)
+	return err
+}
+
+// skipPrompt reports whether the prompt key is skipped because of
+// --noconfirm. Prompts with a predetermined answer are never skipped.
+func skipPrompt(key string) bool {
+	_, ok := answers[key]
+	return config.NoConfirm && !ok
+}
+
+// answer returns the predetermined answer to the prompt key, printing it
+// in place of the user's input.
+func answer(key string) (string, bool) {
+	response, ok := answers[key]
+	if ok {
+		fmt.Println(response)
+	}
+
+	return response, ok
+}
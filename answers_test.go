@@ -0,0 +1,23 @@
+package main
+
+import "testing"
+
+func TestParseAnswers(t *testing.T) {
+	parsed, err := parseAnswers([]byte(`{
+	// build everything without asking
+	"install": "y",
+	"clean": "all"
+}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if parsed["install"] != "y" || parsed["clean"] != "all" || len(parsed) != 2 {
+		t.Errorf("Expected install and clean to be answered, found %v", parsed)
+	}
+
+	_, err = parseAnswers([]byte(`{"install": "y", "provider": "aur"}`))
+	if err == nil {
+		t.Errorf("Expected an unknown prompt to be refused")
+	}
+}
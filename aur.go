@@ -0,0 +1,289 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	rpc "github.com/mikkeloscar/aur"
+)
+
+// aurTimeout bounds every request to an AUR endpoint, so an unresponsive
+// one is given up on and the next is tried.
+const aurTimeout = 30 * time.Second
+
+var aurClient = &http.Client{Timeout: aurTimeout}
+
+// rpcResponse is the reply of the AUR RPC.
+type rpcResponse struct {
+	Error   string   `json:"error"`
+	Type    string   `json:"type"`
+	Results []rpcPkg `json:"results"`
+}
+
+// rpcPkg is a package of an RPC reply, with the provides rpc.Pkg leaves
+// out.
+type rpcPkg struct {
+	rpc.Pkg
+	Provides []string `json:"Provides"`
+}
+
+// aurProvides holds the provides of the AUR packages of the info replies
+// read so far. Search replies have none.
+var aurProvides = make(map[string][]string)
+
+// aurEndpoints returns the AUR addresses to try, in order.
+func aurEndpoints() []string {
+	return append([]string{config.AURURL}, config.AURFallbacks...)
+}
+
+// aurGet requests path from the first AUR endpoint that answers.
+func aurGet(path string) (*http.Response, error) {
+	return aurDo("GET", path, nil)
+}
+
+// aurDo sends a request for path to the first AUR endpoint that answers,
+// with form as its body if it is not nil. Endpoints that cannot be reached
+// or fail with a server error are skipped.
+func aurDo(method string, path string, form url.Values) (*http.Response, error) {
+	var lastErr error
+
+	for _, endpoint := range aurEndpoints() {
+		var body io.Reader
+		if form != nil {
+			body = strings.NewReader(form.Encode())
+		}
+
+		req, err := http.NewRequest(method, endpoint+path, body)
+		if err != nil {
+			return nil, err
+		}
+		if form != nil {
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		}
+
+		resp, err := aurClient.Do(req)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		if resp.StatusCode >= http.StatusInternalServerError {
+			resp.Body.Close()
+			lastErr = fmt.Errorf("%s: %s", endpoint, resp.Status)
+			continue
+		}
+
+		return resp, nil
+	}
+
+	return nil, lastErr
+}
+
+// decodeRPC reads the reply of an RPC request.
+func decodeRPC(resp *http.Response) ([]rpc.Pkg, error) {
+	defer resp.Body.Close()
+
+	result := new(rpcResponse)
+	err := json.NewDecoder(resp.Body).Decode(result)
+	if err != nil {
+		return nil, err
+	}
+
+	if result.Error != "" {
+		return nil, fmt.Errorf("%s", result.Error)
+	}
+
+	pkgs := make([]rpc.Pkg, 0, len(result.Results))
+	for _, pkg := range result.Results {
+		if pkg.Provides != nil {
+			aurProvides[pkg.Name] = pkg.Provides
+		}
+		pkgs = append(pkgs, pkg.Pkg)
+	}
+
+	return pkgs, nil
+}
+
+// aurAPI is a way of talking to the AUR RPC. The rest of yay only uses
+// aurInfo, aurSearch and aurSearchBy, which go through the API selected
+// with the aurrpc option.
+type aurAPI interface {
+	info(pkgs []string) ([]rpc.Pkg, error)
+	search(by string, query string) ([]rpc.Pkg, error)
+}
+
+// Names of the AUR RPC interfaces.
+const (
+	// RPCGet is the query string interface at /rpc.php.
+	RPCGet = "get"
+	// RPCPost is the interface at /rpc/v5/, which takes info requests as
+	// POST forms so they are not limited by the length of URLs.
+	RPCPost = "post"
+)
+
+var aurAPIs = map[string]aurAPI{
+	RPCGet:  rpcGet{},
+	RPCPost: rpcPost{},
+}
+
+type rpcGet struct{}
+
+func (rpcGet) query(values url.Values) ([]rpc.Pkg, error) {
+	values.Set("v", "5")
+	resp, err := aurGet("/rpc.php?" + values.Encode())
+	if err != nil {
+		return nil, err
+	}
+
+	return decodeRPC(resp)
+}
+
+func (api rpcGet) info(pkgs []string) ([]rpc.Pkg, error) {
+	values := url.Values{}
+	values.Set("type", "info")
+	for _, pkg := range pkgs {
+		values.Add("arg[]", pkg)
+	}
+
+	return api.query(values)
+}
+
+func (api rpcGet) search(by string, query string) ([]rpc.Pkg, error) {
+	values := url.Values{}
+	values.Set("type", "search")
+	if by != "" {
+		values.Set("by", by)
+	}
+	values.Set("arg", query)
+
+	return api.query(values)
+}
+
+type rpcPost struct{}
+
+func (rpcPost) info(pkgs []string) ([]rpc.Pkg, error) {
+	form := url.Values{}
+	for _, pkg := range pkgs {
+		form.Add("arg[]", pkg)
+	}
+
+	resp, err := aurDo("POST", "/rpc/v5/info", form)
+	if err != nil {
+		return nil, err
+	}
+
+	return decodeRPC(resp)
+}
+
+func (rpcPost) search(by string, query string) ([]rpc.Pkg, error) {
+	path := "/rpc/v5/search/" + url.PathEscape(query)
+	if by != "" {
+		path += "?by=" + url.QueryEscape(by)
+	}
+
+	resp, err := aurGet(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return decodeRPC(resp)
+}
+
+// currentAPI returns the AUR RPC interface selected in the config.
+func currentAPI() aurAPI {
+	if api, ok := aurAPIs[config.AURRPC]; ok {
+		return api
+	}
+
+	return rpcGet{}
+}
+
+// aurInfo returns the AUR packages named in pkgs. Packages of the local
+// repos are taken from there instead.
+func aurInfo(pkgs []string) ([]rpc.Pkg, error) {
+	local, remaining := localInfo(pkgs)
+	if len(local) == 0 {
+		return currentAPI().info(pkgs)
+	}
+	if len(remaining) == 0 {
+		return local, nil
+	}
+
+	info, err := currentAPI().info(remaining)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(local, info...), nil
+}
+
+// aurSearch searches AUR package names and descriptions for query, along
+// with the packages of the local repos.
+func aurSearch(query string) ([]rpc.Pkg, error) {
+	found, err := currentAPI().search("", query)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(localSearch(query), found...), nil
+}
+
+// aurSearchBy searches the AUR for query in the field by, such as
+// name-desc or maintainer.
+func aurSearchBy(by string, query string) ([]rpc.Pkg, error) {
+	return currentAPI().search(by, query)
+}
+
+// aurGitDownload clones or updates the AUR repository of pkgbase in the
+// build directory from the first endpoint that works.
+func aurGitDownload(pkgbase string) (err error) {
+	if local, ok := localPackageBase(pkgbase); ok {
+		fresh, err := localFetch(local)
+		if err != nil || fresh {
+			return err
+		}
+
+		return updateCheckout(pkgbase, config.BuildDir+pkgbase+"/")
+	}
+
+	for i, endpoint := range aurEndpoints() {
+		if i > 0 {
+			fmt.Println(boldRedFgBlackBg(arrow+" Warning:"),
+				blackBg("Trying "+endpoint+" for "+pkgbase))
+		}
+
+		err = gitDownload(endpoint+"/"+pkgbase+".git", config.BuildDir, pkgbase)
+		if err == nil {
+			return nil
+		}
+	}
+
+	return err
+}
+
+// aurGitFetch is aurGitDownload without updating the checkout, see
+// gitFetch.
+func aurGitFetch(pkgbase string) (fresh bool, err error) {
+	if local, ok := localPackageBase(pkgbase); ok {
+		return localFetch(local)
+	}
+
+	for i, endpoint := range aurEndpoints() {
+		if i > 0 {
+			fmt.Println(boldRedFgBlackBg(arrow+" Warning:"),
+				blackBg("Trying "+endpoint+" for "+pkgbase))
+		}
+
+		fresh, err = gitFetch(endpoint+"/"+pkgbase+".git", config.BuildDir, pkgbase)
+		if err == nil {
+			return
+		}
+	}
+
+	return
+}
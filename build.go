@@ -0,0 +1,290 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	alpm "github.com/jguer/go-alpm"
+	rpc "github.com/mikkeloscar/aur"
+	gopkg "github.com/mikkeloscar/gopkgbuild"
+)
+
+// buildResult is the outcome of building one pkgbase.
+type buildResult struct {
+	pkg *rpc.Pkg
+	log string
+	err error
+}
+
+// readyBases returns the pkgbases of pkgs that are not started yet and
+// whose dependencies among pkgs are all installed, in the order of pkgs.
+func readyBases(pkgs []*rpc.Pkg, deps map[string][]string, started, installed stringSet) []*rpc.Pkg {
+	var ready []*rpc.Pkg
+
+outer:
+	for _, pkg := range pkgs {
+		if started.get(pkg.PackageBase) {
+			continue
+		}
+
+		for _, dep := range deps[pkg.PackageBase] {
+			if !installed.get(dep) {
+				continue outer
+			}
+		}
+
+		ready = append(ready, pkg)
+	}
+
+	return ready
+}
+
+// failedDep returns the first of deps that failed to build or was skipped,
+// if any.
+func failedDep(deps []string, failed stringSet) string {
+	for _, dep := range deps {
+		if failed.get(dep) {
+			return dep
+		}
+	}
+
+	return ""
+}
+
+func printSkippedDependent(pkgbase, dep string) {
+	fmt.Println(boldRedFgBlackBg(arrow+" Warning:"),
+		blackBg("Skipping "+pkgbase+", it needs "+dep+" which was not built"))
+	runSummary.skippedPkg(pkgbase, "needs "+dep)
+}
+
+// skipFailedBuild decides following config.OnFailure whether to go on
+// without pkgbase after building it failed with err. The build output is
+// found at log.
+func skipFailedBuild(pkgbase, log string, err error) bool {
+	fmt.Println(boldRedFgBlackBg(arrow+" Error:"),
+		blackBg("Building "+pkgbase+" failed: "+err.Error()))
+	runSummary.failedBuild(pkgbase, log)
+
+	// timeouts are meant to keep unattended runs going, asking would not
+	if _, ok := err.(*buildTimeoutError); ok && config.OnFailure != OnFailureAbort {
+		fmt.Println(boldGreenFg(arrow), boldFg("Skipping "+pkgbase+" and going on"))
+		return true
+	}
+
+	return skipFailures("Building", []string{pkgbase})
+}
+
+// failedBuildsError reports the pkgbases that were skipped after failing to
+// build, once everything else is done.
+func failedBuildsError(failed []string) error {
+	if len(failed) == 0 {
+		return nil
+	}
+
+	return fmt.Errorf("Failed to build: %s", strings.Join(failed, " "))
+}
+
+// buildInstallParallel builds up to config.BuildJobs pkgbases at a time.
+// A pkgbase is only started once the pkgbases it depends on are installed,
+// and the built packages are installed one pkgbase at a time as the builds
+// finish. Build output goes to a build.log in the build directory of each
+// pkgbase since several builds share the terminal.
+func buildInstallParallel(pkgs []*rpc.Pkg, srcinfos map[string]*gopkg.PKGBUILD, targets stringSet, parser *arguments, bases map[string][]*rpc.Pkg, localDb *alpm.Db) error {
+	deps := baseDeps(bases)
+	started := make(stringSet)
+	installed := make(stringSet)
+	failed := make(stringSet)
+	var failedBuilds []string
+	results := make(chan buildResult)
+	running := 0
+	var aborted error
+
+	for {
+		if aborted == nil {
+			for _, pkg := range readyBases(pkgs, deps, started, installed) {
+				if running >= config.BuildJobs {
+					break
+				}
+
+				started.set(pkg.PackageBase)
+				running++
+
+				buildLog := config.BuildDir + pkg.PackageBase + "/build.log"
+				fmt.Println(boldGreenFg(arrow+" Building "+pkg.PackageBase), "(log: "+buildLog+")")
+				go func(pkg *rpc.Pkg) {
+					err := buildPkgBuild(pkg, srcinfos[pkg.PackageBase], bases, buildLog)
+					results <- buildResult{pkg, buildLog, err}
+				}(pkg)
+			}
+		}
+
+		if running == 0 {
+			break
+		}
+
+		result := <-results
+		running--
+		_ = saveVCSInfo()
+
+		if result.err != nil {
+			if aborted != nil {
+				runSummary.failedBuild(result.pkg.PackageBase, result.log)
+			} else if skipFailedBuild(result.pkg.PackageBase, result.log, result.err) {
+				failed.set(result.pkg.PackageBase)
+				failedBuilds = append(failedBuilds, result.pkg.PackageBase)
+			} else {
+				aborted = fmt.Errorf("Building %s failed: %s", result.pkg.PackageBase, result.err)
+			}
+			continue
+		}
+
+		// the builds already running are waited for, but nothing new is
+		// installed once aborting
+		if aborted != nil {
+			continue
+		}
+
+		fmt.Println(boldGreenFg(arrow+" Built "+result.pkg.PackageBase), "-- installing")
+		err := installPkgBuild(result.pkg, srcinfos[result.pkg.PackageBase], targets, parser, bases, localDb)
+		if err != nil {
+			aborted = err
+			continue
+		}
+		installed.set(result.pkg.PackageBase)
+	}
+
+	if aborted != nil {
+		return aborted
+	}
+
+	// what was never started needs something that failed
+	for _, pkg := range pkgs {
+		if !started.get(pkg.PackageBase) {
+			if dep := failedDep(deps[pkg.PackageBase], failed); dep != "" {
+				printSkippedDependent(pkg.PackageBase, dep)
+			}
+			failed.set(pkg.PackageBase)
+		}
+	}
+
+	return failedBuildsError(failedBuilds)
+}
+
+// buildLayers groups pkgs, in build order, into layers of pkgbases that
+// only depend on pkgbases of the layers before.
+func buildLayers(pkgs []*rpc.Pkg, deps map[string][]string) [][]*rpc.Pkg {
+	level := make(map[string]int)
+	var layers [][]*rpc.Pkg
+
+	for _, pkg := range pkgs {
+		l := 0
+		for _, dep := range deps[pkg.PackageBase] {
+			if depLevel, ok := level[dep]; ok && depLevel+1 > l {
+				l = depLevel + 1
+			}
+		}
+
+		level[pkg.PackageBase] = l
+		for len(layers) <= l {
+			layers = append(layers, nil)
+		}
+		layers[l] = append(layers[l], pkg)
+	}
+
+	return layers
+}
+
+// buildInstallBatch builds every pkgbase of a layer before installing the
+// whole layer with a single pacman -U, so there are as few transactions as
+// the dependencies between the pkgbases allow.
+func buildInstallBatch(pkgs []*rpc.Pkg, srcinfos map[string]*gopkg.PKGBUILD, targets stringSet, parser *arguments, bases map[string][]*rpc.Pkg, localDb *alpm.Db) error {
+	deps := baseDeps(bases)
+	failed := make(stringSet)
+	var failedBuilds []string
+
+	for _, layer := range buildLayers(pkgs, deps) {
+		var built []*rpc.Pkg
+
+		for _, pkg := range layer {
+			if dep := failedDep(deps[pkg.PackageBase], failed); dep != "" {
+				printSkippedDependent(pkg.PackageBase, dep)
+				failed.set(pkg.PackageBase)
+				continue
+			}
+
+			buildLog := quietBuildLog(pkg.PackageBase)
+			err := buildPkgBuild(pkg, srcinfos[pkg.PackageBase], bases, buildLog)
+			if err != nil {
+				if !skipFailedBuild(pkg.PackageBase, failureLog(pkg.PackageBase, buildLog), err) {
+					return err
+				}
+
+				failed.set(pkg.PackageBase)
+				failedBuilds = append(failedBuilds, pkg.PackageBase)
+				continue
+			}
+
+			built = append(built, pkg)
+		}
+
+		err := installLayer(built, srcinfos, targets, parser, bases, localDb)
+		if err != nil {
+			return err
+		}
+	}
+
+	return failedBuildsError(failedBuilds)
+}
+
+// installLayer installs the packages built from pkgs in one transaction,
+// then marks the ones that are dependencies as such.
+func installLayer(pkgs []*rpc.Pkg, srcinfos map[string]*gopkg.PKGBUILD, targets stringSet, parser *arguments, bases map[string][]*rpc.Pkg, localDb *alpm.Db) error {
+	if len(pkgs) == 0 {
+		return nil
+	}
+
+	arguments := upgradeArguments(parser)
+	asdeps := makeArguments()
+	asdeps.op = "D"
+	asdeps.addArg("asdeps")
+
+	for _, pkg := range pkgs {
+		if staged(pkg.PackageBase) && !arguments.existsDouble("d") {
+			arguments.addArg("d", "d")
+		}
+
+		files, err := builtFiles(pkg, srcinfos[pkg.PackageBase], targets, parser, bases, localDb)
+		if err != nil {
+			return err
+		}
+
+		for _, file := range files {
+			arguments.addTarget(file.file)
+			if file.asDep {
+				asdeps.addTarget(file.name)
+			}
+		}
+	}
+
+	oldConfirm := config.NoConfirm
+	config.NoConfirm = true
+	err := passToPacman(arguments)
+	if err == nil && len(asdeps.targets) > 0 {
+		err = passToPacman(asdeps)
+	}
+	config.NoConfirm = oldConfirm
+	if err != nil {
+		return err
+	}
+
+	for _, pkg := range pkgs {
+		currentTransaction.installed(pkg.PackageBase)
+
+		err := recordMaintainer(pkg)
+		if err != nil {
+			fmt.Println(err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	rpc "github.com/mikkeloscar/aur"
+)
+
+func TestReadyBases(t *testing.T) {
+	pkgs := []*rpc.Pkg{
+		{Name: "a", PackageBase: "a"},
+		{Name: "b", PackageBase: "b"},
+		{Name: "c", PackageBase: "c"},
+	}
+	deps := map[string][]string{"c": {"a", "b"}}
+
+	started := make(stringSet)
+	installed := make(stringSet)
+	names := func(pkgs []*rpc.Pkg) []string {
+		var names []string
+		for _, pkg := range pkgs {
+			names = append(names, pkg.PackageBase)
+		}
+		return names
+	}
+
+	if ready := names(readyBases(pkgs, deps, started, installed)); !reflect.DeepEqual(ready, []string{"a", "b"}) {
+		t.Errorf("Expected a and b to be ready, found %v", ready)
+	}
+
+	started.set("a")
+	started.set("b")
+	installed.set("a")
+	if ready := readyBases(pkgs, deps, started, installed); len(ready) != 0 {
+		t.Errorf("Expected nothing ready before b is installed, found %v", names(ready))
+	}
+
+	installed.set("b")
+	if ready := names(readyBases(pkgs, deps, started, installed)); !reflect.DeepEqual(ready, []string{"c"}) {
+		t.Errorf("Expected c to be ready, found %v", ready)
+	}
+}
+
+func TestFailedDep(t *testing.T) {
+	failed := make(stringSet)
+	failed.set("b")
+
+	if dep := failedDep([]string{"a", "b", "c"}, failed); dep != "b" {
+		t.Errorf("Expected b, found %q", dep)
+	}
+	if dep := failedDep([]string{"a", "c"}, failed); dep != "" {
+		t.Errorf("Expected no failed dependency, found %q", dep)
+	}
+}
+
+func TestBuildLayers(t *testing.T) {
+	pkgs := []*rpc.Pkg{
+		{Name: "a", PackageBase: "a"},
+		{Name: "b", PackageBase: "b"},
+		{Name: "c", PackageBase: "c"},
+		{Name: "d", PackageBase: "d"},
+	}
+	deps := map[string][]string{"c": {"a"}, "d": {"c", "b"}}
+
+	var layers [][]string
+	for _, layer := range buildLayers(pkgs, deps) {
+		var names []string
+		for _, pkg := range layer {
+			names = append(names, pkg.PackageBase)
+		}
+		layers = append(layers, names)
+	}
+
+	expected := [][]string{{"a", "b"}, {"c"}, {"d"}}
+	if !reflect.DeepEqual(layers, expected) {
+		t.Errorf("Expected layers %v, found %v", expected, layers)
+	}
+}
+
+func TestMakepkgBuildArgsParallel(t *testing.T) {
+	oldJobs, oldBackend := config.BuildJobs, config.BuildBackend
+	defer func() { config.BuildJobs, config.BuildBackend = oldJobs, oldBackend }()
+
+	config.BuildBackend = BackendMakepkg
+	config.BuildJobs = 1
+	if args := makepkgBuildArgs("foo"); args[0] != "-Cscf" {
+		t.Errorf("Expected makepkg to install the dependencies, found %v", args)
+	}
+
+	// makepkg -s and -r run pacman
+	config.BuildJobs = 4
+	for _, arg := range makepkgBuildArgs("foo") {
+		if !strings.HasPrefix(arg, "--") && strings.ContainsAny(arg, "sr") {
+			t.Errorf("Expected a parallel build not to run pacman, found %s", arg)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+)
+
+// buildTimesFile holds the path of the record of past build durations.
+var buildTimesFile string
+
+// buildTimes maps pkgbases to the durations in seconds of their last builds.
+var buildTimes map[string][]int64
+
+var buildTimesMut sync.Mutex
+
+// keptBuildTimes is how many past builds of a pkgbase estimates are based on.
+const keptBuildTimes = 5
+
+func loadBuildTimes() {
+	in, err := os.Open(buildTimesFile)
+	if err != nil {
+		return
+	}
+	defer in.Close()
+
+	buildTimesMut.Lock()
+	defer buildTimesMut.Unlock()
+	_ = json.NewDecoder(in).Decode(&buildTimes)
+}
+
+// recordBuildTime remembers that building pkgbase took d.
+func recordBuildTime(pkgbase string, d time.Duration) {
+	buildTimesMut.Lock()
+	defer buildTimesMut.Unlock()
+
+	if buildTimes == nil {
+		buildTimes = make(map[string][]int64)
+	}
+
+	times := append(buildTimes[pkgbase], int64(d/time.Second))
+	if len(times) > keptBuildTimes {
+		times = times[len(times)-keptBuildTimes:]
+	}
+	buildTimes[pkgbase] = times
+
+	marshalledinfo, err := json.MarshalIndent(buildTimes, "", "\t")
+	if err == nil {
+		err = ioutil.WriteFile(buildTimesFile, marshalledinfo, 0644)
+	}
+	if err != nil {
+		fmt.Println(err)
+	}
+}
+
+// estimateBuildTime returns how long building pkgbase is expected to take,
+// the average of its last recorded builds.
+func estimateBuildTime(pkgbase string) (time.Duration, bool) {
+	buildTimesMut.Lock()
+	defer buildTimesMut.Unlock()
+
+	times := buildTimes[pkgbase]
+	if len(times) == 0 {
+		return 0, false
+	}
+
+	var sum int64
+	for _, t := range times {
+		sum += t
+	}
+
+	return time.Duration(sum/int64(len(times))) * time.Second, true
+}
+
+// formatEstimate formats d coarsely, as nobody needs a build estimate to
+// the second.
+func formatEstimate(d time.Duration) string {
+	minutes := int((d + 30*time.Second) / time.Minute)
+	switch {
+	case minutes < 1:
+		return "<1m"
+	case minutes < 60:
+		return fmt.Sprintf("%dm", minutes)
+	default:
+		return fmt.Sprintf("%dh%02dm", minutes/60, minutes%60)
+	}
+}
+
+// printBuildEstimate prints how long building the AUR packages of dc is
+// expected to take, going by the pkgbases built before.
+func printBuildEstimate(dc *depCatagories) {
+	var total time.Duration
+	known := 0
+
+	for _, pkg := range dc.Aur {
+		if d, ok := estimateBuildTime(pkg.PackageBase); ok {
+			total += d
+			known++
+		}
+	}
+
+	if known == 0 {
+		return
+	}
+
+	str := "Estimated build time: ~" + formatEstimate(total)
+	if known < len(dc.Aur) {
+		str += fmt.Sprintf(" (%d of %d pkgbases built before)", known, len(dc.Aur))
+	}
+
+	fmt.Println(boldGreenFg(arrow), boldFg(str))
+}
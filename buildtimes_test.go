@@ -0,0 +1,39 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFormatEstimate(t *testing.T) {
+	tests := []struct {
+		d        time.Duration
+		expected string
+	}{
+		{10 * time.Second, "<1m"},
+		{45 * time.Second, "1m"},
+		{12*time.Minute + 10*time.Second, "12m"},
+		{59*time.Minute + 40*time.Second, "1h00m"},
+		{2*time.Hour + 5*time.Minute, "2h05m"},
+	}
+
+	for _, test := range tests {
+		if found := formatEstimate(test.d); found != test.expected {
+			t.Errorf("Expected %s to read %q, found %q", test.d, test.expected, found)
+		}
+	}
+}
+
+func TestEstimateBuildTime(t *testing.T) {
+	old := buildTimes
+	defer func() { buildTimes = old }()
+
+	buildTimes = map[string][]int64{"foo": {60, 120, 180}}
+
+	if d, ok := estimateBuildTime("foo"); !ok || d != 2*time.Minute {
+		t.Errorf("Expected an estimate of 2m0s for foo, found %s, %t", d, ok)
+	}
+	if _, ok := estimateBuildTime("bar"); ok {
+		t.Error("Expected no estimate for bar without past builds")
+	}
+}
@@ -5,12 +5,22 @@ package main
 // RemovePackage removes package from VCS information
 func removeVCSPackage(pkgs []string) {
 	for _, pkgName := range pkgs {
-		for i, e := range savedInfo {
-			if e.Package == pkgName {
-				savedInfo[i] = savedInfo[len(savedInfo)-1]
-				savedInfo = savedInfo[:len(savedInfo)-1]
+		base, e := vcsEntry(pkgName)
+		if e == nil {
+			continue
+		}
+
+		names := e.Pkgnames[:0]
+		for _, name := range e.Pkgnames {
+			if name != pkgName {
+				names = append(names, name)
 			}
 		}
+		e.Pkgnames = names
+
+		if len(e.Pkgnames) == 0 {
+			delete(savedInfo.Packages, base)
+		}
 	}
 
 	_ = saveVCSInfo()
@@ -24,7 +34,7 @@ func cleanDependencies() error {
 	}
 
 	if len(hanging) != 0 {
-		if !continueTask("Confirm Removal?", "nN") {
+		if !continueTask("remove", "Confirm Removal?", "nN") {
 			return nil
 		}
 		err = cleanRemove(hanging)
@@ -1,16 +1,17 @@
 package main
 
 import (
-	"bufio"
 	"encoding/json"
-	"errors"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
+
+	alpm "github.com/jguer/go-alpm"
 )
 
 var cmdArgs = makeArguments()
@@ -45,54 +46,176 @@ Permanent configuration options:
     --noafterclean       Disable package sources cleaning after successful build
     --timeupdate         Check package's modification date and version
     --notimeupdate       Check only package version change
+    --securitycheck      Include security advisories in -Ps
+    --nosecuritycheck    Do not include security advisories in -Ps
+    --upgradenews        Show unread distribution news before -Su
+    --noupgradenews      Do not fetch distribution news before -Su
+    --shallowclone       Clone git sources of VCS packages without history
+    --noshallowclone     Clone git sources of VCS packages with full history
+    --markdeps           Install AUR packages built as dependencies --asdeps
+    --nomarkdeps         Install every AUR package built as explicit
+    --batchinstall       Build everything possible before installing it at once
+    --nobatchinstall     Install every AUR package right after building it
+    --quietbuild         Show a status line instead of the build output
+    --noquietbuild       Show the output of builds as they run
+    --refusepartial      Refuse -Sy with targets but without -u
+    --norefusepartial    Only warn about -Sy with targets but without -u
+    --config-makepkg <file>
+                         Use an alternate makepkg.conf for every build
+    --pacman <bin>       Run pacman operations through an alternate binary
+    --git <bin>          Use an alternate git binary
+    --gitflags <flags>   Pass extra flags to every git invocation
+    --gpg <bin>          Use an alternate gpg binary
+    --gpgflags <flags>   Pass extra flags to every gpg invocation
+    --keyserver <url>    Keyserver used to import missing PGP keys
+    --sandbox <type>     Build inside bwrap, systemd-run or none
+    --buildbackend <makepkg|pkgctl|container>
+                         Build with makepkg, in a clean chroot with pkgctl
+                         or in a container
+    --pkgctl <bin>       Use an alternate pkgctl binary
+    --pkgctlflags <flags>
+                         Pass extra flags to pkgctl build
+    --container <bin>    Run build containers with podman, docker or <bin>
+    --containerimage <image>
+                         Image build containers run
+    --containerflags <flags>
+                         Pass extra flags to the container run
+    --provider <repo|aur>
+                         Prefer repo or AUR providers of dependencies
+    --distro <name>      Adapt to arch, manjaro, endeavouros, artix or auto
+    --addignore <glob[=YYYY-MM-DD]>
+                         Ignore upgrades of matching packages, until a date
+    --delignore <glob>   Remove a pattern from yay's ignore list
+    --aurdeps <mode>     Allow, ask for or deny building AUR dependencies
+    --debugpkgs <mode>   Install, skip or cache -debug packages of builds
+    --onfailure <mode>   Abort, skip or ask when packages fail to resolve,
+                         download or build
+    --makejobs <n>       Export MAKEFLAGS=-j<n> to builds (0 leaves it alone)
+    --buildprofile <name>
+                         Build with the named profile of compiler flags
+    --buildjobs <n>      Build up to <n> independent AUR packages at once
+    --nice <n>           Run builds with niceness <n> (0 leaves it alone)
+    --cpuquota <n%>      Limit builds to a CPU quota with a systemd scope
+    --ionice             Run builds with the idle I/O scheduling class
+    --noionice           Run builds with the default I/O scheduling class
+    --buildtimeout <m>   Kill builds running longer than <m> minutes
+    --develinterval <h>  Only check devel upstreams every <h> hours
+    --dbmaxage <h>       Warn when the sync databases are older than <h> hours
+    --aurrpc <get|post>  Talk to the AUR RPC with GET queries or POST forms
+    --mirrorcmd <cmd>    Rank mirrors with <cmd> before -Syu when they are old
+    --mirrorage <days>   Age of the mirrorlist after which --mirrorcmd runs
 
 Print specific options:
     -c --complete        Used for completions
     -d --defaultconfig   Print current yay configuration
+    -g --currentconfig   Print the effective configuration in config file format
     -n --numberupgrades  Print number of updates
     -s --stats           Display system package statistics
+    --security           Report installed packages with open CVEs
+    --news               Print unread distribution news, all of it with --all
+    --log [n]            Print the last n transactions of pacman.log (10)
+    --broken             List AUR packages linked against missing libraries
+    --consumers <pkg>    List packages linked against the libraries of pkg
+    --export             Print a manifest of the installed packages
+    --maintainer <user>  List AUR packages a user maintains or co-maintains
     -u --upgrades        Print update list
 
 Yay specific options:
-    -g --getpkgbuild     Download PKGBUILD from ABS or AUR
+    --holdver            Build VCS packages without updating their sources
+    --preferrepo         Prefer repo providers of dependencies for this run
+    --preferaur          Prefer AUR providers of dependencies for this run
+    --allowpartial       Allow -Sy with targets but without -u for this run
+    --unsafe-regensums   Regenerate checksums that fail instead of aborting
+    --preview            With -R, preview the whole -Rns removal and clean up
+                         the build directories of removed AUR packages
+    --skipinteg <pkgs>   Skip the source checks of these packages only
+    --skippgpcheck <pkgs>
+                         Skip the signature checks of these packages only
+    --answers <file>     Answer prompts from a file instead of asking
+    -g --getpkgbuild     Download PKGBUILD from the repos or AUR
     -c --clean           Remove unneeded dependencies
     --gendb              Generates development package DB used for updating.
+    --gendefaultconfig   Print a commented default config, --save writes it
+    --pin <pkg[=commit]> Stop --devel from upgrading a development package
+    --unpin <pkg>        Allow --devel to upgrade a pinned package again
+    --restore <file>     Install the packages of a manifest from -P --export
+    --resume             Continue the last install that was interrupted
+    --open <pkg>         Open the web page of packages in the browser
+    --vote <pkg>         Vote for AUR packages with the configured account
+    --unvote <pkg>       Remove votes for AUR packages
+    --vcs-status         List tracked development packages and their upstreams
+    --vcs-prune          Drop uninstalled and stale development package entries
+    --orphans            Pick orphaned dependencies to remove from a menu
 
 If no operation is provided -Y will be assumed
 `)
 }
 
-func initYay() (err error) {
-	var configHome string // configHome handles config directory home
-	var cacheHome string  // cacheHome handles cache home
-
-	if 0 == os.Geteuid() {
-		fmt.Println("Please avoid running yay as root/sudo.")
+// xdgHome returns yay's directory under the XDG base directory in env, or
+// under fallback in $HOME if env is unset or not a directory.
+func xdgHome(env, fallback string) string {
+	if home := os.Getenv(env); home != "" {
+		if info, err := os.Stat(home); err == nil && info.IsDir() {
+			return home + "/yay"
+		}
 	}
 
-	if configHome = os.Getenv("XDG_CONFIG_HOME"); configHome != "" {
-		if info, err := os.Stat(configHome); err == nil && info.IsDir() {
-			configHome = configHome + "/yay"
-		} else {
-			configHome = os.Getenv("HOME") + "/.config/yay"
+	return os.Getenv("HOME") + "/" + fallback + "/yay"
+}
+
+// migrateState moves the state files older versions kept next to the
+// config file to the state directory.
+func migrateState(configHome string) {
+	for _, file := range []string{vcsFile, maintainerFile, reviewFile} {
+		legacy := configHome + "/" + filepath.Base(file)
+		if _, err := os.Stat(legacy); err != nil {
+			continue
+		}
+		if _, err := os.Stat(file); err == nil {
+			continue
 		}
-	} else {
-		configHome = os.Getenv("HOME") + "/.config/yay"
-	}
 
-	if cacheHome = os.Getenv("XDG_CACHE_HOME"); cacheHome != "" {
-		if info, err := os.Stat(cacheHome); err == nil && info.IsDir() {
-			cacheHome = cacheHome + "/yay"
-		} else {
-			cacheHome = os.Getenv("HOME") + "/.cache/yay"
+		err := os.Rename(legacy, file)
+		if err != nil {
+			fmt.Println("Unable to move", legacy, "to", file+":", err)
 		}
-	} else {
-		cacheHome = os.Getenv("HOME") + "/.cache/yay"
+	}
+}
+
+func initYay() (err error) {
+	if 0 == os.Geteuid() {
+		fmt.Println("Please avoid running yay as root/sudo.")
 	}
 
+	configHome := xdgHome("XDG_CONFIG_HOME", ".config")
+	stateHome = xdgHome("XDG_STATE_HOME", ".local/state")
+	cacheHome = xdgHome("XDG_CACHE_HOME", ".cache")
+
 	configFile = configHome + "/config.json"
-	vcsFile = configHome + "/yay_vcs.json"
+	vcsFile = stateHome + "/yay_vcs.json"
+	maintainerFile = stateHome + "/yay_maintainers.json"
+	votesFile = stateHome + "/yay_votes.json"
+	sessionFile = configHome + "/aursession"
+	reviewFile = stateHome + "/yay_reviewed.json"
+	logFile = stateHome + "/yay.log"
+	transactionFile = stateHome + "/yay_transaction.json"
+	oomFile = stateHome + "/yay_oom.json"
+	newsFile = stateHome + "/yay_news.json"
+	upgradesFile = stateHome + "/yay_upgrades.log"
+	buildTimesFile = stateHome + "/yay_buildtimes.json"
+	replacedSearchFile = stateHome + "/yay_replaced.json"
+	profilesDir = cacheHome + "/profiles"
+	localReposCache = cacheHome + "/localrepos"
 	completionFile = cacheHome + "/aur_"
+	srcinfoCache = cacheHome + "/srcinfo/"
+
+	err = os.MkdirAll(stateHome, 0755)
+	if err != nil {
+		err = fmt.Errorf("Unable to create state directory:\n%s\n"+
+			"The error was:\n%s", stateHome, err)
+		return
+	}
+	migrateState(configHome)
 
 	////////////////
 	// yay config //
@@ -109,13 +232,11 @@ func initYay() (err error) {
 		// Save the default config if nothing is found
 		config.saveConfig()
 	} else {
-		cfile, errf := os.OpenFile(configFile, os.O_RDWR|os.O_CREATE, 0644)
+		content, errf := ioutil.ReadFile(configFile)
 		if errf != nil {
-			fmt.Printf("Error reading config: %s\n", err)
+			fmt.Printf("Error reading config: %s\n", errf)
 		} else {
-			defer cfile.Close()
-			decoder := json.NewDecoder(cfile)
-			err = decoder.Decode(&config)
+			err = json.Unmarshal(stripComments(content), &config)
 			if err != nil {
 				fmt.Println("Loading default Settings.\nError reading config:",
 					err)
@@ -124,18 +245,31 @@ func initYay() (err error) {
 		}
 	}
 
+	config.applyEnv()
+
+	// YAY_COLOR acts like --color when that is not given
+	if value := os.Getenv("YAY_COLOR"); value != "" && !cmdArgs.existsArg("color") {
+		cmdArgs.addParam("color", value)
+	}
+
 	/////////////////
 	// vcs config //
 	////////////////
 	updated = false
 
-	vfile, err := os.OpenFile(vcsFile, os.O_RDONLY|os.O_CREATE, 0644)
-	if err == nil {
-		defer vfile.Close()
-		decoder := json.NewDecoder(vfile)
-		_ = decoder.Decode(&savedInfo)
+	err = loadVCSInfo()
+	if err != nil {
+		fmt.Println(err)
+		err = nil
 	}
 
+	loadMaintainers()
+	loadVotes()
+	loadAURSession()
+	loadReviews()
+	loadOOMFailures()
+	loadBuildTimes()
+
 	return
 }
 
@@ -148,12 +282,17 @@ func initAlpm() (err error) {
 	var exists bool
 	//var double bool
 
+	pacmanConf = config.PacmanConf
 	value, _, exists = cmdArgs.getArg("config")
 	if exists {
-		config.PacmanConf = value
+		pacmanConf = value
 	}
 
-	alpmConf, err = readAlpmConfig(config.PacmanConf)
+	// like pacman, read everything from inside the --sysroot
+	sysroot, _, _ := cmdArgs.getArg("sysroot")
+	pacmanConf = sysroot + pacmanConf
+
+	alpmConf, err = readAlpmConfig(pacmanConf)
 	if err != nil {
 		err = fmt.Errorf("Unable to read Pacman conf: %s", err)
 		return
@@ -169,37 +308,91 @@ func initAlpm() (err error) {
 		alpmConf.RootDir = value
 	}
 
+	value, _, exists = cmdArgs.getArg("color")
+	if exists {
+		switch value {
+		case "always":
+			alpmConf.Options |= alpm.ConfColor
+		case "never":
+			alpmConf.Options &^= alpm.ConfColor
+		case "auto":
+			// like pacman, only color output going to a terminal
+			if isTerminal(os.Stdout) {
+				alpmConf.Options |= alpm.ConfColor
+			} else {
+				alpmConf.Options &^= alpm.ConfColor
+			}
+		}
+	}
+
 	value, _, exists = cmdArgs.getArg("arch")
 	if exists {
 		alpmConf.Architecture = value
 	}
 
+	// --ignore and --ignoregroup take comma separated lists and may repeat
+	value, _, exists = cmdArgs.getArg("ignore")
+	if exists {
+		alpmConf.IgnorePkg = append(alpmConf.IgnorePkg, splitIgnore(value)...)
+	}
+
+	value, _, exists = cmdArgs.getArg("ignoregroup")
+	if exists {
+		alpmConf.IgnoreGroup = append(alpmConf.IgnoreGroup, splitIgnore(value)...)
+	}
+
 	//TODO
 	//current system does not allow duplicate arguments
 	//but pacman allows multiple cachdirs to be passed
 	//for now only handle one cache dir
-	value, _, exists = cmdArgs.getArg("cachdir")
+	value, _, exists = cmdArgs.getArg("cachedir")
 	if exists {
 		alpmConf.CacheDir = []string{value}
 	}
 
+	value, _, exists = cmdArgs.getArg("hookdir")
+	if exists {
+		alpmConf.HookDir = []string{value}
+	}
+
 	value, _, exists = cmdArgs.getArg("gpgdir")
 	if exists {
 		alpmConf.GPGDir = value
 	}
 
+	value, _, exists = cmdArgs.getArg("logfile")
+	if exists {
+		alpmConf.LogFile = value
+	}
+
+	if sysroot != "" {
+		alpmConf.RootDir = sysroot + alpmConf.RootDir
+		alpmConf.DBPath = sysroot + alpmConf.DBPath
+		alpmConf.GPGDir = sysroot + alpmConf.GPGDir
+		alpmConf.LogFile = sysroot + alpmConf.LogFile
+		for i := range alpmConf.CacheDir {
+			alpmConf.CacheDir[i] = sysroot + alpmConf.CacheDir[i]
+		}
+		for i := range alpmConf.HookDir {
+			alpmConf.HookDir[i] = sysroot + alpmConf.HookDir[i]
+		}
+	}
+
 	alpmHandle, err = alpmConf.CreateHandle()
 	if err != nil {
 		err = fmt.Errorf("Unable to CreateHandle: %s", err)
 		return
 	}
 
+	err = initCrossArch()
+
 	return
 }
 
 func main() {
 	var status int
 	var err error
+	var orphansBefore stringSet
 
 	err = cmdArgs.parseCommandLine()
 	if err != nil {
@@ -222,13 +415,27 @@ func main() {
 		goto cleanup
 	}
 
+	if changesPackages(cmdArgs) {
+		orphansBefore, _ = orphanNames()
+	}
+
 	err = handleCmd()
+	runSummary.print()
 	if err != nil {
 		fmt.Println(err)
+		if currentTransaction != nil {
+			fmt.Println("Run yay --resume to continue where this left off")
+		}
 		status = 1
 		goto cleanup
 	}
 
+	if orphansBefore != nil {
+		if err = reportNewOrphans(orphansBefore); err != nil {
+			fmt.Println(err)
+		}
+	}
+
 	//ive used a goto here
 	//i think its the best way to do this sort of thing
 cleanup:
@@ -293,14 +500,24 @@ func updateSudo() {
 }
 
 func handleCmd() (err error) {
-	for option := range cmdArgs.options {
-		if handleConfig(option) {
+	// going on would answer the prompts the file was meant for
+	// differently, or leave an unattended run waiting at them
+	if value, _, exists := cmdArgs.getArg("answers"); exists {
+		err = loadAnswers(value)
+		if err != nil {
+			return fmt.Errorf("Unable to load answers: %s", err)
+		}
+		cmdArgs.delArg("answers")
+	}
+
+	for option, value := range cmdArgs.options {
+		if handleConfig(option, value) {
 			cmdArgs.delArg(option)
 		}
 	}
 
-	for option := range cmdArgs.globals {
-		if handleConfig(option) {
+	for option, value := range cmdArgs.globals {
+		if handleConfig(option, value) {
 			cmdArgs.delArg(option)
 		}
 	}
@@ -317,9 +534,9 @@ func handleCmd() (err error) {
 	case "F", "files":
 		passToPacman(cmdArgs)
 	case "Q", "query":
-		passToPacman(cmdArgs)
+		err = handleQuery()
 	case "R", "remove":
-		handleRemove()
+		err = handleRemove()
 	case "S", "sync":
 		err = handleSync()
 	case "T", "deptest":
@@ -347,7 +564,7 @@ func handleCmd() (err error) {
 //my current plan is to have yay specific operations in its own operator
 //e.g. yay -Y --gendb
 //e.g yay -Yg
-func handleConfig(option string) bool {
+func handleConfig(option, value string) bool {
 	switch option {
 	case "afterclean":
 		config.CleanAfter = true
@@ -371,6 +588,18 @@ func handleConfig(option string) bool {
 		config.TimeUpdate = true
 	case "notimeupdate":
 		config.TimeUpdate = false
+	case "securitycheck":
+		config.SecurityCheck = true
+	case "nosecuritycheck":
+		config.SecurityCheck = false
+	case "upgradenews":
+		config.UpgradeNews = true
+	case "noupgradenews":
+		config.UpgradeNews = false
+	case "shallowclone":
+		config.ShallowClone = true
+	case "noshallowclone":
+		config.ShallowClone = false
 	case "topdown":
 		config.SortMode = TopDown
 	case "bottomup":
@@ -383,6 +612,195 @@ func handleConfig(option string) bool {
 		//			os.Exit(0)
 	case "noconfirm":
 		config.NoConfirm = true
+	case "markdeps":
+		config.MarkDeps = true
+	case "nomarkdeps":
+		config.MarkDeps = false
+	case "batchinstall":
+		config.BatchInstall = true
+	case "nobatchinstall":
+		config.BatchInstall = false
+	case "quietbuild":
+		config.QuietBuild = true
+	case "noquietbuild":
+		config.QuietBuild = false
+	case "refusepartial":
+		config.RefusePartial = true
+	case "norefusepartial":
+		config.RefusePartial = false
+	case "allowpartial":
+		config.AllowPartial = true
+	case "unsafe-regensums":
+		config.RegenSums = true
+	case "preview":
+		config.RemovePreview = true
+	case "skipinteg":
+		config.SkipInteg = splitNames(value)
+	case "skippgpcheck":
+		config.SkipPGPCheck = splitNames(value)
+	case "holdver":
+		config.HoldVer = true
+	case "config-makepkg":
+		config.MakepkgConf = value
+	case "pacman":
+		config.PacmanBin = value
+	case "git":
+		config.GitBin = value
+	case "gitflags":
+		config.GitFlags = value
+	case "gpg":
+		config.GpgBin = value
+	case "gpgflags":
+		config.GpgFlags = value
+	case "keyserver":
+		config.Keyserver = value
+	case "sandbox":
+		if value == "none" {
+			value = SandboxNone
+		}
+		if !validSandbox(value) {
+			fmt.Println("Invalid sandbox:", value)
+			return true
+		}
+		config.Sandbox = value
+	case "buildbackend":
+		if !validBuildBackend(value) {
+			fmt.Println("Invalid build backend:", value)
+			return true
+		}
+		config.BuildBackend = value
+	case "pkgctl":
+		config.PkgctlBin = value
+	case "pkgctlflags":
+		config.PkgctlFlags = value
+	case "container":
+		config.ContainerBin = value
+	case "containerimage":
+		config.ContainerImage = value
+	case "containerflags":
+		config.ContainerFlags = value
+	case "distro":
+		if !validDistro(value) {
+			fmt.Println("Invalid distribution:", value)
+			return true
+		}
+		config.Distro = value
+	case "provider":
+		if value != PreferRepo && value != PreferAur {
+			fmt.Println("Invalid provider policy:", value)
+			return true
+		}
+		config.Provider = value
+	case "addignore":
+		rule, err := parseIgnoreRule(value)
+		if err != nil {
+			fmt.Println(err)
+			return true
+		}
+		config.Ignore = append(config.Ignore, rule)
+	case "delignore":
+		rules := config.Ignore[:0]
+		for _, rule := range config.Ignore {
+			if rule.Pattern != value {
+				rules = append(rules, rule)
+			}
+		}
+		config.Ignore = rules
+	case "aurdeps":
+		if value != AurDepsAllow && value != AurDepsAsk && value != AurDepsDeny {
+			fmt.Println("Invalid AUR dependency mode:", value)
+			return true
+		}
+		config.AurDeps = value
+	case "debugpkgs":
+		if value != DebugPkgsInstall && value != DebugPkgsSkip && value != DebugPkgsCache {
+			fmt.Println("Invalid debug package mode:", value)
+			return true
+		}
+		config.DebugPkgs = value
+	case "onfailure":
+		if value != OnFailureAbort && value != OnFailureSkip && value != OnFailureAsk {
+			fmt.Println("Invalid failure mode:", value)
+			return true
+		}
+		config.OnFailure = value
+	case "preferrepo":
+		config.ProviderOnce = PreferRepo
+	case "preferaur":
+		config.ProviderOnce = PreferAur
+	case "makejobs":
+		jobs, err := strconv.Atoi(value)
+		if err != nil || jobs < 0 {
+			fmt.Println("Invalid number of make jobs:", value)
+			return true
+		}
+		config.MakeJobs = jobs
+	case "buildprofile":
+		if _, ok := config.BuildProfiles[value]; value != "" && !ok {
+			fmt.Println("Unknown build profile:", value)
+			return true
+		}
+		config.BuildProfile = value
+	case "buildjobs":
+		jobs, err := strconv.Atoi(value)
+		if err != nil || jobs < 1 {
+			fmt.Println("Invalid number of build jobs:", value)
+			return true
+		}
+		config.BuildJobs = jobs
+	case "nice":
+		nice, err := strconv.Atoi(value)
+		if err != nil || nice < 0 || nice > 19 {
+			fmt.Println("Invalid niceness:", value)
+			return true
+		}
+		config.Nice = nice
+	case "cpuquota":
+		if value != "" && !strings.HasSuffix(value, "%") {
+			fmt.Println("Invalid CPU quota, expected a percentage:", value)
+			return true
+		}
+		config.CPUQuota = value
+	case "ionice":
+		config.IONice = true
+	case "noionice":
+		config.IONice = false
+	case "buildtimeout":
+		minutes, err := strconv.Atoi(value)
+		if err != nil || minutes < 0 {
+			fmt.Println("Invalid build timeout:", value)
+			return true
+		}
+		config.BuildTimeout = minutes
+	case "develinterval":
+		hours, err := strconv.Atoi(value)
+		if err != nil || hours < 0 {
+			fmt.Println("Invalid devel check interval:", value)
+			return true
+		}
+		config.DevelInterval = hours
+	case "dbmaxage":
+		hours, err := strconv.Atoi(value)
+		if err != nil || hours < 0 {
+			fmt.Println("Invalid database age:", value)
+			return true
+		}
+		config.DBMaxAge = hours
+	case "aurrpc":
+		if _, ok := aurAPIs[value]; !ok {
+			fmt.Println("Invalid AUR RPC interface:", value)
+			return true
+		}
+		config.AURRPC = value
+	case "mirrorcmd":
+		config.MirrorCmd = value
+	case "mirrorage":
+		days, err := strconv.Atoi(value)
+		if err != nil || days < 0 {
+			fmt.Println("Invalid mirrorlist age:", value)
+			return true
+		}
+		config.MirrorAge = days
 	default:
 		return false
 	}
@@ -399,6 +817,8 @@ func handlePrint() (err error) {
 	switch {
 	case cmdArgs.existsArg("d", "defaultconfig"):
 		fmt.Printf("%#v", config)
+	case cmdArgs.existsArg("g", "currentconfig"):
+		fmt.Println(config.String())
 	case cmdArgs.existsArg("n", "numberupgrades"):
 		err = printNumberOfUpdates()
 	case cmdArgs.existsArg("u", "upgrades"):
@@ -412,6 +832,21 @@ func handlePrint() (err error) {
 		}
 	case cmdArgs.existsArg("s", "stats"):
 		err = localStatistics()
+	case cmdArgs.existsArg("export"):
+		err = printManifest()
+	case cmdArgs.existsArg("maintainer"):
+		user, _, _ := cmdArgs.getArg("maintainer")
+		err = printMaintained(user)
+	case cmdArgs.existsArg("security"):
+		err = printSecurity()
+	case cmdArgs.existsArg("news"):
+		err = printNews(cmdArgs.existsArg("all"))
+	case cmdArgs.existsArg("log"):
+		err = printPacmanLog(cmdArgs.formatTargets())
+	case cmdArgs.existsArg("broken"):
+		err = printBroken()
+	case cmdArgs.existsArg("consumers"):
+		err = printLibraryConsumers(cmdArgs.formatTargets())
 	default:
 		err = nil
 	}
@@ -423,6 +858,8 @@ func handleYay() (err error) {
 	//_, options, targets := cmdArgs.formatArgs()
 	if cmdArgs.existsArg("h", "help") {
 		usage()
+	} else if cmdArgs.existsArg("gendefaultconfig") {
+		err = genDefaultConfig(cmdArgs.existsArg("save"))
 	} else if cmdArgs.existsArg("gendb") {
 		err = createDevelDB()
 		if err != nil {
@@ -432,6 +869,26 @@ func handleYay() (err error) {
 		if err != nil {
 			return
 		}
+	} else if cmdArgs.existsArg("pin") {
+		err = pinVCSPackages(cmdArgs.formatTargets())
+	} else if cmdArgs.existsArg("unpin") {
+		err = unpinVCSPackages(cmdArgs.formatTargets())
+	} else if cmdArgs.existsArg("vcs-status") {
+		err = printVCSStatus()
+	} else if cmdArgs.existsArg("vcs-prune") {
+		err = pruneVCSInfo()
+	} else if cmdArgs.existsArg("orphans") {
+		err = orphanMenu()
+	} else if cmdArgs.existsArg("resume") {
+		err = resumeTransaction()
+	} else if file, _, exists := cmdArgs.getArg("restore"); exists {
+		err = restoreManifest(file)
+	} else if cmdArgs.existsArg("open") {
+		err = openPkgs(cmdArgs.formatTargets())
+	} else if cmdArgs.existsArg("vote") {
+		err = votePkgs(cmdArgs.formatTargets(), true)
+	} else if cmdArgs.existsArg("unvote") {
+		err = votePkgs(cmdArgs.formatTargets(), false)
 	} else if cmdArgs.existsArg("c", "clean") {
 		err = cleanDependencies()
 	} else if cmdArgs.existsArg("g", "getpkgbuild") {
@@ -470,14 +927,17 @@ func handleYogurt() (err error) {
 func handleSync() (err error) {
 	targets := cmdArgs.formatTargets()
 
+	err = checkPartialUpgrade()
+	if err != nil {
+		return
+	}
+
+	if cmdArgs.existsArg("y", "refresh") && cmdArgs.existsArg("u", "sysupgrade") {
+		refreshMirrors()
+	}
+
 	if cmdArgs.existsArg("y", "refresh") {
-		arguments := cmdArgs.copy()
-		cmdArgs.delArg("y", "refresh")
-		arguments.delArg("u", "sysupgrade")
-		arguments.delArg("s", "search")
-		arguments.delArg("i", "info")
-		arguments.targets = make(stringSet)
-		err = passToPacman(arguments)
+		err = refreshDatabases()
 		if err != nil {
 			return
 		}
@@ -494,88 +954,128 @@ func handleSync() (err error) {
 	} else if cmdArgs.existsArg("c", "clean") {
 		err = passToPacman(cmdArgs)
 	} else if cmdArgs.existsArg("u", "sysupgrade") {
+		if config.UpgradeNews {
+			printUpgradeNews()
+		}
+
+		before, versionsErr := installedVersions()
 		err = upgradePkgs(make([]string, 0))
+
+		// also when failing part of the way, what did change is worth knowing
+		if versionsErr == nil && !cmdArgs.existsArg("p", "print") {
+			if reportErr := reportUpgrade(before); reportErr != nil {
+				fmt.Println(reportErr)
+			}
+		}
 	} else if cmdArgs.existsArg("i", "info") {
 		err = syncInfo(targets)
 	} else if len(cmdArgs.targets) > 0 {
-		err = install(cmdArgs)
+		err = install(cmdArgs, cmdArgs.existsArg("-"))
 	}
 
 	return
 }
 
-func handleRemove() (err error) {
-	removeVCSPackage(cmdArgs.formatTargets())
-	err = passToPacman(cmdArgs)
-	return
-}
-
-// BuildIntRange build the range from start to end
-func BuildIntRange(rangeStart, rangeEnd int) []int {
-	if rangeEnd-rangeStart == 0 {
-		// rangeEnd == rangeStart, which means no range
-		return []int{rangeStart}
+// checkPartialUpgrade warns about installing targets against refreshed
+// databases without upgrading the rest of the system, and refuses to with
+// RefusePartial unless AllowPartial is set.
+func checkPartialUpgrade() error {
+	if !cmdArgs.existsArg("y", "refresh") || cmdArgs.existsArg("u", "sysupgrade") {
+		return nil
 	}
-	if rangeEnd < rangeStart {
-		swap := rangeEnd
-		rangeEnd = rangeStart
-		rangeStart = swap
+
+	if len(cmdArgs.targets) == 0 || cmdArgs.existsArg("s", "search", "i", "info", "w", "downloadonly") {
+		return nil
 	}
 
-	final := make([]int, 0)
-	for i := rangeStart; i <= rangeEnd; i++ {
-		final = append(final, i)
+	fmt.Println(boldRedFgBlackBg(arrow+" Warning:"),
+		blackBg("-Sy without -u installs against newer databases than the rest of the system"))
+	fmt.Println(boldRedFgBlackBg(arrow+" Warning:"),
+		blackBg("this partial upgrade can break installed packages, use -Syu instead"))
+
+	if config.RefusePartial && !config.AllowPartial {
+		return fmt.Errorf("Refusing a partial upgrade, pass --allowpartial to do it anyway")
 	}
-	return final
+
+	return nil
 }
 
-// BuildRange construct a range of ints from the format 1-10
-func BuildRange(input string) ([]int, error) {
-	multipleNums := strings.Split(input, "-")
-	if len(multipleNums) != 2 {
-		return nil, errors.New("Invalid range")
+// refreshMirrors runs the configured mirror ranking command when the
+// mirrorlist is older than MirrorAge days. Failing to rank mirrors does not
+// stop the upgrade.
+func refreshMirrors() {
+	if config.MirrorCmd == "" {
+		return
+	}
+
+	info, err := os.Stat(config.MirrorList)
+	if err == nil && time.Since(info.ModTime()) < time.Duration(config.MirrorAge)*24*time.Hour {
+		return
 	}
 
-	rangeStart, err := strconv.Atoi(multipleNums[0])
+	fmt.Println(boldCyanFg("::"), boldFg("Ranking mirrors: "+config.MirrorCmd))
+	cmd := exec.Command("sudo", "sh", "-c", config.MirrorCmd)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	err = cmd.Run()
 	if err != nil {
-		return nil, err
+		fmt.Println(boldRedFgBlackBg(arrow+" Warning:"),
+			blackBg("Ranking mirrors failed: "+err.Error()))
 	}
-	rangeEnd, err := strconv.Atoi(multipleNums[1])
+}
+
+// refreshDatabases runs the -y part of the command line once, on its own,
+// and removes it so none of the later pacman calls refresh again. The alpm
+// handle is reopened so searches, dependency resolution and the upgrade
+// menu all see the refreshed databases.
+func refreshDatabases() error {
+	arguments := cmdArgs.copy()
+	cmdArgs.delArg("y", "refresh")
+	arguments.delArg("u", "sysupgrade")
+	arguments.delArg("s", "search")
+	arguments.delArg("i", "info")
+	arguments.targets = make(stringSet)
+	err := passToPacman(arguments)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	return BuildIntRange(rangeStart, rangeEnd), err
+	return reopenAlpmHandle()
 }
 
-// Contains returns whether e is present in s
-func contains(s []string, e string) bool {
-	for _, a := range s {
-		if a == e {
-			return true
+// reopenAlpmHandle replaces the alpm handle by a new one, which sees the
+// changes pacman made to the databases since the old one was opened. The
+// pacman options of cmdArgs are applied again, they may have changed.
+func reopenAlpmHandle() error {
+	if alpmHandle != nil {
+		err := alpmHandle.Release()
+		alpmHandle = nil
+		if err != nil {
+			return err
 		}
 	}
-	return false
+
+	return initAlpm()
 }
 
-// RemoveIntListFromList removes all src's elements that are present in target
-func removeListFromList(src, target []string) []string {
-	max := len(target)
-	for i := 0; i < max; i++ {
-		if contains(src, target[i]) {
-			target = append(target[:i], target[i+1:]...)
-			max--
-			i--
+func handleRemove() (err error) {
+	if config.RemovePreview {
+		return previewRemoval(cmdArgs)
+	}
+
+	if !cmdArgs.existsArg("p", "print") {
+		if err := printRequiredBy(cmdArgs.formatTargets()); err != nil {
+			fmt.Println(err)
 		}
 	}
-	return target
+
+	removeVCSPackage(cmdArgs.formatTargets())
+	err = passToPacman(cmdArgs)
+	return
 }
 
 // NumberMenu presents a CLI for selecting packages to install.
 func numberMenu(pkgS []string, flags []string) (err error) {
 	//func numberMenu(cmdArgs *arguments) (err error) {
-	var num int
-
 	aurQ, err := narrowSearch(pkgS, true)
 	if err != nil {
 		fmt.Println("Error during AUR search:", err)
@@ -598,79 +1098,53 @@ func numberMenu(pkgS []string, flags []string) (err error) {
 		aurQ.printSearch(numpq + 1)
 	}
 
-	fmt.Println(greenFg("Type the numbers or ranges (e.g. 1-10) you want to install. " +
-		"Separate each one of them with a space."))
-	fmt.Print("Numbers: ")
-	reader := bufio.NewReader(os.Stdin)
-	numberBuf, overflow, err := reader.ReadLine()
-	if err != nil || overflow {
-		fmt.Println(err)
-		return
+	if skipPrompt("search") {
+		return fmt.Errorf("Nothing selected, pass the package names to install with --noconfirm")
 	}
 
-	numberString := string(numberBuf)
-	var aurI, aurNI, repoNI, repoI []string
-	result := strings.Fields(numberString)
-	for _, numS := range result {
-		negate := numS[0] == '^'
-		if negate {
-			numS = numS[1:]
-		}
-		var numbers []int
-		num, err = strconv.Atoi(numS)
-		if err != nil {
-			numbers, err = BuildRange(numS)
-			if err != nil {
-				continue
-			}
-		} else {
-			numbers = []int{num}
-		}
-
-		// Install package
-		for _, x := range numbers {
-			var target string
-			if x > numaq+numpq || x <= 0 {
-				continue
-			} else if x > numpq {
-				if config.SortMode == BottomUp {
-					target = aurQ[numaq+numpq-x].Name
-				} else {
-					target = aurQ[x-numpq-1].Name
-				}
-				if negate {
-					aurNI = append(aurNI, target)
-				} else {
-					aurI = append(aurI, target)
-				}
-			} else {
-				if config.SortMode == BottomUp {
-					target = repoQ[numpq-x].Name()
-				} else {
-					target = repoQ[x-1].Name()
-				}
-				if negate {
-					repoNI = append(repoNI, target)
-				} else {
-					repoI = append(repoI, target)
-				}
+	fmt.Println(greenFg("Type the numbers or ranges you want to install. " +
+		"Separate each one of them with a space."))
+	// nameAt returns the name of the package numbered x
+	nameAt := func(x int) string {
+		if x > numpq {
+			if config.SortMode == BottomUp {
+				return aurQ[numaq+numpq-x].Name
 			}
+			return aurQ[x-numpq-1].Name
+		}
+
+		if config.SortMode == BottomUp {
+			return repoQ[numpq-x].Name()
 		}
+		return repoQ[x-1].Name()
+	}
+
+	menu, err := readNumberMenuOpen("search", ", all, abort", func(x int) {
+		if x >= 1 && x <= numaq+numpq {
+			openWebPage(nameAt(x))
+		}
+	})
+	if err != nil {
+		return
+	}
+
+	if menu.otherInclude.get("abort") {
+		return fmt.Errorf("Aborting due to user")
 	}
+	menu.addKeyword("all", 1, numaq+numpq)
 
-	if len(repoI) == 0 && len(aurI) == 0 &&
-		(len(aurNI) > 0 || len(repoNI) > 0) {
-		// If no package was specified, only exclusions, exclude from all the
-		// packages
-		for _, pack := range aurQ {
-			aurI = append(aurI, pack.Name)
+	var aurI, repoI []string
+	for x := 1; x <= numaq+numpq; x++ {
+		if !menu.selected(x) {
+			continue
 		}
-		for _, pack := range repoQ {
-			repoI = append(repoI, pack.Name())
+
+		if x > numpq {
+			aurI = append(aurI, nameAt(x))
+		} else {
+			repoI = append(repoI, nameAt(x))
 		}
 	}
-	aurI = removeListFromList(aurNI, aurI)
-	repoI = removeListFromList(repoNI, repoI)
 
 	if config.SudoLoop == true {
 		sudoLoopBackground()
@@ -678,7 +1152,7 @@ func numberMenu(pkgS []string, flags []string) (err error) {
 	arguments := makeArguments()
 	arguments.addTarget(repoI...)
 	arguments.addTarget(aurI...)
-	err = install(arguments)
+	err = install(arguments, false)
 
 	return err
 }
@@ -703,24 +1177,103 @@ func passToPacman(args *arguments) error {
 
 	cmd = exec.Command(argArr[0], argArr[1:]...)
 
-	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	cmd.Stdin, cmd.Stdout = os.Stdin, os.Stdout
+	cmd.Stderr = &warningWriter{w: os.Stderr}
 	err := cmd.Run()
 	return err
 }
 
-// passToMakepkg outsources execution to makepkg binary without modifications.
-func passToMakepkg(dir string, args ...string) (err error) {
+// pacmanOutput runs pacman with args, without sudo, and returns what it
+// prints to stdout.
+func pacmanOutput(args *arguments) (string, error) {
+	argArr := append(cmdArgs.formatGlobals(), args.formatArgs()...)
+	argArr = append(argArr, args.formatTargets()...)
 
-	if config.NoConfirm {
-		args = append(args)
-	}
+	cmd := exec.Command(config.PacmanBin, argArr...)
+	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
+	return string(out), err
+}
 
-	cmd := exec.Command(config.MakepkgBin, args...)
+// runMakepkg runs a prepared makepkg command attached to the terminal.
+func runMakepkg(cmd *exec.Cmd) (err error) {
 	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
-	cmd.Dir = dir
 	err = cmd.Run()
 	if err == nil {
 		_ = saveVCSInfo()
 	}
 	return
 }
+
+// makepkgCommand prepares a makepkg invocation in dir honouring the
+// user's makepkg configuration.
+func makepkgCommand(dir string, args ...string) *exec.Cmd {
+	var conf string
+	var err error
+	if crossArch != "" {
+		conf, err = writeCrossConf()
+	} else {
+		conf, err = writeProfileConf(filepath.Base(dir))
+	}
+	if err != nil {
+		fmt.Println(boldRedFgBlackBg(arrow+" Warning:"), blackBg(err.Error()))
+	}
+	if conf == "" || err != nil {
+		conf = config.MakepkgConf
+	}
+	if conf != "" {
+		args = append(args, "--config", conf)
+	}
+
+	if config.HoldVer {
+		args = append(args, "--holdver")
+	}
+
+	cmd := exec.Command(config.MakepkgBin, args...)
+	cmd.Dir = dir
+
+	if jobs := makeJobs(filepath.Base(dir)); jobs > 0 {
+		cmd.Env = append(os.Environ(), "MAKEFLAGS=-j"+strconv.Itoa(jobs))
+	}
+
+	return cmd
+}
+
+// makeJobs returns the build parallelism for pkgbase. A per package
+// override takes precedence over the global setting. Zero means
+// MAKEFLAGS is left to the environment and makepkg.conf.
+func makeJobs(pkgbase string) int {
+	if jobs, ok := config.PackageMakeJobs[pkgbase]; ok {
+		return jobs
+	}
+
+	return config.MakeJobs
+}
+
+// gitCommand prepares a git invocation in dir with the user's extra flags.
+func gitCommand(dir string, args ...string) *exec.Cmd {
+	args = append(strings.Fields(config.GitFlags), args...)
+
+	cmd := exec.Command(config.GitBin, args...)
+	cmd.Dir = dir
+
+	// fail instead of waiting for credentials nobody is there to type
+	if config.NoConfirm {
+		cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	}
+
+	return cmd
+}
+
+// passToGit runs git in dir attached to the terminal.
+func passToGit(dir string, args ...string) error {
+	cmd := gitCommand(dir, args...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	return cmd.Run()
+}
+
+// gpgCommand prepares a gpg invocation with the user's extra flags.
+func gpgCommand(args ...string) *exec.Cmd {
+	args = append(strings.Fields(config.GpgFlags), args...)
+	return exec.Command(config.GpgBin, args...)
+}
@@ -4,7 +4,6 @@ import (
 	"bufio"
 	"fmt"
 	"io"
-	"net/http"
 	"os"
 	"path/filepath"
 	"time"
@@ -14,7 +13,7 @@ import (
 
 //CreateAURList creates a new completion file
 func createAURList(out *os.File, shell string) (err error) {
-	resp, err := http.Get("https://aur.archlinux.org/packages.gz")
+	resp, err := aurGet("/packages.gz")
 	if err != nil {
 		return err
 	}
@@ -1,10 +1,14 @@
 package main
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"strings"
 
 	alpm "github.com/jguer/go-alpm"
 )
@@ -22,22 +26,110 @@ const (
 	TopDown
 )
 
+// Describes which provider wins when both the repos and the AUR satisfy a
+// dependency
+const (
+	PreferRepo = "repo"
+	PreferAur  = "aur"
+)
+
+// Describes whether AUR packages may be built as dependencies of targets
+const (
+	AurDepsAllow = "allow"
+	AurDepsAsk   = "ask"
+	AurDepsDeny  = "deny"
+)
+
+// Describes what is done when building a package fails
+const (
+	OnFailureAbort = "abort"
+	OnFailureSkip  = "skip"
+	OnFailureAsk   = "ask"
+)
+
+// Describes what is done with the -debug packages makepkg splits off
+const (
+	DebugPkgsSkip    = "skip"
+	DebugPkgsInstall = "install"
+	DebugPkgsCache   = "cache"
+)
+
 // Configuration stores yay's config.
 type Configuration struct {
 	BuildDir      string `json:"buildDir"`
+	OverlayDir    string `json:"overlaydir"`
+	AURURL        string `json:"aururl"`
+	AURRPC        string `json:"aurrpc"`
+	AURSession    string `json:"-"`
 	Editor        string `json:"editor"`
 	MakepkgBin    string `json:"makepkgbin"`
+	MakepkgConf   string `json:"makepkgconf"`
 	PacmanBin     string `json:"pacmanbin"`
 	PacmanConf    string `json:"pacmanconf"`
 	TarBin        string `json:"tarbin"`
+	GitBin        string `json:"gitbin"`
+	GitFlags      string `json:"gitflags"`
+	GpgBin        string `json:"gpgbin"`
+	GpgFlags      string `json:"gpgflags"`
+	Keyserver     string `json:"keyserver"`
+	Sandbox       string `json:"sandbox"`
+	BuildBackend  string `json:"buildbackend"`
+	PkgctlBin     string `json:"pkgctlbin"`
+	PkgctlFlags   string `json:"pkgctlflags"`
+	Provider      string `json:"provider"`
+	Distro        string `json:"distro"`
+	ProviderOnce  string `json:"-"`
+	BuildProfile  string `json:"-"`
+	AurDeps       string `json:"aurdeps"`
+	DebugPkgs     string `json:"debugpkgs"`
+	OnFailure     string `json:"onfailure"`
 	RequestSplitN int    `json:"requestsplitn"`
+	MakeJobs      int    `json:"makejobs"`
+	BuildJobs     int    `json:"buildjobs"`
+	Nice          int    `json:"nice"`
+	CPUQuota      string `json:"cpuquota"`
+	BuildTimeout  int    `json:"buildtimeout"`
+	DevelInterval int    `json:"develinterval"`
+	DBMaxAge      int    `json:"dbmaxage"`
+	MirrorCmd     string `json:"mirrorcmd"`
+	MirrorList    string `json:"mirrorlist"`
+	MirrorAge     int    `json:"mirrorage"`
 	SearchMode    int    `json:"-"`
 	SortMode      int    `json:"sortmode"`
 	SudoLoop      bool   `json:"sudoloop"`
 	TimeUpdate    bool   `json:"timeupdate"`
 	NoConfirm     bool   `json:"-"`
+	HoldVer       bool   `json:"-"`
 	Devel         bool   `json:"devel"`
 	CleanAfter    bool   `json:"cleanAfter"`
+	SecurityCheck bool   `json:"securitycheck"`
+	UpgradeNews   bool   `json:"upgradenews"`
+	ShallowClone  bool   `json:"shallowclone"`
+	MarkDeps      bool   `json:"markdeps"`
+	BatchInstall  bool   `json:"batchinstall"`
+	QuietBuild    bool   `json:"quietbuild"`
+	IONice        bool   `json:"ionice"`
+	RefusePartial bool   `json:"refusepartial"`
+	AllowPartial  bool   `json:"-"`
+	RegenSums     bool   `json:"-"`
+	RemovePreview bool   `json:"-"`
+
+	ContainerBin   string `json:"containerbin"`
+	ContainerImage string `json:"containerimage"`
+	ContainerFlags string `json:"containerflags"`
+
+	PackageMakeJobs map[string]int          `json:"packagemakejobs"`
+	DevelIntervals  map[string]int          `json:"develintervals"`
+	Ignore          []ignoreRule            `json:"ignore"`
+	AURFallbacks    []string                `json:"aurfallbacks"`
+	LocalRepos      []string                `json:"localrepos"`
+	BinaryRepos     []string                `json:"binaryrepos"`
+	MemoryHungry    map[string]int          `json:"memoryhungry"`
+	BuildProfiles   map[string]buildProfile `json:"buildprofiles"`
+	PackageProfiles map[string]string       `json:"packageprofiles"`
+	DefaultProfile  string                  `json:"defaultprofile"`
+	SkipInteg       stringSet               `json:"-"`
+	SkipPGPCheck    stringSet               `json:"-"`
 }
 
 var version = "2.297"
@@ -45,7 +137,26 @@ var version = "2.297"
 // baseURL givers the AUR default address.
 const baseURL string = "https://aur.archlinux.org"
 
-var savedInfo infos
+// envOverrides maps the environment variables that override config options
+// to the option they override.
+var envOverrides = map[string]func(*Configuration) *string{
+	"YAY_BUILDDIR": func(c *Configuration) *string { return &c.BuildDir },
+	"YAY_EDITOR":   func(c *Configuration) *string { return &c.Editor },
+	"YAY_AURURL":   func(c *Configuration) *string { return &c.AURURL },
+}
+
+// envReplaced holds the config file values replaced by environment
+// variables, so they are not written back to the config file.
+var envReplaced = make(map[string]string)
+
+var savedInfo vcsStore
+
+// cacheHome holds the directory builds and caches go to.
+var cacheHome string
+
+// stateHome holds the directory the VCS, maintainer and review records are
+// kept in.
+var stateHome string
 
 // configfile holds yay config file path.
 var configFile string
@@ -56,6 +167,9 @@ var vcsFile string
 //completion file
 var completionFile string
 
+// srcinfoCache holds the directory .SRCINFO files are cached in.
+var srcinfoCache string
+
 // Updated returns if database has been updated
 var updated bool
 
@@ -68,6 +182,10 @@ var config Configuration
 // AlpmConf holds the current config values for pacman.
 var alpmConf alpm.PacmanConfig
 
+// pacmanConf holds the path of the pacman.conf in use, config.PacmanConf
+// unless --config or --sysroot is given.
+var pacmanConf string
+
 // AlpmHandle is the alpm handle used by yay.
 var alpmHandle *alpm.Handle
 
@@ -86,7 +204,11 @@ func readAlpmConfig(pacmanconf string) (conf alpm.PacmanConfig, err error) {
 // SaveConfig writes yay config to file.
 func (config *Configuration) saveConfig() error {
 	config.NoConfirm = false
-	marshalledinfo, _ := json.MarshalIndent(config, "", "\t")
+	saved := *config
+	for name, value := range envReplaced {
+		*envOverrides[name](&saved) = value
+	}
+	marshalledinfo := []byte(saved.String())
 	in, err := os.OpenFile(configFile, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
 	if err != nil {
 		return err
@@ -100,20 +222,218 @@ func (config *Configuration) saveConfig() error {
 	return err
 }
 
+// applyEnv overrides config options with the YAY_* environment variables
+// that are set.
+func (config *Configuration) applyEnv() {
+	for name, field := range envOverrides {
+		value := os.Getenv(name)
+		if value == "" {
+			continue
+		}
+
+		envReplaced[name] = *field(config)
+		*field(config) = value
+	}
+}
+
+// configComments documents the options of the config file.
+var configComments = map[string]string{
+	"buildDir":        "Directory PKGBUILDs are downloaded to and built in",
+	"overlaydir":      "Directory of per pkgbase patches and files applied on top of the AUR checkouts",
+	"aururl":          "AUR address packages are looked up and PKGBUILDs fetched from",
+	"aurrpc":          "AUR RPC interface: get for /rpc.php or post for /rpc/v5/",
+	"aurfallbacks":    "AUR addresses tried in order when aururl cannot be reached",
+	"localrepos":      "Directories or git URLs of PKGBUILD directories preferred over the AUR",
+	"binaryrepos":     "pacman.conf repos of prebuilt AUR packages, offered instead of building the same version",
+	"editor":          "Editor for PKGBUILDs, $EDITOR and $VISUAL are used when empty",
+	"makepkgbin":      "makepkg binary",
+	"makepkgconf":     "Alternate makepkg.conf for every build, empty for makepkg's own",
+	"pacmanbin":       "pacman binary",
+	"pacmanconf":      "pacman.conf to read repos and options from",
+	"tarbin":          "bsdtar binary",
+	"gitbin":          "git binary",
+	"gitflags":        "Extra flags passed to every git invocation",
+	"gpgbin":          "gpg binary",
+	"gpgflags":        "Extra flags passed to every gpg invocation",
+	"keyserver":       "Keyserver to import missing PGP keys from, empty for gpg's default",
+	"sandbox":         "Sandbox builds run in: bwrap, systemd-run or empty for none",
+	"buildbackend":    "What builds run with: makepkg, pkgctl for clean chroot builds or container",
+	"pkgctlbin":       "pkgctl binary used by the pkgctl build backend",
+	"pkgctlflags":     "Extra flags passed to pkgctl build",
+	"containerbin":    "podman, docker or a compatible binary running build containers",
+	"containerimage":  "Image build containers run, which needs pacman and base-devel",
+	"containerflags":  "Extra flags passed to container runs",
+	"provider":        "Provider of dependencies available from both: repo or aur",
+	"distro":          "Distribution to adapt to: auto, arch, manjaro, endeavouros or artix",
+	"aurdeps":         "Building AUR dependencies of targets: allow, ask or deny",
+	"debugpkgs":       "Debug packages split off by makepkg: install, skip or cache",
+	"onfailure":       "When packages fail to resolve, download or build: abort, skip them and what needs them, or ask",
+	"requestsplitn":   "Maximum number of packages per AUR RPC request",
+	"makejobs":        "MAKEFLAGS=-j<n> exported to builds, 0 leaves MAKEFLAGS alone",
+	"buildjobs":       "Independent AUR packages built at the same time",
+	"nice":            "Niceness builds run with, 0 leaves it alone",
+	"cpuquota":        "CPU quota of builds like 50% or 200%, empty for none",
+	"ionice":          "Run builds with the idle I/O scheduling class",
+	"buildtimeout":    "Minutes after which a build is killed and counted as failed, 0 for no limit",
+	"develinterval":   "Hours between upstream checks of development packages",
+	"dbmaxage":        "Warn when the sync databases are older than this many hours, 0 never warns",
+	"mirrorcmd":       "Command run as root to rank mirrors before -Syu, empty disables it",
+	"mirrorlist":      "Mirrorlist whose age decides when mirrorcmd runs",
+	"mirrorage":       "Days after which mirrorcmd runs again",
+	"sortmode":        "Search result order: 0 for bottom up, 1 for top down",
+	"sudoloop":        "Keep sudo credentials fresh during long builds",
+	"timeupdate":      "Also upgrade AUR packages modified after they were built",
+	"devel":           "Check development packages for new upstream commits",
+	"cleanAfter":      "Delete build directories after installing",
+	"securitycheck":   "Report security advisories in -Ps",
+	"upgradenews":     "Show distribution news not shown before ahead of -Su",
+	"shallowclone":    "Clone git sources of development packages without history",
+	"markdeps":        "Install AUR packages built as dependencies with --asdeps",
+	"batchinstall":    "Build all AUR packages a layer needs, then install them in one transaction",
+	"quietbuild":      "Show a status line instead of the makepkg output, which goes to build.log",
+	"refusepartial":   "Refuse -Sy with targets but without -u unless --allowpartial is given",
+	"packagemakejobs": "makejobs overrides per pkgbase",
+	"develintervals":  "develinterval overrides per pkgbase",
+	"memoryhungry":    "GiB of RAM and swap needed to build a pkgbase, warned about beforehand",
+	"buildprofiles":   "Named sets of cflags, cxxflags, ldflags, rustflags, march and lto builds can run with",
+	"packageprofiles": "Build profile per pkgbase",
+	"defaultprofile":  "Build profile of the packages without one in packageprofiles, empty for none",
+	"ignore":          "Upgrades to ignore, as pattern and optional until date",
+}
+
+// stripComments removes the // comment lines allowed in the config file.
+func stripComments(content []byte) []byte {
+	var out bytes.Buffer
+
+	for _, line := range strings.SplitAfter(string(content), "\n") {
+		if !strings.HasPrefix(strings.TrimSpace(line), "//") {
+			out.WriteString(line)
+		}
+	}
+
+	return out.Bytes()
+}
+
+// commentedConfig formats config like the config file, with every option
+// preceded by a comment describing it.
+func commentedConfig(config *Configuration) string {
+	var out bytes.Buffer
+
+	for _, line := range strings.SplitAfter(config.String(), "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(line, "\t\"") {
+			key := trimmed[1 : strings.Index(trimmed[1:], "\"")+1]
+			if comment, ok := configComments[key]; ok {
+				out.WriteString("\t// " + comment + "\n")
+			}
+		}
+
+		out.WriteString(line)
+	}
+
+	return out.String()
+}
+
+// genDefaultConfig prints the default configuration with comments, or
+// writes it to the config file if save is set.
+func genDefaultConfig(save bool) error {
+	var defaults Configuration
+	defaultSettings(&defaults)
+	content := commentedConfig(&defaults) + "\n"
+
+	if !save {
+		fmt.Print(content)
+		return nil
+	}
+
+	if _, err := os.Stat(configFile); err == nil {
+		err = os.Rename(configFile, configFile+".bak")
+		if err != nil {
+			return err
+		}
+		fmt.Println(boldGreenFg(arrow), "Old config saved to", configFile+".bak")
+	}
+
+	// do not write the loaded config back over the new one
+	changedConfig = false
+	return ioutil.WriteFile(configFile, []byte(content), 0644)
+}
+
+// String formats the configuration the way it is stored in the config file.
+func (config *Configuration) String() string {
+	marshalledinfo, _ := json.MarshalIndent(config, "", "\t")
+	return string(marshalledinfo)
+}
+
 func defaultSettings(config *Configuration) {
-	config.BuildDir = fmt.Sprintf("%s/.cache/yay/", os.Getenv("HOME"))
+	config.BuildDir = cacheHome + "/"
+	config.OverlayDir = filepath.Dir(configFile) + "/overlay/"
+	config.AURURL = baseURL
+	config.AURFallbacks = []string{}
+	config.LocalRepos = []string{}
+	config.BinaryRepos = []string{}
+	config.AURRPC = RPCGet
 	config.CleanAfter = false
+	config.SecurityCheck = false
+	config.UpgradeNews = true
+	config.ShallowClone = false
 	config.Editor = ""
 	config.Devel = false
 	config.MakepkgBin = "/usr/bin/makepkg"
+	config.MakepkgConf = ""
 	config.NoConfirm = false
 	config.PacmanBin = "/usr/bin/pacman"
 	config.PacmanConf = "/etc/pacman.conf"
 	config.SortMode = BottomUp
 	config.SudoLoop = false
 	config.TarBin = "/usr/bin/bsdtar"
+	config.GitBin = "git"
+	config.DBMaxAge = 72
+	config.MirrorCmd = ""
+	config.MirrorList = "/etc/pacman.d/mirrorlist"
+	config.MirrorAge = 7
+	config.GitFlags = ""
+	config.GpgBin = "gpg"
+	config.GpgFlags = ""
+	config.Keyserver = ""
+	config.Sandbox = SandboxNone
+	config.BuildBackend = BackendMakepkg
+	config.PkgctlBin = "pkgctl"
+	config.PkgctlFlags = ""
+	config.ContainerBin = "podman"
+	config.ContainerImage = defaultContainerImage
+	config.ContainerFlags = ""
+	config.Provider = PreferRepo
+	config.Distro = DistroAuto
+	config.MarkDeps = true
+	config.BatchInstall = false
+	config.QuietBuild = false
+	config.RefusePartial = false
+	config.AurDeps = AurDepsAllow
+	config.DebugPkgs = DebugPkgsSkip
+	config.OnFailure = OnFailureAsk
 	config.TimeUpdate = false
 	config.RequestSplitN = 150
+	config.MakeJobs = 0
+	config.BuildJobs = 1
+	config.Nice = 0
+	config.CPUQuota = ""
+	config.IONice = false
+	config.BuildTimeout = 0
+	config.PackageMakeJobs = make(map[string]int)
+	config.DevelIntervals = make(map[string]int)
+	config.MemoryHungry = make(map[string]int)
+	config.DefaultProfile = ""
+	config.BuildProfiles = make(map[string]buildProfile)
+	config.PackageProfiles = make(map[string]string)
+}
+
+// providerPolicy returns the provider policy of this invocation.
+func providerPolicy() string {
+	if config.ProviderOnce != "" {
+		return config.ProviderOnce
+	}
+	return config.Provider
 }
 
 // Editor returns the preferred system editor.
@@ -167,9 +487,10 @@ func editor() string {
 }
 
 // ContinueTask prompts if user wants to continue task.
-//If NoConfirm is set the action will continue without user input.
-func continueTask(s string, def string) (cont bool) {
-	if config.NoConfirm {
+// If NoConfirm is set the action will continue without user input.
+// An answer for key loaded with --answers takes precedence over both.
+func continueTask(key string, s string, def string) (cont bool) {
+	if skipPrompt(key) {
 		return true
 	}
 	var postFix string
@@ -180,12 +501,13 @@ func continueTask(s string, def string) (cont bool) {
 		postFix = " [y/N] "
 	}
 
-	var response string
 	fmt.Print(boldGreenFg(arrow+" "+s+" "), boldWhiteFg(postFix))
 
-	n, err := fmt.Scanln(&response)
-	if err != nil || n == 0 {
-		return true
+	response, ok := answer(key)
+	if !ok {
+		if n, err := fmt.Scanln(&response); err != nil || n == 0 {
+			return true
+		}
 	}
 
 	if response == string(def[0]) || response == string(def[1]) {
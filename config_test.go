@@ -0,0 +1,26 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestCommentedConfig(t *testing.T) {
+	var defaults Configuration
+	defaultSettings(&defaults)
+
+	content := commentedConfig(&defaults)
+	if content == defaults.String() {
+		t.Fatalf("Expected comments to be added")
+	}
+
+	var parsed Configuration
+	err := json.Unmarshal(stripComments([]byte(content)), &parsed)
+	if err != nil {
+		t.Fatalf("Expected the commented config to parse, found %s", err)
+	}
+
+	if parsed.String() != defaults.String() {
+		t.Errorf("Expected the config to survive a round trip:\n%s\nfound:\n%s", defaults.String(), parsed.String())
+	}
+}
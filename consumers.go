@@ -0,0 +1,161 @@
+package main
+
+import (
+	"debug/elf"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	alpm "github.com/jguer/go-alpm"
+)
+
+// mayBeELF tells whether a file with the given name and mode is worth
+// opening to check whether it is an ELF binary or library.
+func mayBeELF(name string, mode os.FileMode) bool {
+	if !mode.IsRegular() {
+		return false
+	}
+
+	return mode&0111 != 0 || strings.Contains(filepath.Base(name), ".so")
+}
+
+// forEachELF calls fn with every ELF file of pkg installed under root.
+func forEachELF(root string, pkg alpm.Package, fn func(path string, f *elf.File)) {
+	for _, file := range pkg.Files() {
+		path := root + "/" + file.Name
+		info, err := os.Lstat(path)
+		if err != nil || !mayBeELF(path, info.Mode()) {
+			continue
+		}
+
+		f, err := elf.Open(path)
+		if err != nil {
+			continue
+		}
+
+		fn(path, f)
+		f.Close()
+	}
+}
+
+// providedSonames returns the sonames of the libraries pkg ships.
+func providedSonames(root string, pkg alpm.Package) stringSet {
+	provided := make(stringSet)
+	forEachELF(root, pkg, func(path string, f *elf.File) {
+		sonames, _ := f.DynString(elf.DT_SONAME)
+		for _, soname := range sonames {
+			provided.set(soname)
+		}
+	})
+
+	return provided
+}
+
+// libraryConsumer is an installed package linked against some of the
+// libraries of another one.
+type libraryConsumer struct {
+	name    string
+	foreign bool
+	libs    []string
+}
+
+// linkedSonames returns the sonames of provided among needed, sorted.
+func linkedSonames(needed, provided stringSet) []string {
+	var libs []string
+	for soname := range needed {
+		if provided.get(soname) {
+			libs = append(libs, soname)
+		}
+	}
+
+	sort.Strings(libs)
+	return libs
+}
+
+// libraryConsumers returns the installed packages linked against the
+// libraries the installed package name ships.
+func libraryConsumers(name string) ([]libraryConsumer, error) {
+	localDb, err := alpmHandle.LocalDb()
+	if err != nil {
+		return nil, err
+	}
+
+	pkg, err := localDb.PkgByName(name)
+	if err != nil {
+		return nil, fmt.Errorf("%s is not installed", name)
+	}
+
+	root := strings.TrimSuffix(alpmConf.RootDir, "/")
+	provided := providedSonames(root, *pkg)
+	if len(provided) == 0 {
+		return nil, fmt.Errorf("%s ships no shared libraries", name)
+	}
+
+	_, _, _, remoteNames, err := filterPackages()
+	if err != nil {
+		return nil, err
+	}
+	foreign := make(stringSet)
+	for _, remote := range remoteNames {
+		foreign.set(remote)
+	}
+
+	var consumers []libraryConsumer
+	err = localDb.PkgCache().ForEach(func(other alpm.Package) error {
+		if other.Name() == name {
+			return nil
+		}
+
+		if libs := linkedSonames(neededSonames(root, other), provided); len(libs) > 0 {
+			consumers = append(consumers, libraryConsumer{other.Name(), foreign.get(other.Name()), libs})
+		}
+		return nil
+	})
+
+	return consumers, err
+}
+
+// printLibraryConsumers lists the installed packages linked against the
+// libraries of each of the packages names, repo and AUR packages apart.
+func printLibraryConsumers(names []string) error {
+	if len(names) == 0 {
+		return fmt.Errorf("No package given")
+	}
+
+	for _, name := range names {
+		consumers, err := libraryConsumers(name)
+		if err != nil {
+			return err
+		}
+
+		fmt.Println(boldCyanFg("::"), boldFg(fmt.Sprintf("%d packages link against the libraries of %s", len(consumers), name)))
+		if len(consumers) == 0 {
+			continue
+		}
+
+		rows := [][]string{{"Package", "Source", "Libraries"}}
+		for _, foreign := range []bool{false, true} {
+			for _, consumer := range consumers {
+				if consumer.foreign != foreign {
+					continue
+				}
+
+				source := "repo"
+				if foreign {
+					source = "foreign"
+				}
+				rows = append(rows, []string{consumer.name, source, strings.Join(consumer.libs, " ")})
+			}
+		}
+
+		lines := formatTable(rows)
+		fmt.Println(boldFg(lines[0]))
+		for _, line := range lines[1:] {
+			fmt.Println(line)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestMayBeELF(t *testing.T) {
+	tests := []struct {
+		name     string
+		mode     os.FileMode
+		expected bool
+	}{
+		{"/usr/bin/foo", 0755, true},
+		{"/usr/lib/libfoo.so.1.2.3", 0644, true},
+		{"/usr/share/doc/foo/README", 0644, false},
+		{"/usr/lib/libfoo.so", os.ModeSymlink | 0777, false},
+	}
+
+	for _, test := range tests {
+		if found := mayBeELF(test.name, test.mode); found != test.expected {
+			t.Errorf("Expected %s with mode %s to be ELF %t, found %t", test.name, test.mode, test.expected, found)
+		}
+	}
+}
+
+func TestLinkedSonames(t *testing.T) {
+	needed := make(stringSet)
+	needed.set("libc.so.6")
+	needed.set("libicuuc.so.75")
+	needed.set("libicudata.so.75")
+	provided := make(stringSet)
+	provided.set("libicuuc.so.75")
+	provided.set("libicudata.so.75")
+	provided.set("libicui18n.so.75")
+
+	expected := []string{"libicudata.so.75", "libicuuc.so.75"}
+	if found := linkedSonames(needed, provided); !reflect.DeepEqual(found, expected) {
+		t.Errorf("Expected %v, found %v", expected, found)
+	}
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// defaultContainerImage is the image builds run in unless configured
+// otherwise.
+const defaultContainerImage = "docker.io/library/archlinux:base-devel"
+
+// vcsPackages are the repo packages with the tool makepkg fetches VCS
+// sources with, by the protocol of their URL.
+var vcsPackages = map[string]string{
+	"bzr":    "breezy",
+	"fossil": "fossil",
+	"git":    "git",
+	"hg":     "mercurial",
+	"svn":    "subversion",
+}
+
+// sourceTools returns the repo packages makepkg needs to fetch sources,
+// which a container has to install before downloading them.
+func sourceTools(sources []string) []string {
+	seen := make(stringSet)
+	var pkgs []string
+	for _, source := range sources {
+		if i := strings.Index(source, "::"); i != -1 {
+			source = source[i+2:]
+		}
+
+		i := strings.IndexAny(source, "+:")
+		if i == -1 {
+			continue
+		}
+		if pkg, ok := vcsPackages[source[:i]]; ok && !seen.get(pkg) {
+			seen.set(pkg)
+			pkgs = append(pkgs, pkg)
+		}
+	}
+
+	return pkgs
+}
+
+// containerScript is run as root inside the build container: it updates
+// the image, installs pkgs from the repos and the foreign packages the
+// build needs from files and runs args as an unprivileged user with the
+// uid of the caller, so the build directory keeps its owner. Only the
+// output of args goes to stdout.
+func containerScript(uid int, pkgs []string, files []string, args []string) string {
+	var script strings.Builder
+	script.WriteString("set -e\n")
+	fmt.Fprintf(&script, "pacman -Syu --noconfirm --needed %s >&2\n", strings.Join(append([]string{"sudo"}, pkgs...), " "))
+
+	if len(files) > 0 {
+		quoted := make([]string, len(files))
+		for i, file := range files {
+			quoted[i] = shellQuote(file)
+		}
+		fmt.Fprintf(&script, "pacman -U --noconfirm --needed --asdeps %s >&2\n", strings.Join(quoted, " "))
+	}
+
+	fmt.Fprintf(&script, "getent passwd %d >/dev/null || useradd --no-create-home --uid %d yay\n", uid, uid)
+	fmt.Fprintf(&script, "user=$(getent passwd %d | cut -d: -f1)\n", uid)
+	script.WriteString("echo \"$user ALL=(ALL) NOPASSWD: ALL\" > /etc/sudoers.d/yay\n")
+
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		quoted[i] = shellQuote(arg)
+	}
+	fmt.Fprintf(&script, "exec runuser -u \"$user\" -- %s\n", strings.Join(quoted, " "))
+
+	return script.String()
+}
+
+// gnupgHome returns the directory of the user's keyring.
+func gnupgHome() string {
+	if home := os.Getenv("GNUPGHOME"); home != "" {
+		return home
+	}
+
+	return os.Getenv("HOME") + "/.gnupg"
+}
+
+// containerArgs returns the arguments of a container run of cmd, which
+// is prepared to run makepkg or another tool sourcing the PKGBUILD in dir
+// on the host, installing pkgs and files first.
+func containerArgs(dir string, cmd *exec.Cmd, pkgs []string, files []string) []string {
+	buildDir := strings.TrimSuffix(config.BuildDir, "/")
+	args := []string{
+		"run", "--rm",
+		"--volume=" + buildDir + ":" + buildDir,
+		"--volume=/var/cache/pacman/pkg:/var/cache/pacman/pkg",
+		"--workdir=" + dir,
+	}
+
+	// rootless podman maps the caller to root unless asked not to
+	if filepath.Base(config.ContainerBin) == "podman" {
+		args = append(args, "--userns=keep-id", "--user=root")
+	}
+
+	if crossArch != "" {
+		args = append(args, "--platform="+containerPlatforms[crossArch])
+	}
+
+	// makepkg checks the signatures of the sources against the keys
+	// imported on the host
+	keyring := gnupgHome()
+	if info, err := os.Stat(keyring); err == nil && info.IsDir() {
+		args = append(args, "--volume="+keyring+":"+keyring+":ro", "--env=GNUPGHOME="+keyring)
+	}
+
+	// the makepkg.conf of a build profile or given with --config, cross
+	// builds go by the one of the image instead
+	bin := filepath.Base(cmd.Args[0])
+	if cmd.Args[0] == config.MakepkgBin {
+		bin = "makepkg"
+	}
+	run := []string{bin}
+	for i := 1; i < len(cmd.Args); i++ {
+		if cmd.Args[i] != "--config" || i+1 == len(cmd.Args) {
+			run = append(run, cmd.Args[i])
+			continue
+		}
+
+		i++
+		if crossArch != "" {
+			continue
+		}
+
+		conf := cmd.Args[i]
+		run = append(run, "--config", conf)
+		args = append(args, "--volume="+conf+":"+conf+":ro")
+		if strings.HasPrefix(conf, profilesDir) && config.MakepkgConf != "" {
+			args = append(args, "--volume="+config.MakepkgConf+":"+config.MakepkgConf+":ro")
+		}
+	}
+
+	for _, e := range cmd.Env {
+		if strings.HasPrefix(e, "MAKEFLAGS=") {
+			args = append(args, "--env="+e)
+		}
+	}
+
+	args = append(args, strings.Fields(config.ContainerFlags)...)
+
+	return append(args, config.ContainerImage, "sh", "-c", containerScript(os.Getuid(), pkgs, files, run))
+}
+
+// containerCommand prepares the build of the PKGBUILD in dir with makepkg
+// taking args inside a container.
+func containerCommand(dir string, args []string, files []string) *exec.Cmd {
+	makepkg := makepkgCommand(dir, args...)
+	cmd := exec.Command(config.ContainerBin, containerArgs(dir, makepkg, nil, files)...)
+	cmd.Dir = dir
+	return cmd
+}
+
+// pkgbuildCommand returns cmd, which sources the PKGBUILD in its directory
+// before the build to print the .SRCINFO, download or verify the sources,
+// as it is to be run. With the container backend that is in a container
+// like the build, after installing pkgs there, so nothing of the PKGBUILD
+// runs on the host.
+func pkgbuildCommand(cmd *exec.Cmd, pkgs []string) *exec.Cmd {
+	if config.BuildBackend != BackendContainer {
+		return cmd
+	}
+
+	wrapped := exec.Command(config.ContainerBin, containerArgs(cmd.Dir, cmd, pkgs, nil)...)
+	wrapped.Dir = cmd.Dir
+	return wrapped
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestContainerScript(t *testing.T) {
+	script := containerScript(1000, []string{"git"}, []string{"/build/dep/dep-1-1-any.pkg.tar.zst"}, []string{"makepkg", "-Cscf", "--noconfirm"})
+
+	expected := []string{
+		"pacman -Syu --noconfirm --needed sudo git >&2",
+		"pacman -U --noconfirm --needed --asdeps '/build/dep/dep-1-1-any.pkg.tar.zst' >&2",
+		"getent passwd 1000 >/dev/null || useradd --no-create-home --uid 1000 yay",
+		`exec runuser -u "$user" -- 'makepkg' '-Cscf' '--noconfirm'`,
+	}
+	for _, line := range expected {
+		if !strings.Contains(script, line+"\n") {
+			t.Errorf("Expected %q, found:\n%s", line, script)
+		}
+	}
+
+	if script := containerScript(1000, nil, nil, []string{"makepkg"}); strings.Contains(script, "pacman -U") {
+		t.Errorf("Expected no package files to install, found:\n%s", script)
+	}
+}
+
+func TestSourceTools(t *testing.T) {
+	tools := sourceTools([]string{
+		"foo::git+https://example.org/foo.git",
+		"git://example.org/bar.git",
+		"hg+https://example.org/baz",
+		"https://example.org/foo-1.0.tar.gz",
+		"fix.patch",
+	})
+
+	if expected := []string{"git", "mercurial"}; !reflect.DeepEqual(tools, expected) {
+		t.Errorf("Expected %v, found %v", expected, tools)
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+
+	rpc "github.com/mikkeloscar/aur"
+	gopkg "github.com/mikkeloscar/gopkgbuild"
+)
+
+// crossArch is the architecture AUR packages are built for when --arch
+// names another one than this machine's. Cross builds run in containers of
+// that architecture, emulated through binfmt_misc and qemu, and the
+// packages they make are left in the build directory instead of being
+// installed.
+var crossArch string
+
+// containerPlatforms maps architectures to the platforms of their
+// container images.
+var containerPlatforms = map[string]string{
+	"x86_64":  "linux/amd64",
+	"i686":    "linux/386",
+	"aarch64": "linux/arm64",
+	"armv7h":  "linux/arm/v7",
+	"armv6h":  "linux/arm/v6",
+	"riscv64": "linux/riscv64",
+	"loong64": "linux/loong64",
+}
+
+var crossConfOnce sync.Once
+
+// machineArch returns the architecture of this machine as uname reports it.
+func machineArch() (string, error) {
+	var uname syscall.Utsname
+	if err := syscall.Uname(&uname); err != nil {
+		return "", err
+	}
+
+	var arch []byte
+	for _, c := range uname.Machine {
+		if c == 0 {
+			break
+		}
+		arch = append(arch, byte(c))
+	}
+
+	return string(arch), nil
+}
+
+// isCrossArch reports whether packages built for arch cannot be built on a
+// machine of the architecture machine. Architectures the container
+// platforms do not know about, such as x86_64_v3, are taken as native.
+func isCrossArch(arch string, machine string) bool {
+	platform, ok := containerPlatforms[arch]
+	if !ok {
+		return false
+	}
+
+	if machine == "armv7l" {
+		machine = "armv7h"
+	}
+	return platform != containerPlatforms[machine]
+}
+
+// initCrossArch sets crossArch from the architecture pacman was set up
+// with.
+func initCrossArch() error {
+	machine, err := machineArch()
+	if err != nil {
+		return err
+	}
+
+	crossArch = ""
+	if isCrossArch(alpmConf.Architecture, machine) {
+		crossArch = alpmConf.Architecture
+	}
+
+	return nil
+}
+
+// checkCrossBuild makes sure a cross build of the AUR packages can be done,
+// given the repo targets of the invocation.
+func checkCrossBuild(repos []string) error {
+	if config.BuildBackend != BackendContainer {
+		return fmt.Errorf("Building for %s needs --buildbackend container", crossArch)
+	}
+
+	if config.ContainerImage == defaultContainerImage {
+		return fmt.Errorf("%s is built for this machine, set --containerimage to an image for %s", config.ContainerImage, crossArch)
+	}
+
+	if len(repos) > 0 {
+		return fmt.Errorf("Only AUR packages can be built for %s, not: %s", crossArch, strings.Join(repos, " "))
+	}
+
+	return nil
+}
+
+// crossConf returns a makepkg.conf reading base, the makepkg.conf it
+// replaces, and setting CARCH to arch, so makepkg picks the sources and
+// the dependencies of that architecture.
+func crossConf(base string, arch string) string {
+	return fmt.Sprintf("source %s\nCARCH=%s\n", shellQuote(base), shellQuote(arch))
+}
+
+// writeCrossConf writes the makepkg.conf makepkg is run with on this
+// machine during cross builds, once, and returns its path. Build profiles
+// do not apply to cross builds, which use the makepkg.conf of the image.
+func writeCrossConf() (string, error) {
+	base := config.MakepkgConf
+	if base == "" {
+		base = "/etc/makepkg.conf"
+	}
+
+	path := filepath.Join(profilesDir, "cross-"+crossArch+".conf")
+
+	var err error
+	crossConfOnce.Do(func() {
+		if err = os.MkdirAll(profilesDir, 0755); err != nil {
+			return
+		}
+		err = ioutil.WriteFile(path, []byte(crossConf(base, crossArch)), 0644)
+	})
+
+	return path, err
+}
+
+// buildCrossPkgBuilds builds pkgs one after the other for crossArch and
+// lists the package files they made.
+func buildCrossPkgBuilds(pkgs []*rpc.Pkg, srcinfos map[string]*gopkg.PKGBUILD, bases map[string][]*rpc.Pkg) error {
+	deps := baseDeps(bases)
+	failed := make(stringSet)
+	var failedBuilds []string
+	var files []string
+
+	for _, pkg := range pkgs {
+		if dep := failedDep(deps[pkg.PackageBase], failed); dep != "" {
+			printSkippedDependent(pkg.PackageBase, dep)
+			failed.set(pkg.PackageBase)
+			continue
+		}
+
+		buildLog := quietBuildLog(pkg.PackageBase)
+		err := buildPkgBuild(pkg, srcinfos[pkg.PackageBase], bases, buildLog)
+		if err != nil {
+			if !skipFailedBuild(pkg.PackageBase, failureLog(pkg.PackageBase, buildLog), err) {
+				return err
+			}
+
+			failed.set(pkg.PackageBase)
+			failedBuilds = append(failedBuilds, pkg.PackageBase)
+			continue
+		}
+
+		version := srcinfos[pkg.PackageBase].CompleteVersion()
+		for _, split := range bases[pkg.PackageBase] {
+			file := findPkgFile(config.BuildDir+pkg.PackageBase, split.Name, version.String(), crossArch)
+			if file != "" {
+				files = append(files, file)
+			}
+		}
+		currentTransaction.installed(pkg.PackageBase)
+	}
+
+	if len(files) > 0 {
+		fmt.Println(boldCyanFg("::"), boldFg("Built for "+crossArch+":"))
+		for _, file := range files {
+			fmt.Println("   ", file)
+		}
+	}
+
+	return failedBuildsError(failedBuilds)
+}
@@ -0,0 +1,32 @@
+package main
+
+import "testing"
+
+func TestIsCrossArch(t *testing.T) {
+	tests := []struct {
+		arch    string
+		machine string
+		cross   bool
+	}{
+		{"x86_64", "x86_64", false},
+		{"x86_64_v3", "x86_64", false},
+		{"aarch64", "x86_64", true},
+		{"aarch64", "aarch64", false},
+		{"armv7h", "armv7l", false},
+		{"armv7h", "aarch64", true},
+		{"x86_64", "aarch64", true},
+	}
+
+	for _, test := range tests {
+		if cross := isCrossArch(test.arch, test.machine); cross != test.cross {
+			t.Errorf("Expected %s on %s to be a cross build %t, found %t", test.arch, test.machine, test.cross, cross)
+		}
+	}
+}
+
+func TestCrossConf(t *testing.T) {
+	expected := "source '/etc/makepkg.conf'\nCARCH='aarch64'\n"
+	if conf := crossConf("/etc/makepkg.conf", "aarch64"); conf != expected {
+		t.Errorf("Expected %q, found %q", expected, conf)
+	}
+}
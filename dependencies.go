@@ -1,6 +1,8 @@
 package main
 
 import (
+	"fmt"
+	"sort"
 	"strings"
 
 	alpm "github.com/jguer/go-alpm"
@@ -49,6 +51,71 @@ func getNameFromDep(dep string) string {
 	})[0]
 }
 
+// splitDep splits a dependency such as foo>=1.0 into its name, comparison
+// and version.
+func splitDep(dep string) (name string, mod string, version string) {
+	i := strings.IndexAny(dep, "<>=")
+	if i == -1 {
+		return dep, "", ""
+	}
+
+	name, rest := dep[:i], dep[i:]
+	j := strings.IndexFunc(rest, func(c rune) bool {
+		return c != '<' && c != '>' && c != '='
+	})
+	if j == -1 {
+		return name, rest, ""
+	}
+
+	return name, rest[:j], rest[j:]
+}
+
+// assumedInstalled reports whether dep is satisfied by one of the packages
+// passed with --assume-installed, which pacman only applies to the repos.
+func assumedInstalled(dep string) bool {
+	arg, _, exists := cmdArgs.getArg("assume-installed")
+	if !exists {
+		return false
+	}
+
+	for _, assumed := range strings.Split(arg, "\n") {
+		if providesDep(assumed, dep) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// providesDep reports whether provide, a package or one of its provides
+// such as foo=1.0, satisfies dep.
+func providesDep(provide string, dep string) bool {
+	name, mod, version := splitDep(dep)
+	provideName, _, provideVersion := splitDep(provide)
+	if provideName != name {
+		return false
+	}
+
+	if mod == "" {
+		return true
+	}
+	if provideVersion == "" {
+		return false
+	}
+
+	cmp := alpm.VerCmp(provideVersion, version)
+	switch {
+	case mod == "=" && cmp == 0,
+		mod == ">=" && cmp >= 0,
+		mod == "<=" && cmp <= 0,
+		mod == ">" && cmp > 0,
+		mod == "<" && cmp < 0:
+		return true
+	}
+
+	return false
+}
+
 func getDepCatagories(pkgs []string, dt *depTree) (*depCatagories, error) {
 	dc := makeDependCatagories()
 	seen := make(stringSet)
@@ -70,15 +137,13 @@ func getDepCatagories(pkgs []string, dt *depTree) (*depCatagories, error) {
 				seen.set(aurpkg.PackageBase)
 			}
 
-			_, ok := dc.Bases[aurpkg.PackageBase]
-			if !ok {
-				dc.Bases[aurpkg.PackageBase] = make([]*rpc.Pkg, 0)
-			}
-			dc.Bases[aurpkg.PackageBase] = append(dc.Bases[aurpkg.PackageBase], aurpkg)
+			addBaseSplit(dc, aurpkg)
 			delete(dt.Aur, dep)
 		}
 	}
 
+	orderBases(dc)
+
 	for _, base := range dc.Bases {
 		for _, pkg := range base {
 			for _, dep := range pkg.Depends {
@@ -99,6 +164,99 @@ func getDepCatagories(pkgs []string, dt *depTree) (*depCatagories, error) {
 	return dc, nil
 }
 
+// addBaseSplit records pkg as one of the packages to install from the build
+// of its pkgbase, so that a pkgbase is only built once no matter how many of
+// its packages were asked for.
+func addBaseSplit(dc *depCatagories, pkg *rpc.Pkg) {
+	for _, split := range dc.Bases[pkg.PackageBase] {
+		if split.Name == pkg.Name {
+			return
+		}
+	}
+
+	dc.Bases[pkg.PackageBase] = append(dc.Bases[pkg.PackageBase], pkg)
+}
+
+// baseProviders maps the names of the packages of bases, and the sonames
+// they provide, to their pkgbase.
+func baseProviders(bases map[string][]*rpc.Pkg) map[string]string {
+	provider := make(map[string]string)
+	for base, splits := range bases {
+		for _, split := range splits {
+			provider[split.Name] = base
+		}
+	}
+	for soname, name := range sonameProviders {
+		if base, ok := provider[name]; ok {
+			provider[soname] = base
+		}
+	}
+
+	return provider
+}
+
+// baseDeps maps every pkgbase of bases to the other pkgbases of bases its
+// packages depend on.
+func baseDeps(bases map[string][]*rpc.Pkg) map[string][]string {
+	provider := baseProviders(bases)
+
+	deps := make(map[string][]string)
+	for base, splits := range bases {
+		seen := make(stringSet)
+		for _, split := range splits {
+			for _, list := range [2][]string{split.Depends, split.MakeDepends} {
+				for _, dep := range list {
+					depBase, ok := provider[getNameFromDep(dep)]
+					if ok && depBase != base && !seen.get(depBase) && !stagedDeps[base].get(depBase) {
+						seen.set(depBase)
+						deps[base] = append(deps[base], depBase)
+					}
+				}
+			}
+		}
+	}
+
+	return deps
+}
+
+// orderBases sorts dc.Aur so that every pkgbase comes after the pkgbases its
+// packages depend on. A pkgbase is placed when the first of its packages is
+// seen, so the dependencies of a package of the same base found later on
+// could otherwise end up being built after it. Cycles have already been
+// ruled out by findAurCycle.
+func orderBases(dc *depCatagories) {
+	deps := baseDeps(dc.Bases)
+
+	byBase := make(map[string]*rpc.Pkg)
+	for _, pkg := range dc.Aur {
+		byBase[pkg.PackageBase] = pkg
+	}
+
+	ordered := make([]*rpc.Pkg, 0, len(dc.Aur))
+	placed := make(stringSet)
+	var place func(base string)
+	place = func(base string) {
+		if placed.get(base) {
+			return
+		}
+		placed.set(base)
+
+		for _, dep := range deps[base] {
+			place(dep)
+		}
+
+		if pkg, ok := byBase[base]; ok {
+			ordered = append(ordered, pkg)
+		}
+	}
+
+	for _, pkg := range dc.Aur {
+		place(pkg.PackageBase)
+	}
+
+	dc.Aur = ordered
+}
+
 func repoDepCatagoriesRecursive(pkg *alpm.Package, dc *depCatagories, dt *depTree, isMake bool) {
 	pkg.Depends().ForEach(func(_dep alpm.Depend) error {
 		dep := _dep.Name
@@ -125,11 +283,7 @@ func depCatagoriesRecursive(pkg *rpc.Pkg, dc *depCatagories, dt *depTree, isMake
 
 			aurpkg, exists := dt.Aur[dep]
 			if exists {
-				_, ok := dc.Bases[aurpkg.PackageBase]
-				if !ok {
-					dc.Bases[aurpkg.PackageBase] = make([]*rpc.Pkg, 0)
-				}
-				dc.Bases[aurpkg.PackageBase] = append(dc.Bases[aurpkg.PackageBase], aurpkg)
+				addBaseSplit(dc, aurpkg)
 
 				delete(dt.Aur, dep)
 				depCatagoriesRecursive(aurpkg, dc, dt, isMake, seen)
@@ -219,6 +373,9 @@ func repoTreeRecursive(pkg *alpm.Package, dt *depTree, localDb *alpm.Db, syncDb
 			return
 		}
 
+		if assumedInstalled(dep.String()) {
+			return
+		}
 		_, isInstalled := localDb.PkgCache().FindSatisfier(dep.String())
 		if isInstalled == nil {
 			return
@@ -248,20 +405,39 @@ func depTreeRecursive(dt *depTree, localDb *alpm.Db, syncDb alpm.DbList, isMake
 	}
 
 	//assume toprocess only contains aur stuff we have not seen
-	info, err := rpc.Info(currentProcess)
+	info, err := aurInfo(currentProcess)
 	if err != nil {
 		return
 	}
 
+	srcinfos := fetchSrcinfos(info)
+
 	//cache the results
 	for _, pkg := range info {
 		//copying to p fixes a bug
 		//would rather not copy but cant find another way to fix
 		p := pkg
+		fetched := srcinfos[p.PackageBase]
+		err = fetched.err
+		if err == nil {
+			err = applySrcinfo(&p, fetched.content)
+		}
+		if err != nil {
+			// fall back to what the RPC reported
+			fmt.Println(err)
+			err = nil
+		}
 		dt.Aur[pkg.Name] = &p
 
 	}
 
+	//sonames resolve to the package providing them
+	for soname, provider := range sonameProviders {
+		if pkg, exists := dt.Aur[provider]; exists {
+			dt.Aur[soname] = pkg
+		}
+	}
+
 	//loop through to process and check if we now have
 	//each packaged cached
 	//if its not cached we assume its missing
@@ -270,6 +446,15 @@ func depTreeRecursive(dt *depTree, localDb *alpm.Db, syncDb alpm.DbList, isMake
 
 		//did not get it in the request
 		if !exists {
+			//when preferring the AUR the repos were not checked yet
+			if providerPolicy() == PreferAur {
+				repoPkg, inRepos := syncDb.FindSatisfier(dt.ToProcess[k])
+				if inRepos == nil {
+					repoTreeRecursive(repoPkg, dt, localDb, syncDb)
+					continue
+				}
+			}
+
 			dt.Missing.set(dt.ToProcess[k])
 			continue
 		}
@@ -298,15 +483,43 @@ func depTreeRecursive(dt *depTree, localDb *alpm.Db, syncDb alpm.DbList, isMake
 				}
 
 				//check if already installed
+				if assumedInstalled(versionedDep) {
+					continue
+				}
 				_, isInstalled := localDb.PkgCache().FindSatisfier(versionedDep)
 				if isInstalled == nil {
 					continue
 				}
 
-				//check the repos for a matching dep
-				repoPkg, inRepos := syncDb.FindSatisfier(versionedDep)
-				if inRepos == nil {
-					repoTreeRecursive(repoPkg, dt, localDb, syncDb)
+				//check the repos for a matching dep, unless the AUR
+				//is preferred and gets asked first
+				if providerPolicy() != PreferAur || isSonameDep(versionedDep) {
+					repoPkg, inRepos := syncDb.FindSatisfier(versionedDep)
+					if inRepos == nil {
+						repoTreeRecursive(repoPkg, dt, localDb, syncDb)
+						continue
+					}
+				}
+
+				//no AUR package is named after a soname, look for
+				//the one providing it instead
+				if isSonameDep(versionedDep) {
+					if _, exists = sonameProviders[dep]; exists {
+						continue
+					}
+
+					provider := aurSonameProvider(versionedDep)
+					if provider == "" {
+						dt.Missing.set(versionedDep)
+						continue
+					}
+
+					sonameProviders[dep] = provider
+					if pkg, exists := dt.Aur[provider]; exists {
+						dt.Aur[dep] = pkg
+					} else {
+						nextProcess = append(nextProcess, provider)
+					}
 					continue
 				}
 
@@ -321,3 +534,207 @@ func depTreeRecursive(dt *depTree, localDb *alpm.Db, syncDb alpm.DbList, isMake
 
 	return
 }
+
+// aurDepBases returns the pkgbases dc builds only to satisfy dependencies
+// of targets.
+func aurDepBases(targets []string, dc *depCatagories) []string {
+	isTarget := make(stringSet)
+	for _, target := range targets {
+		isTarget.set(getNameFromDep(target))
+	}
+
+	var bases []string
+	for _, pkg := range dc.Aur {
+		target := false
+		for _, split := range dc.Bases[pkg.PackageBase] {
+			if isTarget.get(split.Name) {
+				target = true
+				break
+			}
+		}
+
+		if !target {
+			bases = append(bases, pkg.PackageBase)
+		}
+	}
+
+	return bases
+}
+
+// checkAurDeps enforces config.AurDeps on the AUR packages dc would build
+// as dependencies.
+func checkAurDeps(targets []string, dc *depCatagories) error {
+	if config.AurDeps == AurDepsAllow {
+		return nil
+	}
+
+	bases := aurDepBases(targets, dc)
+	if len(bases) == 0 {
+		return nil
+	}
+
+	fmt.Println(boldRedFgBlackBg(arrow+" Warning:"),
+		blackBg("These AUR dependencies would be built: "+strings.Join(bases, " ")))
+
+	if config.AurDeps == AurDepsDeny {
+		return fmt.Errorf("Refusing to build AUR dependencies")
+	}
+
+	if !continueTask("aurdeps", "Build them?", "nN") {
+		return fmt.Errorf("Aborting due to user")
+	}
+
+	return nil
+}
+
+// baseEdges returns the dependencies between the pkgbases of the AUR
+// packages in dt, but for the ones in stagedDeps. Each edge records whether
+// it is only needed for building.
+func baseEdges(dt *depTree) map[string]map[string]bool {
+	edges := make(map[string]map[string]bool)
+
+	for _, pkg := range dt.Aur {
+		if _, ok := edges[pkg.PackageBase]; !ok {
+			edges[pkg.PackageBase] = make(map[string]bool)
+		}
+
+		for i, list := range [2][]string{pkg.Depends, pkg.MakeDepends} {
+			for _, dep := range list {
+				aurpkg, ok := dt.Aur[getNameFromDep(dep)]
+				// packages of one pkgbase are built together
+				if !ok || aurpkg.PackageBase == pkg.PackageBase || stagedDeps[pkg.PackageBase].get(aurpkg.PackageBase) {
+					continue
+				}
+
+				isMake, seen := edges[pkg.PackageBase][aurpkg.PackageBase]
+				edges[pkg.PackageBase][aurpkg.PackageBase] = i == 1 && (!seen || isMake)
+			}
+		}
+	}
+
+	return edges
+}
+
+// findAurCycle looks for a cycle in the dependencies between the pkgbases
+// of dt. The cycle is returned as the pkgbases along it, starting and ending
+// with the same one, or nil if there is none.
+func findAurCycle(dt *depTree) []string {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+
+	edges := baseEdges(dt)
+	state := make(map[string]int)
+	var path []string
+	var visit func(base string) []string
+
+	sorted := func(m map[string]bool) []string {
+		keys := make([]string, 0, len(m))
+		for k := range m {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		return keys
+	}
+
+	visit = func(base string) []string {
+		state[base] = visiting
+		path = append(path, base)
+
+		for _, dep := range sorted(edges[base]) {
+			switch state[dep] {
+			case visiting:
+				for i, b := range path {
+					if b == dep {
+						return append(append([]string{}, path[i:]...), dep)
+					}
+				}
+			case unvisited:
+				if cycle := visit(dep); cycle != nil {
+					return cycle
+				}
+			}
+		}
+
+		path = path[:len(path)-1]
+		state[base] = visited
+		return nil
+	}
+
+	bases := make(map[string]bool)
+	for base := range edges {
+		bases[base] = true
+	}
+
+	for _, base := range sorted(bases) {
+		if state[base] == unvisited {
+			if cycle := visit(base); cycle != nil {
+				return cycle
+			}
+		}
+	}
+
+	return nil
+}
+
+// stagedDeps holds the dependencies between pkgbases left out to break
+// dependency cycles: a pkgbase is built without the pkgbases it maps to,
+// with its checks skipped, and installed ahead of them.
+var stagedDeps = make(map[string]stringSet)
+
+// staged reports whether pkgbase is built and installed ahead of some of
+// its dependencies.
+func staged(pkgbase string) bool {
+	return len(stagedDeps[pkgbase]) > 0
+}
+
+// breakAurCycle offers to break cycle, found by findAurCycle, at its first
+// dependency that is not only needed for building: that pkgbase is built
+// first with makepkg --nodeps --nocheck and installed without the
+// dependency, which is built and installed right after. Cycles of build
+// dependencies alone cannot be broken.
+func breakAurCycle(cycle []string, dt *depTree) error {
+	edges := baseEdges(dt)
+	for i := 1; i < len(cycle); i++ {
+		base, dep := cycle[i-1], cycle[i]
+		if edges[base][dep] {
+			continue
+		}
+
+		fmt.Println(boldRedFgBlackBg(arrow+" Warning:"),
+			blackBg("Dependency cycle: "+formatCycle(cycle, dt)))
+		if !continueTask("cycle", "Build "+base+" without "+dep+" and its checks, installing it first?", "nN") {
+			return fmt.Errorf("Aborting due to user")
+		}
+
+		if stagedDeps[base] == nil {
+			stagedDeps[base] = make(stringSet)
+		}
+		stagedDeps[base].set(dep)
+		return nil
+	}
+
+	return fmt.Errorf("Dependency cycle: %s\n"+
+		"None of these can be built first. Install one of them from a "+
+		"binary package or another source and try again.", formatCycle(cycle, dt))
+}
+
+// formatCycle describes a cycle found by findAurCycle, telling apart the
+// edges that are only needed for building.
+func formatCycle(cycle []string, dt *depTree) string {
+	edges := baseEdges(dt)
+
+	str := cycle[0]
+	for i := 1; i < len(cycle); i++ {
+		kind := "depends on"
+		if edges[cycle[i-1]][cycle[i]] {
+			kind = "needs to build"
+		}
+
+		str += " " + kind + " " + cycle[i]
+	}
+
+	return str
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	rpc "github.com/mikkeloscar/aur"
+)
+
+func TestFindAurCycle(t *testing.T) {
+	dt := makeDepTree()
+	dt.Aur["a"] = &rpc.Pkg{Name: "a", PackageBase: "a", Depends: []string{"b>=1.0", "glibc"}}
+	dt.Aur["b"] = &rpc.Pkg{Name: "b", PackageBase: "b", MakeDepends: []string{"c"}}
+	dt.Aur["c"] = &rpc.Pkg{Name: "c", PackageBase: "c", Depends: []string{"a"}}
+	dt.Aur["d"] = &rpc.Pkg{Name: "d", PackageBase: "d", Depends: []string{"a"}}
+
+	cycle := findAurCycle(dt)
+	if !reflect.DeepEqual(cycle, []string{"a", "b", "c", "a"}) {
+		t.Fatalf("Expected cycle a b c a, found %v", cycle)
+	}
+
+	expected := "a depends on b needs to build c depends on a"
+	if str := formatCycle(cycle, dt); str != expected {
+		t.Errorf("Expected %q, found %q", expected, str)
+	}
+
+	dt.Aur["c"].PackageBase = "b"
+	if cycle := findAurCycle(dt); !reflect.DeepEqual(cycle, []string{"a", "b", "a"}) {
+		t.Errorf("Expected cycle a b a between pkgbases, found %v", cycle)
+	}
+
+	dt.Aur["c"].Depends = nil
+	if cycle := findAurCycle(dt); cycle != nil {
+		t.Errorf("Expected no cycle, found %v", cycle)
+	}
+}
+
+func TestBreakAurCycle(t *testing.T) {
+	old := config
+	defer func() { config = old }()
+	defer func() { stagedDeps = make(map[string]stringSet) }()
+	config.NoConfirm = true
+
+	dt := makeDepTree()
+	dt.Aur["a"] = &rpc.Pkg{Name: "a", PackageBase: "a", Depends: []string{"b"}}
+	dt.Aur["b"] = &rpc.Pkg{Name: "b", PackageBase: "b", Depends: []string{"a"}, MakeDepends: []string{"a"}}
+
+	cycle := findAurCycle(dt)
+	if err := breakAurCycle(cycle, dt); err != nil {
+		t.Fatalf("Expected the cycle %v to be broken, found %v", cycle, err)
+	}
+	if !stagedDeps["a"].get("b") || staged("b") {
+		t.Errorf("Expected a to be built without b, found %v", stagedDeps)
+	}
+	if cycle := findAurCycle(dt); cycle != nil {
+		t.Errorf("Expected no cycle left, found %v", cycle)
+	}
+
+	dc := makeDependCatagories()
+	dc.Aur = []*rpc.Pkg{dt.Aur["b"], dt.Aur["a"]}
+	for _, pkg := range dc.Aur {
+		addBaseSplit(dc, pkg)
+	}
+	orderBases(dc)
+	if dc.Aur[0].Name != "a" || dc.Aur[1].Name != "b" {
+		t.Errorf("Expected a to be built before b, found %v %v", dc.Aur[0].Name, dc.Aur[1].Name)
+	}
+
+	stagedDeps = make(map[string]stringSet)
+	dt.Aur["a"].Depends = nil
+	dt.Aur["a"].MakeDepends = []string{"b"}
+	dt.Aur["b"].Depends = nil
+	if err := breakAurCycle(findAurCycle(dt), dt); err == nil {
+		t.Errorf("Expected a cycle of build dependencies to stay unbroken")
+	}
+}
+
+func TestSplitDep(t *testing.T) {
+	deps := []struct {
+		dep, name, mod, version string
+	}{
+		{"glibc", "glibc", "", ""},
+		{"python>=3.6", "python", ">=", "3.6"},
+		{"foo=1:2.0-1", "foo", "=", "1:2.0-1"},
+		{"bar<2", "bar", "<", "2"},
+	}
+
+	for _, d := range deps {
+		name, mod, version := splitDep(d.dep)
+		if name != d.name || mod != d.mod || version != d.version {
+			t.Errorf("Expected %s to split into %s %s %s, found %s %s %s",
+				d.dep, d.name, d.mod, d.version, name, mod, version)
+		}
+	}
+}
+
+func TestOrderBases(t *testing.T) {
+	a1 := &rpc.Pkg{Name: "a1", PackageBase: "a"}
+	a2 := &rpc.Pkg{Name: "a2", PackageBase: "a", Depends: []string{"b"}}
+	b := &rpc.Pkg{Name: "b", PackageBase: "b", MakeDepends: []string{"c>=2"}}
+	c := &rpc.Pkg{Name: "c", PackageBase: "c"}
+
+	dc := makeDependCatagories()
+	dc.Aur = []*rpc.Pkg{a1, c, b}
+	for _, pkg := range []*rpc.Pkg{a1, a2, a1, b, c} {
+		addBaseSplit(dc, pkg)
+	}
+
+	if splits := dc.Bases["a"]; !reflect.DeepEqual(splits, []*rpc.Pkg{a1, a2}) {
+		t.Errorf("Expected a1 and a2 once each in pkgbase a, found %v", splits)
+	}
+
+	orderBases(dc)
+
+	var bases []string
+	for _, pkg := range dc.Aur {
+		bases = append(bases, pkg.PackageBase)
+	}
+	if !reflect.DeepEqual(bases, []string{"c", "b", "a"}) {
+		t.Errorf("Expected build order c b a, found %v", bases)
+	}
+}
+
+func TestBaseDepsSoname(t *testing.T) {
+	sonameProviders["libfoo.so"] = "foo-libs"
+	defer delete(sonameProviders, "libfoo.so")
+
+	bases := map[string][]*rpc.Pkg{
+		"foo": {{Name: "foo-libs", PackageBase: "foo"}},
+		"bar": {{Name: "bar", PackageBase: "bar", Depends: []string{"libfoo.so=3-64"}}},
+	}
+
+	if deps := baseDeps(bases); !reflect.DeepEqual(deps, map[string][]string{"bar": {"foo"}}) {
+		t.Errorf("Expected bar to depend on foo, found %v", deps)
+	}
+}
+
+func TestProvidesDep(t *testing.T) {
+	tests := []struct {
+		provide string
+		dep     string
+		ok      bool
+	}{
+		{"libfoo.so=3-64", "libfoo.so", true},
+		{"libfoo.so", "libfoo.so=3-64", false},
+		{"libbar.so=3-64", "libfoo.so", false},
+		{"foo", "foo", true},
+	}
+
+	for _, test := range tests {
+		if ok := providesDep(test.provide, test.dep); ok != test.ok {
+			t.Errorf("Expected %s to satisfy %s %t, found %t", test.provide, test.dep, test.ok, ok)
+		}
+	}
+}
+
+func TestIsSonameDep(t *testing.T) {
+	tests := []struct {
+		dep    string
+		soname bool
+	}{
+		{"libfoo.so", true},
+		{"libfoo.so=3-64", true},
+		{"libfoo.so>=3", true},
+		{"libfoo.so.3", false},
+		{"python-foo.sourcehut", false},
+		{"foo>=1.0", false},
+	}
+
+	for _, test := range tests {
+		if soname := isSonameDep(test.dep); soname != test.soname {
+			t.Errorf("Expected %s to be on a soname %t, found %t", test.dep, test.soname, soname)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+// Distributions yay knows the differences from Arch Linux of
+const (
+	DistroAuto        = "auto"
+	DistroArch        = "arch"
+	DistroManjaro     = "manjaro"
+	DistroEndeavourOS = "endeavouros"
+	DistroArtix       = "artix"
+)
+
+// distroInfo is what yay needs to know about a distribution.
+type distroInfo struct {
+	// name is shown to the user
+	name string
+	// newsURL is the RSS feed of its news, which announce manual
+	// interventions
+	newsURL string
+	// archRepos are the official repos of Arch Linux it ships or lets
+	// users enable under the same name, with package pages on
+	// archlinux.org and packaging at archPackagingURL
+	archRepos stringSet
+	// delayed is set for distributions whose repos get the updates of
+	// Arch Linux later, held back in branches
+	delayed bool
+}
+
+var distros = map[string]distroInfo{
+	DistroArch: {
+		name:      "Arch Linux",
+		newsURL:   "https://archlinux.org/feeds/news/",
+		archRepos: officialRepos,
+	},
+	DistroManjaro: {
+		name:      "Manjaro",
+		newsURL:   "https://forum.manjaro.org/c/announcements/11.rss",
+		archRepos: stringSet{"core": {}, "extra": {}, "multilib": {}},
+		delayed:   true,
+	},
+	DistroEndeavourOS: {
+		name:      "EndeavourOS",
+		newsURL:   "https://archlinux.org/feeds/news/",
+		archRepos: officialRepos,
+	},
+	DistroArtix: {
+		name:      "Artix",
+		newsURL:   "https://artixlinux.org/feed.php",
+		archRepos: stringSet{"extra": {}, "multilib": {}, "extra-testing": {}, "multilib-testing": {}},
+	},
+}
+
+// osReleaseFile describes the distribution the machine runs.
+const osReleaseFile = "/etc/os-release"
+
+// pacmanMirrorsConf sets the branch Manjaro installs from.
+const pacmanMirrorsConf = "/etc/pacman-mirrors.conf"
+
+// validDistro reports whether name can be given as the distribution.
+func validDistro(name string) bool {
+	_, ok := distros[name]
+	return ok || name == DistroAuto
+}
+
+// osReleaseValue returns the value of key in an os-release file.
+func osReleaseValue(content []byte, key string) string {
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if !strings.HasPrefix(line, key+"=") {
+			continue
+		}
+
+		return strings.Trim(line[len(key)+1:], `"'`)
+	}
+
+	return ""
+}
+
+// detectDistro returns the distribution an os-release file describes,
+// Arch Linux for unknown ones.
+func detectDistro(osRelease []byte) string {
+	ids := append([]string{osReleaseValue(osRelease, "ID")},
+		strings.Fields(osReleaseValue(osRelease, "ID_LIKE"))...)
+
+	for _, id := range ids {
+		// Manjaro ARM goes by manjaro-arm
+		id = strings.TrimSuffix(id, "-arm")
+		if _, ok := distros[id]; ok {
+			return id
+		}
+	}
+
+	return DistroArch
+}
+
+// currentDistro returns the distribution yay adapts to, detected from
+// osReleaseFile unless configured.
+func currentDistro() distroInfo {
+	if config.Distro != DistroAuto {
+		return distros[config.Distro]
+	}
+
+	content, err := ioutil.ReadFile(osReleaseFile)
+	if err != nil {
+		return distros[DistroArch]
+	}
+
+	return distros[detectDistro(content)]
+}
+
+// manjaroBranch returns the branch a pacman-mirrors.conf installs from.
+func manjaroBranch(content []byte) string {
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		fields := strings.SplitN(scanner.Text(), "=", 2)
+		if len(fields) == 2 && strings.TrimSpace(fields[0]) == "Branch" {
+			return strings.TrimSpace(fields[1])
+		}
+	}
+
+	return "stable"
+}
+
+// warnDelayedBranch warns that AUR packages, which follow Arch Linux, may
+// need newer dependencies than distributions holding updates back have.
+func warnDelayedBranch() {
+	distro := currentDistro()
+	if !distro.delayed {
+		return
+	}
+
+	branch := "stable"
+	if content, err := ioutil.ReadFile(pacmanMirrorsConf); err == nil {
+		branch = manjaroBranch(content)
+	}
+
+	// unstable gets them within days
+	if branch == "unstable" {
+		return
+	}
+
+	fmt.Println(boldRedFgBlackBg(arrow+" Warning:"),
+		blackBg("AUR packages follow Arch Linux, whose updates reach the "+branch+" branch of "+distro.name+" later"))
+	fmt.Println(boldRedFgBlackBg(arrow+" Warning:"),
+		blackBg("builds may fail or need newer dependencies than the repos have yet"))
+}
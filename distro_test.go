@@ -0,0 +1,41 @@
+package main
+
+import "testing"
+
+func TestDetectDistro(t *testing.T) {
+	tests := []struct {
+		osRelease string
+		distro    string
+	}{
+		{"NAME=\"Arch Linux\"\nID=arch\n", DistroArch},
+		{"NAME=\"Manjaro Linux\"\nID=manjaro\nID_LIKE=arch\n", DistroManjaro},
+		{"NAME=\"Manjaro ARM\"\nID=\"manjaro-arm\"\nID_LIKE=\"manjaro arch\"\n", DistroManjaro},
+		{"NAME='EndeavourOS'\nID='endeavouros'\nID_LIKE='arch'\n", DistroEndeavourOS},
+		{"NAME=\"Artix Linux\"\nID=artix\n", DistroArtix},
+		{"NAME=\"Garuda Linux\"\nID=garuda\nID_LIKE=arch\n", DistroArch},
+		{"", DistroArch},
+	}
+
+	for _, test := range tests {
+		if distro := detectDistro([]byte(test.osRelease)); distro != test.distro {
+			t.Errorf("Expected %q for %q, found %q", test.distro, test.osRelease, distro)
+		}
+	}
+}
+
+func TestManjaroBranch(t *testing.T) {
+	tests := []struct {
+		conf   string
+		branch string
+	}{
+		{"## Branch Pacman should use (stable, testing, unstable)\n# Branch = stable\nBranch = testing\n", "testing"},
+		{"Branch=unstable\n", "unstable"},
+		{"# Branch = testing\n", "stable"},
+	}
+
+	for _, test := range tests {
+		if branch := manjaroBranch([]byte(test.conf)); branch != test.branch {
+			t.Errorf("Expected branch %q for %q, found %q", test.branch, test.conf, branch)
+		}
+	}
+}
@@ -6,9 +6,12 @@ import (
 	"net/http"
 	"os"
 	"os/exec"
+	"regexp"
 	"strings"
+	"sync"
 
 	rpc "github.com/mikkeloscar/aur"
+	gopkg "github.com/mikkeloscar/gopkgbuild"
 )
 
 func downloadFile(path string, url string) (err error) {
@@ -32,7 +35,7 @@ func downloadFile(path string, url string) (err error) {
 }
 
 // DownloadAndUnpack downloads url tgz and extracts to path.
-func downloadAndUnpack(url string, path string, trim bool) (err error) {
+func downloadAndUnpack(url string, path string) (err error) {
 	err = os.MkdirAll(path, 0755)
 	if err != nil {
 		return
@@ -49,18 +52,203 @@ func downloadAndUnpack(url string, path string, trim bool) (err error) {
 		return
 	}
 
-	if trim {
-		err = exec.Command("/bin/sh", "-c",
-			config.TarBin+" --strip-components 2 --include='*/"+fileName[:len(fileName)-7]+"/trunk/' -xf "+tarLocation+" -C "+path).Run()
-		os.Rename(path+"trunk", path+fileName[:len(fileName)-7]) // kurwa
-	} else {
-		err = exec.Command(config.TarBin, "-xf", tarLocation, "-C", path).Run()
+	return exec.Command(config.TarBin, "-xf", tarLocation, "-C", path).Run()
+}
+
+// gitDownload clones the AUR repository at url into path+name, or
+// updates it if it was cloned before. Clones that are found broken are
+// cloned again from scratch.
+func gitDownload(url string, path string, name string) error {
+	fresh, err := gitFetch(url, path, name)
+	if err != nil || fresh {
+		return err
 	}
+
+	return updateCheckout(name, path+name+"/")
+}
+
+// gitFetch does the network part of gitDownload: it clones url into
+// path+name, or fetches upstream into an existing clone without touching
+// its checkout. fresh reports whether a new clone was made, which has no
+// checkout left to update. It asks nothing, so several can run at once.
+func gitFetch(url string, path string, name string) (fresh bool, err error) {
+	dir := path + name + "/"
+
+	if _, err = os.Stat(dir + ".git"); os.IsNotExist(err) {
+		return true, gitClone(url, path, name)
+	}
+
+	if !gitHealthy(dir) {
+		fmt.Println(boldRedFgBlackBg(arrow+" Warning:"),
+			blackBg(name+" clone is corrupted -- cloning again"))
+		return true, gitClone(url, path, name)
+	}
+
+	// follow changes of the AUR address
+	err = gitCommand(dir, "remote", "set-url", "origin", url).Run()
 	if err != nil {
 		return
 	}
 
-	return
+	err = passToGit(dir, "fetch", "--no-progress", "origin")
+	if err != nil {
+		if gitHealthy(dir) {
+			return
+		}
+
+		fmt.Println(boldRedFgBlackBg(arrow+" Warning:"),
+			blackBg(name+" clone is corrupted -- cloning again"))
+		return true, gitClone(url, path, name)
+	}
+
+	return false, nil
+}
+
+// gitClone clones url into path+name replacing anything already there.
+func gitClone(url string, path string, name string) (err error) {
+	err = os.RemoveAll(path + name)
+	if err != nil {
+		return
+	}
+
+	err = os.MkdirAll(path, 0755)
+	if err != nil {
+		return
+	}
+
+	return passToGit(path, "clone", "--no-progress", url, name)
+}
+
+// gitHealthy checks that the clone in dir is usable, cleaning up after any
+// merge or rebase that was interrupted so no conflict markers are left in
+// the working tree.
+func gitHealthy(dir string) bool {
+	if gitCommand(dir, "rev-parse", "--verify", "--quiet", "HEAD").Run() != nil {
+		return false
+	}
+
+	if gitCommand(dir, "fsck", "--no-progress", "--connectivity-only").Run() != nil {
+		return false
+	}
+
+	for _, state := range []string{"rebase-merge", "rebase-apply"} {
+		if _, err := os.Stat(dir + ".git/" + state); err == nil {
+			gitCommand(dir, "rebase", "--abort").Run()
+		}
+	}
+
+	if _, err := os.Stat(dir + ".git/MERGE_HEAD"); err == nil {
+		gitCommand(dir, "merge", "--abort").Run()
+	}
+
+	unmerged, err := gitCommand(dir, "ls-files", "--unmerged").Output()
+	if err != nil {
+		return false
+	}
+	if len(unmerged) > 0 {
+		return gitCommand(dir, "reset", "--quiet", "--hard", "HEAD").Run() == nil
+	}
+
+	return true
+}
+
+// gitUpstream is the branch AUR repositories are published on.
+const gitUpstream = "origin/master"
+
+// gitIdent lets yay stash changes even if the user has no git identity.
+var gitIdent = []string{"-c", "user.name=yay", "-c", "user.email=yay@localhost"}
+
+// updateCheckout moves the checkout in dir to the fetched upstream commit.
+// If the user modified the checkout they are asked what to do instead of
+// having their changes discarded.
+func updateCheckout(name string, dir string) error {
+	head, err := gitCommand(dir, "rev-parse", "HEAD").Output()
+	if err != nil {
+		return err
+	}
+	upstream, err := gitCommand(dir, "rev-parse", gitUpstream).Output()
+	if err != nil {
+		return err
+	}
+
+	if string(head) == string(upstream) {
+		return nil
+	}
+
+	if !gitModified(dir) {
+		return passToGit(dir, "reset", "--quiet", "--hard", gitUpstream)
+	}
+
+	fmt.Println(boldRedFgBlackBg(arrow+" Warning:"),
+		blackBg(name+" has local modifications and was updated upstream"))
+
+	if skipPrompt("checkout") {
+		if gitRebaseChanges(dir, strings.TrimSpace(string(head))) {
+			fmt.Println(boldGreenFg(arrow), boldFg("Moved local changes of "+name+" onto upstream"))
+			return nil
+		}
+
+		fmt.Println(boldGreenFg(arrow), boldFg("Local changes of "+name+" conflict -- keeping local version"))
+		return nil
+	}
+
+	for {
+		fmt.Print(boldGreenFg(arrow + " [R]ebase mine onto upstream, [K]eep mine, [T]ake upstream, [V]iew diff: "))
+
+		response, answered := answer("checkout")
+		if !answered {
+			fmt.Scanln(&response)
+		}
+
+		switch strings.ToLower(response) {
+		case "r", "":
+			if gitRebaseChanges(dir, strings.TrimSpace(string(head))) {
+				return nil
+			}
+			fmt.Println(redFg("Local changes conflict with upstream -- nothing was changed"))
+		case "k":
+			return nil
+		case "t":
+			return passToGit(dir, "reset", "--quiet", "--hard", gitUpstream)
+		case "v":
+			fmt.Println(boldCyanFg("::"), boldFg("Upstream changes:"))
+			passToGit(dir, "--no-pager", "diff", "HEAD", gitUpstream)
+			fmt.Println(boldCyanFg("::"), boldFg("Your changes:"))
+			passToGit(dir, "--no-pager", "diff", "HEAD")
+		}
+
+		// the answers file would give the same answer again
+		if answered {
+			fmt.Println(boldGreenFg(arrow), boldFg("Keeping local version of "+name))
+			return nil
+		}
+	}
+}
+
+// gitRebaseChanges carries the uncommitted changes in dir over to the
+// upstream commit. If they do not apply cleanly the checkout is restored
+// to head with the changes intact and false is returned.
+func gitRebaseChanges(dir string, head string) bool {
+	stash := append(gitIdent, "stash", "push", "--quiet")
+	if gitCommand(dir, stash...).Run() != nil {
+		return false
+	}
+
+	if gitCommand(dir, "reset", "--quiet", "--hard", gitUpstream).Run() == nil &&
+		gitCommand(dir, "stash", "apply", "--quiet").Run() == nil {
+		gitCommand(dir, "stash", "drop", "--quiet").Run()
+		return true
+	}
+
+	// the stash was made on top of head so it always applies there
+	gitCommand(dir, "reset", "--quiet", "--hard", head).Run()
+	gitCommand(dir, "stash", "pop", "--quiet").Run()
+	return false
+}
+
+// gitModified reports whether tracked files in dir differ from HEAD.
+func gitModified(dir string) bool {
+	return gitCommand(dir, "diff", "--quiet", "HEAD").Run() != nil
 }
 
 func getPkgbuild(pkg string) (err error) {
@@ -70,8 +258,8 @@ func getPkgbuild(pkg string) (err error) {
 	}
 	wd = wd + "/"
 
-	err = getPkgbuildfromABS(pkg, wd)
-	if err == nil {
+	found, err := getPkgbuildfromRepo(pkg, wd)
+	if found {
 		return
 	}
 
@@ -79,35 +267,93 @@ func getPkgbuild(pkg string) (err error) {
 	return
 }
 
-// GetPkgbuild downloads pkgbuild from the ABS.
-func getPkgbuildfromABS(pkgN string, path string) (err error) {
+// archPackagingURL is where the packaging of the official repo packages
+// is kept, one git repository per pkgbase.
+const archPackagingURL = "https://gitlab.archlinux.org/archlinux/packaging/packages/"
+
+var (
+	gitlabInvalidRegex = regexp.MustCompile(`[^a-zA-Z0-9_\-.]`)
+	gitlabRepeatRegex  = regexp.MustCompile(`[_\-]{2,}`)
+)
+
+// gitlabProjectPath returns the name of the packaging repository of
+// pkgbase, which GitLab restricts to fewer characters than package names.
+func gitlabProjectPath(pkgbase string) string {
+	if pkgbase == "tree" {
+		return "unix-tree"
+	}
+
+	path := strings.Replace(pkgbase, "+", "plus", -1)
+	path = gitlabInvalidRegex.ReplaceAllString(path, "-")
+	return gitlabRepeatRegex.ReplaceAllString(path, "-")
+}
+
+// repoPkgbase returns the pkgbase of the repo package target, like
+// extra/foo.
+func repoPkgbase(target string) (string, error) {
+	args := makeArguments()
+	args.op = "S"
+	args.addArg("p", "d", "d")
+	args.addParam("print-format", "%e")
+	args.addTarget(target)
+
+	output, err := pacmanOutput(args)
+	if err != nil {
+		return "", err
+	}
+
+	base := strings.TrimSpace(output)
+	if base == "" || strings.Contains(base, "\n") {
+		return "", fmt.Errorf("Could not find the pkgbase of %s", target)
+	}
+
+	return base, nil
+}
+
+// getPkgbuildfromRepo clones the packaging of the official repo package
+// pkgN into path. found reports whether a sync database has pkgN, in
+// which case the AUR is not worth asking.
+func getPkgbuildfromRepo(pkgN string, path string) (found bool, err error) {
 	dbList, err := alpmHandle.SyncDbs()
 	if err != nil {
 		return
 	}
 
 	for _, db := range dbList.Slice() {
-		pkg, err := db.PkgByName(pkgN)
-		if err == nil {
-			var url string
-			if db.Name() == "core" || db.Name() == "extra" {
-				url = "https://projects.archlinux.org/svntogit/packages.git/snapshot/packages/" + pkg.Name() + ".tar.gz"
-			} else if db.Name() == "community" {
-				url = "https://projects.archlinux.org/svntogit/community.git/snapshot/community-packages/" + pkg.Name() + ".tar.gz"
-			} else {
-				return fmt.Errorf("Not in standard repositories")
-			}
-			fmt.Println(boldGreenFg(arrow), boldYellowFg(pkgN), boldGreenFg("found in ABS."))
-			errD := downloadAndUnpack(url, path, true)
-			return errD
+		if _, err := db.PkgByName(pkgN); err != nil {
+			continue
+		}
+
+		// packages of other repos have no packaging to clone, the AUR may
+		// still have a PKGBUILD for them
+		distro := currentDistro()
+		if !distro.archRepos.get(db.Name()) {
+			continue
+		}
+		if distro.delayed {
+			fmt.Println(boldRedFgBlackBg(arrow+" Warning:"),
+				blackBg("The packaging of Arch Linux may be newer than the "+pkgN+" of "+distro.name))
+		}
+
+		base, err := repoPkgbase(db.Name() + "/" + pkgN)
+		if err != nil {
+			return true, err
 		}
+
+		fmt.Println(boldGreenFg(arrow), boldYellowFg(pkgN), boldGreenFg("found in "+db.Name()+"."))
+		if _, err := os.Stat(path + base); err == nil {
+			return true, fmt.Errorf("%s already exists", path+base)
+		}
+
+		return true, passToGit(path, "clone", "--no-progress", archPackagingURL+gitlabProjectPath(base)+".git", base)
 	}
-	return fmt.Errorf("package not found")
+
+	return false, fmt.Errorf("package not found")
 }
 
 // GetPkgbuild downloads pkgbuild from the AUR.
 func getPkgbuildfromAUR(pkgN string, dir string) (err error) {
-	aq, err := rpc.Info([]string{pkgN})
+	aq, err := aurInfo([]string{pkgN})
 	if err != nil {
 		return err
 	}
@@ -117,6 +363,87 @@ func getPkgbuildfromAUR(pkgN string, dir string) (err error) {
 	}
 
 	fmt.Println(boldGreenFg(arrow), boldYellowFg(pkgN), boldGreenFg("found in AUR."))
-	downloadAndUnpack(baseURL+aq[0].URLPath, dir, false)
+	downloadAndUnpack(config.AURURL+aq[0].URLPath, dir)
 	return
 }
+
+// srcdest is the SRCDEST makepkg downloads sources to, empty when unset.
+var (
+	srcdest     string
+	srcdestOnce sync.Once
+)
+
+// makepkgConfVar reads the makepkg.conf variable name the way makepkg
+// does: the environment takes precedence over makepkg.conf, its drop-in
+// directory and the per-user configuration, read in that order.
+func makepkgConfVar(name string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+
+	conf := config.MakepkgConf
+	if conf == "" {
+		conf = "/etc/makepkg.conf"
+	}
+
+	script := fmt.Sprintf(`source %s
+for conf in %s/*.conf; do [[ -f $conf ]] && source "$conf"; done
+userconf=${XDG_CONFIG_HOME:-$HOME/.config}/pacman/makepkg.conf
+[[ -r $userconf ]] || userconf=$HOME/.makepkg.conf
+[[ -r $userconf ]] && source "$userconf"
+printf '%%s' "$%s"`, shellQuote(conf), shellQuote(conf+".d"), name)
+
+	out, err := exec.Command("bash", "-c", script).Output()
+	if err != nil {
+		return ""
+	}
+
+	return strings.TrimSpace(string(out))
+}
+
+// sourceDest returns the directory makepkg keeps the sources of pkgbase
+// in: the SRCDEST it is configured with, or else the build directory.
+func sourceDest(pkgbase string) string {
+	srcdestOnce.Do(func() {
+		srcdest = makepkgConfVar("SRCDEST")
+	})
+
+	if srcdest != "" {
+		return strings.TrimSuffix(srcdest, "/") + "/"
+	}
+
+	return config.BuildDir + pkgbase + "/"
+}
+
+// prepareShallowSources creates shallow mirrors of the git sources of pkgs
+// where makepkg expects its own clones. makepkg then only fetches into them
+// instead of cloning the full history.
+func prepareShallowSources(pkgs []*rpc.Pkg, srcinfos map[string]*gopkg.PKGBUILD) {
+	for _, pkg := range pkgs {
+		srcinfo, ok := srcinfos[pkg.PackageBase]
+		if !ok {
+			continue
+		}
+
+		dest := sourceDest(pkg.PackageBase)
+
+		for _, source := range srcinfo.Source {
+			src, ok := parseGitSource(source)
+			if !ok {
+				continue
+			}
+
+			if _, err := os.Stat(dest + src.name); err == nil {
+				continue
+			}
+
+			fmt.Println(boldGreenFg(arrow), boldFg("Shallow cloning "+src.name+" for "+pkg.PackageBase))
+			err := passToGit(dest, "clone", "--no-progress", "--mirror", "--depth", "1", src.url, src.name)
+			if err != nil {
+				// makepkg will fall back to a full clone
+				fmt.Println(err)
+				os.RemoveAll(dest + src.name)
+			}
+		}
+	}
+}
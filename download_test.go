@@ -0,0 +1,57 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestGitlabProjectPath(t *testing.T) {
+	for pkgbase, expected := range map[string]string{
+		"pacman":      "pacman",
+		"libsigc++":   "libsigcplusplus",
+		"gtk2+extra":  "gtk2plusextra",
+		"tree":        "unix-tree",
+		"foo@bar":     "foo-bar",
+		"perl-_-test": "perl-test",
+	} {
+		if path := gitlabProjectPath(pkgbase); path != expected {
+			t.Errorf("Expected %s to be at %q, found %q", pkgbase, expected, path)
+		}
+	}
+}
+
+func TestMakepkgConfVar(t *testing.T) {
+	dir, err := ioutil.TempDir("", "yay-srcdest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	oldConf := config.MakepkgConf
+	defer func() {
+		config.MakepkgConf = oldConf
+	}()
+	for _, name := range []string{"SRCDEST", "HOME", "XDG_CONFIG_HOME"} {
+		defer os.Setenv(name, os.Getenv(name))
+	}
+	os.Unsetenv("SRCDEST")
+	os.Setenv("HOME", dir)
+	os.Setenv("XDG_CONFIG_HOME", dir+"/.config")
+
+	config.MakepkgConf = dir + "/makepkg.conf"
+	ioutil.WriteFile(config.MakepkgConf, []byte("SRCDEST=/srv/sources\n"), 0644)
+	if dest := makepkgConfVar("SRCDEST"); dest != "/srv/sources" {
+		t.Errorf("Expected the SRCDEST of makepkg.conf, found %q", dest)
+	}
+
+	ioutil.WriteFile(dir+"/.makepkg.conf", []byte("SRCDEST=/home/sources\n"), 0644)
+	if dest := makepkgConfVar("SRCDEST"); dest != "/home/sources" {
+		t.Errorf("Expected the SRCDEST of the user configuration, found %q", dest)
+	}
+
+	os.Setenv("SRCDEST", "/tmp/sources")
+	if dest := makepkgConfVar("SRCDEST"); dest != "/tmp/sources" {
+		t.Errorf("Expected the SRCDEST of the environment, found %q", dest)
+	}
+}
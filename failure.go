@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// basesFailedError reports the pkgbases a step of an install failed for.
+// Depending on config.OnFailure the install can go on without them.
+type basesFailedError struct {
+	step  string
+	bases []string
+}
+
+func (e *basesFailedError) Error() string {
+	return fmt.Sprintf("%s failed for: %s", e.step, strings.Join(e.bases, " "))
+}
+
+// skipFailures decides following config.OnFailure whether to go on without
+// names after step failed for them.
+func skipFailures(step string, names []string) bool {
+	list := strings.Join(names, " ")
+
+	switch config.OnFailure {
+	case OnFailureSkip:
+		fmt.Println(boldGreenFg(arrow), boldFg("Skipping "+list+" and going on"))
+		return true
+	case OnFailureAsk:
+		return !continueTask("skipfailed", step+" failed for "+list+
+			". Skip and go on with the packages that do not need it?", "yY")
+	default:
+		return false
+	}
+}
+
+// dropFailedBases goes on without the pkgbases err reports as failed, and
+// the ones needing them, if config.OnFailure allows it. Otherwise err is
+// returned as is.
+func dropFailedBases(dc *depCatagories, err error) error {
+	failed, ok := err.(*basesFailedError)
+	if !ok || !skipFailures(failed.step, failed.bases) {
+		return err
+	}
+
+	set := make(stringSet)
+	for _, base := range failed.bases {
+		set.set(base)
+	}
+	dropBases(dc, set, strings.ToLower(failed.step)+" failed")
+
+	return nil
+}
+
+// dropBases leaves the pkgbases in failed out of dc, together with the
+// pkgbases that need them.
+func dropBases(dc *depCatagories, failed stringSet, reason string) {
+	deps := baseDeps(dc.Bases)
+
+	// dc.Aur is in build order, dependencies are seen first
+	pkgs := dc.Aur[:0]
+	for _, pkg := range dc.Aur {
+		base := pkg.PackageBase
+		if failed.get(base) {
+			runSummary.skippedPkg(base, reason)
+		} else if dep := failedDep(deps[base], failed); dep != "" {
+			printSkippedDependent(base, dep)
+			failed.set(base)
+		} else {
+			pkgs = append(pkgs, pkg)
+			continue
+		}
+
+		delete(dc.Bases, base)
+	}
+
+	dc.Aur = pkgs
+}
+
+// missingDepBases returns the pkgbases of dc with a dependency that could
+// not be found.
+func missingDepBases(dc *depCatagories, missing stringSet) []string {
+	names := make(stringSet)
+	for dep := range missing {
+		names.set(getNameFromDep(dep))
+	}
+
+	var bases []string
+	for _, pkg := range dc.Aur {
+	splits:
+		for _, split := range dc.Bases[pkg.PackageBase] {
+			for _, deps := range [2][]string{split.Depends, split.MakeDepends} {
+				for _, dep := range deps {
+					if names.get(getNameFromDep(dep)) {
+						bases = append(bases, pkg.PackageBase)
+						break splits
+					}
+				}
+			}
+		}
+	}
+
+	return bases
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	rpc "github.com/mikkeloscar/aur"
+)
+
+func TestDropBases(t *testing.T) {
+	a := &rpc.Pkg{Name: "a", PackageBase: "a", Depends: []string{"libfoo>=2"}}
+	b := &rpc.Pkg{Name: "b", PackageBase: "b", MakeDepends: []string{"a"}}
+	c := &rpc.Pkg{Name: "c", PackageBase: "c"}
+
+	dc := makeDependCatagories()
+	dc.Aur = []*rpc.Pkg{a, b, c}
+	for _, pkg := range dc.Aur {
+		addBaseSplit(dc, pkg)
+	}
+
+	missing := make(stringSet)
+	missing.set("libfoo>=2")
+	failed := missingDepBases(dc, missing)
+	if !reflect.DeepEqual(failed, []string{"a"}) {
+		t.Fatalf("Expected a to miss a dependency, found %v", failed)
+	}
+
+	set := make(stringSet)
+	set.set("a")
+	dropBases(dc, set, "dependencies not found")
+
+	if len(dc.Aur) != 1 || dc.Aur[0] != c {
+		t.Errorf("Expected only c to be left, found %v", dc.Aur)
+	}
+	if _, ok := dc.Bases["b"]; ok {
+		t.Errorf("Expected b to be dropped as it needs a")
+	}
+}
+
+func TestSkipAurBase(t *testing.T) {
+	a := &rpc.Pkg{Name: "a", PackageBase: "a"}
+	b := &rpc.Pkg{Name: "b", PackageBase: "b", Depends: []string{"a"}}
+	c := &rpc.Pkg{Name: "c", PackageBase: "c", MakeDepends: []string{"b"}}
+	d := &rpc.Pkg{Name: "d", PackageBase: "d"}
+
+	dc := makeDependCatagories()
+	dc.Aur = []*rpc.Pkg{a, b, c, d}
+	for _, pkg := range dc.Aur {
+		addBaseSplit(dc, pkg)
+	}
+
+	skipAurBase(dc, "a", "ignored")
+	if len(dc.Aur) != 1 || dc.Aur[0] != d {
+		t.Errorf("Expected only d to be left, found %v", dc.Aur)
+	}
+	if len(dc.Bases) != 1 {
+		t.Errorf("Expected the bases needing a to be dropped, found %v", dc.Bases)
+	}
+}
+
+func TestSkipFailures(t *testing.T) {
+	old := config
+	defer func() { config = old }()
+	oldAnswers := answers
+	defer func() { answers = oldAnswers }()
+
+	config.OnFailure = OnFailureAsk
+	config.NoConfirm = false
+
+	answers = map[string]string{"skipfailed": "y"}
+	if !skipFailures("Building", []string{"a"}) {
+		t.Errorf("Expected answering y to skip a")
+	}
+
+	answers = map[string]string{"skipfailed": "n"}
+	if skipFailures("Building", []string{"a"}) {
+		t.Errorf("Expected answering n to abort")
+	}
+
+	answers = nil
+	config.NoConfirm = true
+	if skipFailures("Building", []string{"a"}) {
+		t.Errorf("Expected --noconfirm to abort")
+	}
+
+	config.OnFailure = OnFailureSkip
+	if !skipFailures("Building", []string{"a"}) {
+		t.Errorf("Expected onfailure skip to skip a")
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+// groupMembers returns the repo and AUR members of the group name. Repo
+// members shadow AUR packages of the same name.
+func groupMembers(name string) (repo []string, aur []string, err error) {
+	dbList, err := alpmHandle.SyncDbs()
+	if err != nil {
+		return
+	}
+
+	seen := make(stringSet)
+	if pkgs, errGroup := dbList.PkgCachebyGroup(name); errGroup == nil {
+		for _, pkg := range pkgs.Slice() {
+			if !seen.get(pkg.Name()) {
+				seen.set(pkg.Name())
+				repo = append(repo, pkg.Name())
+			}
+		}
+	}
+
+	results, errAur := aurSearchBy("groups", name)
+	if errAur != nil {
+		fmt.Println(boldRedFgBlackBg(arrow+" Warning:"),
+			blackBg("Unable to list AUR members of "+name+": "+errAur.Error()))
+	}
+	for _, pkg := range results {
+		if !seen.get(pkg.Name) {
+			seen.set(pkg.Name)
+			aur = append(aur, pkg.Name)
+		}
+	}
+
+	sort.Strings(aur)
+	return
+}
+
+// isGroup reports whether name is a repo group rather than a package.
+func isGroup(name string) bool {
+	dbList, err := alpmHandle.SyncDbs()
+	if err != nil {
+		return false
+	}
+
+	if _, err := dbList.FindSatisfier(name); err == nil {
+		return false
+	}
+
+	pkgs, err := dbList.PkgCachebyGroup(name)
+	return err == nil && len(pkgs.Slice()) > 0
+}
+
+// selectGroupMembers asks which members of the group name to install.
+// Like pacman, all repo members are picked if nothing is typed, while AUR
+// members have to be picked explicitly.
+func selectGroupMembers(name string, repoMembers []string, aurMembers []string) (repo []string, aur []string, err error) {
+	if skipPrompt("group") {
+		if len(aurMembers) > 0 {
+			fmt.Println(boldRedFgBlackBg(arrow+" Warning:"),
+				blackBg("Not installing the AUR members of "+name+", they have to be picked explicitly"))
+		}
+		return repoMembers, nil, nil
+	}
+
+	fmt.Println(boldCyanFg("::"), boldFg("There are "+strconv.Itoa(len(repoMembers)+len(aurMembers))+
+		" members in group "+name+":"))
+	n := 1
+	for _, member := range repoMembers {
+		fmt.Println(yellowFg(fmt.Sprintf("%3d ", n)) + boldWhiteFg("repo/") + member)
+		n++
+	}
+	for _, member := range aurMembers {
+		fmt.Println(yellowFg(fmt.Sprintf("%3d ", n)) + boldWhiteFg("aur/") + member)
+		n++
+	}
+
+	fmt.Println(greenFg("Enter a selection, default all repo members."))
+	menu, err := readNumberMenu("group", ", repo, aur, all, none or abort")
+	if err != nil {
+		return
+	}
+
+	if menu.otherInclude.get("abort") {
+		err = fmt.Errorf("Aborting due to user")
+		return
+	}
+
+	total := len(repoMembers) + len(aurMembers)
+	if len(menu.include) == 0 && len(menu.exclude) == 0 &&
+		len(menu.otherInclude) == 0 && len(menu.otherExclude) == 0 {
+		menu.include = append(menu.include, intRange{1, len(repoMembers)})
+	}
+	menu.addKeyword("all", 1, total)
+	menu.addKeyword("repo", 1, len(repoMembers))
+	menu.addKeyword("aur", len(repoMembers)+1, total)
+
+	for i, member := range repoMembers {
+		if menu.selected(i + 1) {
+			repo = append(repo, member)
+		}
+	}
+	for i, member := range aurMembers {
+		if menu.selected(len(repoMembers) + i + 1) {
+			aur = append(aur, member)
+		}
+	}
+
+	return
+}
+
+// expandGroups replaces the groups among repo targets by the members the
+// user picks. Missing targets that are groups of AUR packages only are
+// expanded too.
+func expandGroups(repos []string, aurs []string, missing []string) ([]string, []string, []string, error) {
+	newRepos := make([]string, 0, len(repos))
+	for _, target := range repos {
+		if !isGroup(target) {
+			newRepos = append(newRepos, target)
+			continue
+		}
+
+		repoMembers, aurMembers, err := groupMembers(target)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+
+		repo, aur, err := selectGroupMembers(target, repoMembers, aurMembers)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		newRepos = append(newRepos, repo...)
+		aurs = append(aurs, aur...)
+	}
+
+	newMissing := make([]string, 0, len(missing))
+	for _, target := range missing {
+		_, aurMembers, _ := groupMembers(target)
+		if len(aurMembers) == 0 {
+			newMissing = append(newMissing, target)
+			continue
+		}
+
+		_, aur, err := selectGroupMembers(target, nil, aurMembers)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		aurs = append(aurs, aur...)
+	}
+
+	return newRepos, aurs, newMissing, nil
+}
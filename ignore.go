@@ -0,0 +1,206 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+	"time"
+
+	alpm "github.com/jguer/go-alpm"
+	rpc "github.com/mikkeloscar/aur"
+)
+
+// splitIgnore splits the values given to --ignore or --ignoregroup.
+func splitIgnore(value string) []string {
+	return strings.FieldsFunc(value, func(c rune) bool {
+		return c == ',' || c == '\n'
+	})
+}
+
+// matchIgnore reports whether name matches one of the glob patterns of
+// IgnorePkg or IgnoreGroup, the way pacman matches them.
+func matchIgnore(name string, patterns []string) bool {
+	ignored := false
+
+	for _, pattern := range patterns {
+		// a leading ! negates the pattern, the last match wins
+		negate := strings.HasPrefix(pattern, "!")
+		if matched, _ := path.Match(strings.TrimPrefix(pattern, "!"), name); matched {
+			ignored = !negate
+		}
+	}
+
+	return ignored
+}
+
+// aurGroups holds the groups of the AUR packages whose .SRCINFO was read
+// during dependency resolution, as the RPC does not report them.
+var aurGroups = make(map[string][]string)
+
+// aurIgnored reports whether pkg is ignored through IgnorePkg or
+// IgnoreGroup.
+func aurIgnored(pkg *rpc.Pkg) bool {
+	if matchIgnore(pkg.Name, alpmConf.IgnorePkg) {
+		return true
+	}
+
+	for _, group := range aurGroups[pkg.Name] {
+		if matchIgnore(group, alpmConf.IgnoreGroup) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// checkIgnoredAur asks whether to install the AUR packages of dc that are
+// ignored in pacman.conf or by --ignore, as pacman does for repo packages.
+// Declined packages are dropped along with their pkgbase and the pkgbases
+// needing it.
+func checkIgnoredAur(dc *depCatagories) error {
+	for _, base := range append([]*rpc.Pkg{}, dc.Aur...) {
+		for _, pkg := range dc.Bases[base.PackageBase] {
+			if !aurIgnored(pkg) {
+				continue
+			}
+
+			if continueTask("ignored", pkg.Name+" is in IgnorePkg/IgnoreGroup. Install anyway?", "nN") {
+				continue
+			}
+
+			fmt.Println(boldGreenFg(arrow), "Skipping", boldFg(base.PackageBase))
+			skipAurBase(dc, base.PackageBase, "ignored")
+			break
+		}
+	}
+
+	return nil
+}
+
+// addIgnorePkg adds names to the IgnorePkg line of the [options] section
+// of the pacman.conf in content, creating the line if needed.
+func addIgnorePkg(content string, names []string) string {
+	lines := strings.Split(content, "\n")
+	section := ""
+
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "[") {
+			section = trimmed
+			continue
+		}
+
+		if section == "[options]" && strings.HasPrefix(trimmed, "IgnorePkg") {
+			if !strings.Contains(trimmed, "=") {
+				line += " ="
+			}
+			lines[i] = line + " " + strings.Join(names, " ")
+			return strings.Join(lines, "\n")
+		}
+	}
+
+	for i, line := range lines {
+		if strings.TrimSpace(line) == "[options]" {
+			entry := "IgnorePkg = " + strings.Join(names, " ")
+			lines = append(lines[:i+1], append([]string{entry}, lines[i+1:]...)...)
+			return strings.Join(lines, "\n")
+		}
+	}
+
+	return content + "\n[options]\nIgnorePkg = " + strings.Join(names, " ") + "\n"
+}
+
+// askIgnorePkg offers to add the packages left out of an upgrade to
+// IgnorePkg in pacman.conf so they are not offered again.
+func askIgnorePkg(names []string) {
+	if continueTask("addignore", "Add "+strings.Join(names, " ")+" to IgnorePkg?", "yY") {
+		return
+	}
+
+	content, err := ioutil.ReadFile(pacmanConf)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	// pacman.conf belongs to root
+	cmd := exec.Command("sudo", "tee", pacmanConf)
+	cmd.Stdin = strings.NewReader(addIgnorePkg(string(content), names))
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		fmt.Println("Unable to update", pacmanConf+":", err)
+		return
+	}
+
+	fmt.Println(boldGreenFg(arrow), boldFg("Added "+strings.Join(names, " ")+" to IgnorePkg"))
+}
+
+// ignoreDateFormat is the format of the expiry dates of ignoreRule.
+const ignoreDateFormat = "2006-01-02"
+
+// ignoreRule is an entry of yay's own ignore list, which applies to
+// upgrades from the repos and the AUR alike.
+type ignoreRule struct {
+	Pattern string `json:"pattern"`
+	Until   string `json:"until,omitempty"`
+}
+
+// parseIgnoreRule parses a glob optionally followed by =YYYY-MM-DD, the
+// last day it applies.
+func parseIgnoreRule(value string) (ignoreRule, error) {
+	rule := ignoreRule{Pattern: value}
+
+	if i := strings.Index(value, "="); i != -1 {
+		rule.Pattern, rule.Until = value[:i], value[i+1:]
+		if _, err := time.Parse(ignoreDateFormat, rule.Until); err != nil {
+			return rule, fmt.Errorf("Invalid expiry date %s, expected YYYY-MM-DD", rule.Until)
+		}
+	}
+
+	if _, err := path.Match(rule.Pattern, ""); err != nil || rule.Pattern == "" {
+		return rule, fmt.Errorf("Invalid ignore pattern %s", rule.Pattern)
+	}
+
+	return rule, nil
+}
+
+// expired reports whether the rule no longer applies at now.
+func (rule ignoreRule) expired(now time.Time) bool {
+	if rule.Until == "" {
+		return false
+	}
+
+	until, err := time.ParseInLocation(ignoreDateFormat, rule.Until, time.Local)
+	if err != nil {
+		return true
+	}
+
+	return !now.Before(until.AddDate(0, 0, 1))
+}
+
+// yayIgnored reports whether name matches a rule of yay's ignore list that
+// has not expired.
+func yayIgnored(name string) bool {
+	now := time.Now()
+
+	for _, rule := range config.Ignore {
+		if rule.expired(now) {
+			continue
+		}
+
+		if matched, _ := path.Match(rule.Pattern, name); matched {
+			return true
+		}
+	}
+
+	return false
+}
+
+// shouldIgnore reports whether upgrades of pkg are ignored through
+// pacman.conf, --ignore or yay's ignore list.
+func shouldIgnore(pkg alpm.Package) bool {
+	return pkg.ShouldIgnore() || yayIgnored(pkg.Name())
+}
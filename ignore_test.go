@@ -0,0 +1,81 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMatchIgnore(t *testing.T) {
+	patterns := []string{"linux*", "!linux-firmware", "yay-git"}
+
+	names := map[string]bool{
+		"linux":          true,
+		"linux-zen":      true,
+		"linux-firmware": false,
+		"yay-git":        true,
+		"yay":            false,
+	}
+
+	for name, expected := range names {
+		if matchIgnore(name, patterns) != expected {
+			t.Errorf("Expected %s ignored to be %v", name, expected)
+		}
+	}
+}
+
+func TestSplitIgnore(t *testing.T) {
+	values := splitIgnore("foo,bar\nbaz")
+	if len(values) != 3 || values[0] != "foo" || values[2] != "baz" {
+		t.Errorf("Expected foo bar baz, found %v", values)
+	}
+}
+
+func TestAddIgnorePkg(t *testing.T) {
+	confs := []struct {
+		content  string
+		expected string
+	}{
+		{
+			"[options]\nIgnorePkg = foo\n[core]\n",
+			"[options]\nIgnorePkg = foo bar baz\n[core]\n",
+		},
+		{
+			"[options]\n#IgnorePkg   =\nArchitecture = auto\n",
+			"[options]\nIgnorePkg = bar baz\n#IgnorePkg   =\nArchitecture = auto\n",
+		},
+		{
+			"[core]\nIgnorePkg = foo\n[options]\n",
+			"[core]\nIgnorePkg = foo\n[options]\nIgnorePkg = bar baz\n",
+		},
+	}
+
+	for _, conf := range confs {
+		content := addIgnorePkg(conf.content, []string{"bar", "baz"})
+		if content != conf.expected {
+			t.Errorf("Expected %q, found %q", conf.expected, content)
+		}
+	}
+}
+
+func TestIgnoreRule(t *testing.T) {
+	rule, err := parseIgnoreRule("linux-*=2026-03-01")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if rule.Pattern != "linux-*" || rule.Until != "2026-03-01" {
+		t.Errorf("Expected linux-* until 2026-03-01, found %+v", rule)
+	}
+
+	day := time.Date(2026, 3, 1, 23, 0, 0, 0, time.Local)
+	if rule.expired(day) {
+		t.Errorf("Expected rule to apply on its last day")
+	}
+	if !rule.expired(day.Add(2 * time.Hour)) {
+		t.Errorf("Expected rule to expire the day after")
+	}
+
+	if _, err := parseIgnoreRule("foo=tomorrow"); err == nil {
+		t.Errorf("Expected an invalid date to be rejected")
+	}
+}
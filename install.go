@@ -2,28 +2,58 @@ package main
 
 import (
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"os/exec"
-	"strings"
+	"path/filepath"
 	"strconv"
+	"strings"
+	"time"
 
 	alpm "github.com/jguer/go-alpm"
 	rpc "github.com/mikkeloscar/aur"
 	gopkg "github.com/mikkeloscar/gopkgbuild"
 )
 
-// Install handles package installs
-func install(parser *arguments) error {
+// Install handles package installs. When skipMissing is set, as for the
+// targets of a package list on stdin or a manifest, the names found neither
+// in the repos nor the AUR are reported together with what is installed
+// instead.
+func install(parser *arguments, skipMissing bool) error {
 	aurs, repos, missing, err := packageSlices(parser.targets.toSlice())
 	srcinfos := make(map[string]*gopkg.PKGBUILD)
+	oldSrcinfos := make(map[string]*gopkg.PKGBUILD)
+	if err != nil {
+		return err
+	}
+
+	repos, aurs, missing, err = expandGroups(repos, aurs, missing)
 	if err != nil {
 		return err
 	}
 
-	if len(missing) > 0 {
+	if crossArch != "" {
+		err = checkCrossBuild(repos)
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(missing) > 0 && !skipMissing {
 		fmt.Println(missing)
 		fmt.Println("Could not find all Targets")
+	} else if len(missing) > 0 {
+		set := make(stringSet)
+		for _, pkg := range missing {
+			set.set(pkg)
+		}
+		printMissing(set)
+
+		if len(aurs) == 0 && len(repos) == 0 {
+			return fmt.Errorf("Nothing to install")
+		}
+		fmt.Println("Installing the", len(aurs)+len(repos), "packages that were found")
 	}
 
 	arguments := parser.copy()
@@ -41,6 +71,9 @@ func install(parser *arguments) error {
 	}
 
 	if len(aurs) != 0 {
+		warnOldDatabases()
+		warnDelayedBranch()
+
 		//todo mamakeke pretty
 		fmt.Println(greenFg(arrow), greenFg("Resolving Dependencies"))
 
@@ -49,9 +82,11 @@ func install(parser *arguments) error {
 			return err
 		}
 
-		if len(dt.Missing) > 0 {
-			fmt.Println(dt.Missing)
-			return fmt.Errorf("Could not find all Deps")
+		for cycle := findAurCycle(dt); cycle != nil; cycle = findAurCycle(dt) {
+			err = breakAurCycle(cycle, dt)
+			if err != nil {
+				return err
+			}
 		}
 
 		dc, err := getDepCatagories(aurs, dt)
@@ -59,6 +94,27 @@ func install(parser *arguments) error {
 			return err
 		}
 
+		if len(dt.Missing) > 0 {
+			fmt.Println(dt.Missing)
+			printMissingSonames(dt.Missing)
+			failed := missingDepBases(dc, dt.Missing)
+			if len(failed) == 0 {
+				return fmt.Errorf("Could not find all Deps")
+			}
+
+			err = dropFailedBases(dc, &basesFailedError{"Resolving dependencies", failed})
+			if err != nil {
+				return fmt.Errorf("Could not find all Deps")
+			}
+		}
+
+		if resumedTransaction != nil {
+			skipInstalledBases(dc, resumedTransaction.Installed)
+		} else if tx, _ := loadTransaction(); tx != nil {
+			fmt.Println(boldRedFgBlackBg(arrow+" Warning:"),
+				blackBg("Going on replaces the interrupted transaction yay "+strings.Join(tx.Args, " ")+", see --resume"))
+		}
+
 		for _, pkg := range dc.Aur {
 			if pkg.Maintainer == "" {
 				fmt.Println(boldRedFgBlackBg(arrow+" Warning:"),
@@ -76,38 +132,60 @@ func install(parser *arguments) error {
 		//fmt.Println(dc.MakeOnly)
 		//fmt.Println(dc.AurSet)
 
+		prebuilt := askPrebuilt(dc)
+
 		printDepCatagories(dc)
 		fmt.Println()
 
-		if !arguments.existsArg("gendb") {
+		warnMemoryHungry(dc.Aur)
+
+		resolveSkipChecks(dc)
+
+		err = checkAurDeps(aurs, dc)
+		if err != nil {
+			return err
+		}
+
+		err = checkIgnoredAur(dc)
+		if err != nil {
+			return err
+		}
+
+		// nothing gets installed here by cross builds
+		if crossArch == "" {
 			err = checkForConflicts(dc)
 			if err != nil {
 				return err
 			}
 		}
 
-		askCleanBuilds(dc.Aur, dc.Bases)
+		err = askCleanBuilds(dc.Aur, dc.Bases)
+		if err != nil {
+			return err
+		}
 		fmt.Println()
 
-		if !continueTask("Proceed with install?", "nN") {
+		if !continueTask("install", "Proceed with install?", "nN") {
 			return fmt.Errorf("Aborting due to user")
 		}
+		beginTransaction(parser, dc.Aur)
 
 		// if !continueTask("Proceed with download?", "nN") {
 		// 	return fmt.Errorf("Aborting due to user")
 		// }	
 
-		err = dowloadPkgBuilds(dc.Aur, dc.Bases)
+		err = dropFailedBases(dc, dowloadPkgBuilds(dc.Aur, dc.Bases, oldSrcinfos))
 		if err != nil {
 			return err
 		}
 
-		err = askEditPkgBuilds(dc.Aur, dc.Bases)
+		err = askEditPkgBuilds(dc.Aur, dc.Bases, oldSrcinfos)
 		if err != nil {
 			return err
 		}
 
-		if len(dc.Repo) > 0 {
+		// cross builds get their repo dependencies in the container
+		if len(dc.Repo) > 0 && crossArch == "" {
 			arguments := parser.copy()
 			arguments.delArg("u", "sysupgrade")
 			arguments.delArg("y", "refresh")
@@ -127,21 +205,44 @@ func install(parser *arguments) error {
 			}
 		}
 
-		if arguments.existsArg("gendb") {
-			fmt.Println("GenDB finished. No packages were installed")
-			return nil
+		if len(prebuilt) > 0 {
+			err = installPrebuilt(prebuilt, parser)
+			if err != nil {
+				return err
+			}
 		}
 
 		// if !continueTask("Proceed with install?", "nN") {
 		// 	return fmt.Errorf("Aborting due to user")
 		// }
 
-		err = downloadPkgBuildsSources(dc.Aur)
+		err = parsesrcinfos(dc.Aur, srcinfos)
 		if err != nil {
 			return err
 		}
 
-		err = parsesrcinfos(dc.Aur, srcinfos)
+		err = checkPgpKeys(dc.Aur, srcinfos)
+		if err != nil {
+			return err
+		}
+
+		if preinstalledDeps() {
+			err = installBuildDeps(dc, dc.Aur, srcinfos, parser)
+			if err != nil {
+				return err
+			}
+		}
+
+		if config.ShallowClone {
+			prepareShallowSources(dc.Aur, srcinfos)
+		}
+
+		err = dropFailedBases(dc, downloadPkgBuildsSources(dc.Aur, srcinfos))
+		if err != nil {
+			return err
+		}
+
+		err = dropFailedBases(dc, checkIntegrity(dc.Aur, srcinfos))
 		if err != nil {
 			return err
 		}
@@ -150,9 +251,14 @@ func install(parser *arguments) error {
 		if err != nil {
 			return err
 		}
+		finishTransaction()
+
+		if crossArch != "" {
+			return nil
+		}
 
 		if len(dc.MakeOnly) > 0 {
-			if continueTask("Remove make dependencies?", "yY") {
+			if continueTask("removemake", "Remove make dependencies?", "yY") {
 				return nil
 			}
 
@@ -179,75 +285,204 @@ func install(parser *arguments) error {
 	return nil
 }
 
-func askCleanBuilds(pkgs []*rpc.Pkg, bases map[string][]*rpc.Pkg) {
+// baseString describes the pkgbase of pkg with the packages built from it.
+func baseString(pkg *rpc.Pkg, bases map[string][]*rpc.Pkg) string {
+	str := pkg.Name
+	if len(bases[pkg.PackageBase]) > 1 || pkg.PackageBase != pkg.Name {
+		str += " ("
+		for _, split := range bases[pkg.PackageBase] {
+			str += split.Name + " "
+		}
+		str = str[:len(str)-1] + ")"
+	}
+
+	return str
+}
+
+// warnOldDatabases warns about sync databases that were refreshed more
+// than DBMaxAge hours ago.
+func warnOldDatabases() {
+	if config.DBMaxAge == 0 {
+		return
+	}
+
+	maxAge := time.Duration(config.DBMaxAge) * time.Hour
+	old := make([]string, 0)
+	for _, repo := range alpmConf.Repos {
+		info, err := os.Stat(filepath.Join(alpmConf.DBPath, "sync", repo.Name+".db"))
+		if err != nil {
+			continue
+		}
+
+		if time.Since(info.ModTime()) > maxAge {
+			old = append(old, repo.Name)
+		}
+	}
+
+	if len(old) != 0 {
+		fmt.Println(boldRedFgBlackBg(arrow+" Warning:"),
+			blackBg("Databases older than "+strconv.Itoa(config.DBMaxAge)+" hours: "+strings.Join(old, " ")))
+		fmt.Println(boldRedFgBlackBg(arrow+" Warning:"),
+			blackBg("AUR packages may be built against outdated dependencies, consider -Syu"))
+	}
+}
+
+// printBaseMenu numbers pkgs for a menu read with readNumberMenu.
+func printBaseMenu(pkgs []*rpc.Pkg, bases map[string][]*rpc.Pkg) {
+	for i, pkg := range pkgs {
+		fmt.Print(yellowFg(fmt.Sprintf("%2d ", i+1)))
+		fmt.Println(boldWhiteFg(baseString(pkg, bases)))
+	}
+}
+
+func askCleanBuilds(pkgs []*rpc.Pkg, bases map[string][]*rpc.Pkg) error {
+	var existing []*rpc.Pkg
 	for _, pkg := range pkgs {
-		dir := config.BuildDir + pkg.PackageBase + "/"
+		if _, err := os.Stat(config.BuildDir + pkg.PackageBase); !os.IsNotExist(err) {
+			existing = append(existing, pkg)
+		}
+	}
 
-		if _, err := os.Stat(dir); !os.IsNotExist(err) {
-			str := pkg.Name
-			if len(bases[pkg.PackageBase]) > 1 || pkg.PackageBase != pkg.Name {
-				str += " ("
-				for _, split := range bases[pkg.PackageBase] {
-					str += split.Name + " "
-				}
-				str = str[:len(str)-1] + ")"
-			}
+	if len(existing) == 0 || skipPrompt("clean") {
+		return nil
+	}
 
-			if !continueTask(str+" Directory exists. Clean Build?", "yY") {
-				_ = os.RemoveAll(config.BuildDir + pkg.PackageBase)
-			}
+	fmt.Println(boldCyanFg("::"), boldFg("Build directories exist. Packages to clean build?"))
+	printBaseMenu(existing, bases)
+
+	menu, err := readNumberMenu("clean", ", all, none or abort")
+	if err != nil {
+		return err
+	}
+
+	if menu.otherInclude.get("abort") {
+		return fmt.Errorf("Aborting due to user")
+	}
+	menu.addKeyword("all", 1, len(existing))
+
+	for i, pkg := range existing {
+		if menu.selected(i + 1) {
+			_ = os.RemoveAll(config.BuildDir + pkg.PackageBase)
+		}
+	}
+
+	return nil
+}
+
+// conflict is a package about to be installed together with the installed
+// packages it conflicts with.
+type conflict struct {
+	name      string
+	base      string
+	installed stringSet
+}
+
+// installedConflicts returns the installed packages satisfying one of
+// conflicts, leaving out name itself and the packages installed with it.
+func installedConflicts(name string, conflicts []string, installing stringSet, localDb *alpm.Db) stringSet {
+	found := make(stringSet)
+
+	for _, c := range conflicts {
+		pkg, err := localDb.PkgCache().FindSatisfier(c)
+		if err != nil || pkg.Name() == name || installing.get(pkg.Name()) {
+			continue
 		}
+
+		found.set(pkg.Name())
 	}
+
+	return found
 }
 
+// checkForConflicts finds the installed packages that conflict with what is
+// about to be installed before anything is built, and lets the user remove
+// them, skip the conflicting target or abort.
 func checkForConflicts(dc *depCatagories) error {
 	localDb, err := alpmHandle.LocalDb()
 	if err != nil {
 		return err
 	}
-	toRemove := make(map[string]stringSet)
 
-	for _, pkg := range dc.Aur {
-		for _, cpkg := range pkg.Conflicts {
-			if _, err := localDb.PkgByName(cpkg); err == nil {
-				_, ok := toRemove[pkg.Name]
-				if !ok {
-					toRemove[pkg.Name] = make(stringSet)
-				}
-				toRemove[pkg.Name].set(cpkg)
+	installing := make(stringSet)
+	for _, pkgs := range dc.Bases {
+		for _, pkg := range pkgs {
+			installing.set(pkg.Name)
+		}
+	}
+	for _, pkg := range dc.Repo {
+		installing.set(pkg.Name())
+	}
+
+	var conflicts []conflict
+
+	for _, base := range dc.Aur {
+		for _, pkg := range dc.Bases[base.PackageBase] {
+			found := installedConflicts(pkg.Name, pkg.Conflicts, installing, localDb)
+			if len(found) > 0 {
+				conflicts = append(conflicts, conflict{pkg.Name, pkg.PackageBase, found})
 			}
 		}
 	}
 
 	for _, pkg := range dc.Repo {
+		var names []string
 		pkg.Conflicts().ForEach(func(conf alpm.Depend) error {
-			if _, err := localDb.PkgByName(conf.Name); err == nil {
-				_, ok := toRemove[pkg.Name()]
-				if !ok {
-					toRemove[pkg.Name()] = make(stringSet)
-				}
-				toRemove[pkg.Name()].set(conf.Name)
-			}
+			names = append(names, conf.String())
 			return nil
 		})
+
+		found := installedConflicts(pkg.Name(), names, installing, localDb)
+		if len(found) > 0 {
+			conflicts = append(conflicts, conflict{pkg.Name(), "", found})
+		}
 	}
 
-	if len(toRemove) != 0 {
-		fmt.Println(
-			redFg("Package conflicts found:"))
-		for name, pkgs := range toRemove {
-			str := yellowFg("\t" + name) + " Replaces"
-			for pkg := range pkgs {
-				str += " " + yellowFg(pkg)
-			}
+	if len(conflicts) == 0 {
+		return nil
+	}
+
+	fmt.Println(redFg("Package conflicts found:"))
+	for _, c := range conflicts {
+		str := yellowFg("\t"+c.name) + " Replaces"
+		for pkg := range c.installed {
+			str += " " + yellowFg(pkg)
+		}
+
+		fmt.Println(str)
+	}
+
+	remove := false
+	for _, c := range conflicts {
+		if skipPrompt("conflict") {
+			remove = true
+			break
+		}
+
+		if _, ok := dc.Bases[c.base]; c.base != "" && !ok {
+			// skipped along with another package of its base or a
+			// dependency
+			continue
+		}
 
-			fmt.Println(str)
+		fmt.Print(boldGreenFg(arrow + " " + c.name + ": [R]emove conflicting, [S]kip " + c.name + ", [A]bort: "))
+
+		response, ok := answer("conflict")
+		if !ok {
+			fmt.Scanln(&response)
 		}
 
-		if !continueTask("Continue with install?", "nN") {
+		switch strings.ToLower(response) {
+		case "s":
+			skipConflict(dc, c)
+		case "a":
 			return fmt.Errorf("Aborting due to user")
+		default:
+			remove = true
 		}
+	}
 
+	if remove {
+		// pacman removes the conflicting packages in the install transaction
 		ask, _ := strconv.Atoi(cmdArgs.globals["ask"])
 		uask := alpm.Question(ask) | alpm.QuestionConflictPkg
 		cmdArgs.globals["ask"] = fmt.Sprint(uask)
@@ -256,24 +491,132 @@ func checkForConflicts(dc *depCatagories) error {
 	return nil
 }
 
-func askEditPkgBuilds(pkgs []*rpc.Pkg, bases map[string][]*rpc.Pkg) error {
+// removeAurBase drops the pkgbase base from dc.
+func removeAurBase(dc *depCatagories, base string) {
+	for i, pkg := range dc.Aur {
+		if pkg.PackageBase == base {
+			dc.Aur = append(dc.Aur[:i], dc.Aur[i+1:]...)
+			break
+		}
+	}
+	delete(dc.Bases, base)
+}
+
+// skipAurBase drops the pkgbase base from dc, together with the pkgbases
+// that need it and cannot be built without it.
+func skipAurBase(dc *depCatagories, base string, reason string) {
+	dropBases(dc, stringSet{base: struct{}{}}, reason)
+}
+
+// skipConflict drops the target of c from dc. A skipped AUR package takes
+// its whole pkgbase along as it is built as one, and the pkgbases needing
+// it.
+func skipConflict(dc *depCatagories, c conflict) {
+	if c.base == "" {
+		for i, pkg := range dc.Repo {
+			if pkg.Name() == c.name {
+				dc.Repo = append(dc.Repo[:i], dc.Repo[i+1:]...)
+				break
+			}
+		}
+		return
+	}
+
+	skipAurBase(dc, c.base, "conflicts with installed packages")
+}
+
+func askEditPkgBuilds(pkgs []*rpc.Pkg, bases map[string][]*rpc.Pkg, oldSrcinfos map[string]*gopkg.PKGBUILD) error {
+	var toReview []*rpc.Pkg
+	maintainerChanges := make(stringSet)
+
 	for _, pkg := range pkgs {
 		dir := config.BuildDir + pkg.PackageBase + "/"
 
-		str := "Edit PKGBUILD? " + pkg.PackageBase
-		if len(bases[pkg.PackageBase]) > 1 || pkg.PackageBase != pkg.Name {
-			str += " ("
-			for _, split := range bases[pkg.PackageBase] {
-				str += split.Name + " "
+		oldMaintainer, changed := maintainerChanged(pkg)
+		if changed {
+			printMaintainerChange(pkg, oldMaintainer)
+			maintainerChanges.set(pkg.PackageBase)
+		} else if alreadyReviewed(pkg.PackageBase, dir) {
+			fmt.Println(boldGreenFg(arrow), boldFg(pkg.PackageBase+" unchanged since last review -- skipping"))
+			continue
+		}
+
+		if old, ok := oldSrcinfos[pkg.PackageBase]; ok {
+			if srcinfo, err := parseSrcinfo(dir + ".SRCINFO"); err == nil {
+				printSourceChanges(pkg.PackageBase, old, srcinfo)
 			}
-			str = str[:len(str)-1] + ")"
 		}
 
-		if !continueTask(str, "yY") {
-			editcmd := exec.Command(editor(), dir+"PKGBUILD")
+		toReview = append(toReview, pkg)
+	}
+
+	if len(toReview) == 0 {
+		return nil
+	}
+
+	signatures := verifySourceSignatures(toReview)
+
+	var menu menuSelection
+	if !skipPrompt("edit") {
+		fmt.Println(boldCyanFg("::"), boldFg("PKGBUILDs to edit?"))
+		for i, pkg := range toReview {
+			str := baseString(pkg, bases)
+			if files := editableFiles(config.BuildDir + pkg.PackageBase + "/"); len(files) > 1 {
+				str += " [" + strings.Join(files, " ") + "]"
+			}
+
+			fmt.Print(yellowFg(fmt.Sprintf("%2d ", i+1)))
+			if result, ok := signatures[pkg.PackageBase]; ok {
+				fmt.Println(boldWhiteFg(str), result)
+			} else {
+				fmt.Println(boldWhiteFg(str))
+			}
+		}
+
+		var err error
+		menu, err = readNumberMenu("edit", ", all, none or abort")
+		if err != nil {
+			return err
+		}
+
+		if menu.otherInclude.get("abort") {
+			return fmt.Errorf("Aborting due to user")
+		}
+		menu.addKeyword("all", 1, len(toReview))
+	}
+
+	for i, pkg := range toReview {
+		dir := config.BuildDir + pkg.PackageBase + "/"
+		changed := maintainerChanges.get(pkg.PackageBase)
+
+		if changed && skipPrompt("edit") {
+			// nobody is there to review it, say so instead of blocking
+			fmt.Println(boldRedFgBlackBg(arrow+" Warning:"),
+				blackBg(pkg.PackageBase+" changed maintainer and was not reviewed"))
+		} else if changed || menu.selected(i+1) {
+			files := editableFiles(dir)
+			paths := make([]string, 0, len(files))
+			for _, file := range files {
+				paths = append(paths, dir+file)
+			}
+
+			editcmd := exec.Command(editor(), paths...)
 			editcmd.Stdin, editcmd.Stdout, editcmd.Stderr = os.Stdin, os.Stdout, os.Stderr
 			editcmd.Run()
 		}
+
+		err := checkPkgbuildLint(pkg.PackageBase, dir)
+		if err != nil {
+			return err
+		}
+
+		// nothing was looked at when running unattended
+		if !skipPrompt("edit") {
+			err = recordReview(pkg.PackageBase, dir)
+			if err != nil {
+				fmt.Println(err)
+			}
+		}
 	}
 
 	return nil
@@ -283,40 +626,69 @@ func parsesrcinfos(pkgs []*rpc.Pkg, srcinfos map[string]*gopkg.PKGBUILD) error {
 	for _, pkg := range pkgs {
 		dir := config.BuildDir + pkg.PackageBase + "/"
 
-		cmd := exec.Command(config.MakepkgBin, "--printsrcinfo")
-		cmd.Stderr = os.Stderr
-		cmd.Dir = dir
-		srcinfo, err := cmd.Output()
-
+		srcinfo, err := readSrcinfo(dir)
 		if err != nil {
 			return err
 		}
 
-		pkgbuild, err := gopkg.ParseSRCINFOContent(srcinfo)
+		pkgbuild, err := parseSrcinfoContent(srcinfo)
 		if err != nil {
 			return fmt.Errorf("%s: %s", pkg.Name, err)
 		}
 
 		srcinfos[pkg.PackageBase] = pkgbuild
-
-		for _, pkgsource := range pkgbuild.Source {
-			owner, repo := parseSource(pkgsource)
-			if owner != "" && repo != "" {
-				err = branchInfo(pkg.Name, owner, repo)
-				if err != nil {
-					return err
-				}
-			}
-		}
+		updateVCSInfo(pkg.PackageBase, pkgbuild)
 	}
 
 	return nil
 }
 
-func dowloadPkgBuilds(pkgs []*rpc.Pkg, bases map[string][]*rpc.Pkg) (err error) {
+// downloadJobs is how many AUR repositories are fetched at the same time.
+const downloadJobs = 8
+
+// gitFetchResult is the outcome of fetching the AUR repository of pkg.
+type gitFetchResult struct {
+	pkg   *rpc.Pkg
+	fresh bool
+	err   error
+}
+
+func dowloadPkgBuilds(pkgs []*rpc.Pkg, bases map[string][]*rpc.Pkg, oldSrcinfos map[string]*gopkg.PKGBUILD) error {
 	for _, pkg := range pkgs {
-		//todo make pretty
-		str := "Downloading: " + pkg.PackageBase + "-" + pkg.Version
+		// remember what was built last time so changes can be highlighted
+		old, errSrcinfo := parseSrcinfo(config.BuildDir + pkg.PackageBase + "/.SRCINFO")
+		if errSrcinfo == nil {
+			oldSrcinfos[pkg.PackageBase] = old
+		}
+	}
+
+	// the repositories are fetched concurrently, updating the checkouts
+	// may need to ask about local changes so it is done one at a time after
+	queue := make(chan *rpc.Pkg)
+	results := make(chan gitFetchResult)
+	for i := 0; i < downloadJobs && i < len(pkgs); i++ {
+		go func() {
+			for pkg := range queue {
+				fresh, err := aurGitFetch(pkg.PackageBase)
+				results <- gitFetchResult{pkg, fresh, err}
+			}
+		}()
+	}
+	go func() {
+		for _, pkg := range pkgs {
+			queue <- pkg
+		}
+		close(queue)
+	}()
+
+	skip := make(stringSet)
+	downloadFailed := make(stringSet)
+	var failed []string
+	for i := range pkgs {
+		result := <-results
+		pkg := result.pkg
+
+		str := "Downloaded " + pkg.PackageBase + "-" + pkg.Version
 		if len(bases[pkg.PackageBase]) > 1 || pkg.PackageBase != pkg.Name {
 			str += " ("
 			for _, split := range bases[pkg.PackageBase] {
@@ -324,109 +696,419 @@ func dowloadPkgBuilds(pkgs []*rpc.Pkg, bases map[string][]*rpc.Pkg) (err error)
 			}
 			str = str[:len(str)-1] + ")"
 		}
-		fmt.Println(str)
+		printProgress(i+1, len(pkgs), str)
+
+		if result.err != nil {
+			fmt.Println(boldRedFgBlackBg(arrow+" Error:"),
+				blackBg("Could not download "+pkg.PackageBase+": "+result.err.Error()))
+			failed = append(failed, pkg.PackageBase)
+			skip.set(pkg.PackageBase)
+			downloadFailed.set(pkg.PackageBase)
+		} else if result.fresh {
+			skip.set(pkg.PackageBase)
+		}
+	}
+
+	for _, pkg := range pkgs {
+		// failed downloads and fresh clones have nothing to update
+		if skip.get(pkg.PackageBase) {
+			continue
+		}
+
+		err := updateCheckout(pkg.PackageBase, config.BuildDir+pkg.PackageBase+"/")
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, pkg := range pkgs {
+		if downloadFailed.get(pkg.PackageBase) {
+			continue
+		}
 
-		err = downloadAndUnpack(baseURL+pkg.URLPath, config.BuildDir, false)
+		err := applyOverlay(pkg.PackageBase)
 		if err != nil {
-			return
+			fmt.Println(boldRedFgBlackBg(arrow+" Error:"),
+				blackBg("Could not apply the overlay of "+pkg.PackageBase+": "+err.Error()))
+			failed = append(failed, pkg.PackageBase)
 		}
 	}
 
-	return
+	if len(failed) > 0 {
+		return &basesFailedError{"Downloading", failed}
+	}
+
+	return nil
 }
 
-func downloadPkgBuildsSources(pkgs []*rpc.Pkg) (err error) {
-	for _, pkg := range pkgs {
+// downloadPkgBuildsSources fetches the sources of every package before
+// anything is built, so network problems show up early and the builds can
+// run offline one after the other. Every package is tried and all failures
+// are reported together.
+func downloadPkgBuildsSources(pkgs []*rpc.Pkg, srcinfos map[string]*gopkg.PKGBUILD) error {
+	var failed []string
+
+	for i, pkg := range pkgs {
+		printProgress(i+1, len(pkgs), "Downloading sources of "+pkg.PackageBase)
 		dir := config.BuildDir + pkg.PackageBase + "/"
-		err = passToMakepkg(dir, "--nobuild", "--nocheck", "--noprepare", "--nodeps")
+		args := []string{"--nobuild", "--nocheck", "--noprepare", "--nodeps", "--skipinteg"}
+		if config.NoConfirm {
+			args = append(args, "--noconfirm")
+		}
+
+		tools := sourceTools(srcinfos[pkg.PackageBase].Source)
+		err := runMakepkg(pkgbuildCommand(makepkgCommand(dir, args...), tools))
 		if err != nil {
-			return
+			fmt.Println(boldRedFgBlackBg(arrow+" Error:"),
+				blackBg("Could not download the sources of "+pkg.PackageBase))
+			failed = append(failed, pkg.PackageBase)
 		}
 	}
 
-	return
+	if len(failed) > 0 {
+		return &basesFailedError{"Downloading sources", failed}
+	}
+
+	return nil
+}
+
+// installAsDep reports whether the built package name gets installed with
+// --asdeps. --asdeps and --asexplicit apply to everything, otherwise the
+// reason of an installed copy is kept and new packages are explicit only
+// if they were asked for.
+func installAsDep(name string, targets stringSet, parser *arguments, localDb *alpm.Db) bool {
+	if parser.existsArg("asdeps") {
+		return true
+	}
+	if parser.existsArg("asexplicit") {
+		return false
+	}
+
+	if pkg, err := localDb.PkgByName(name); err == nil {
+		return pkg.Reason() == alpm.PkgReasonDepend
+	}
+
+	return config.MarkDeps && !targets.get(name)
 }
 
 func buildInstallPkgBuilds(pkgs []*rpc.Pkg, srcinfos map[string]*gopkg.PKGBUILD, targets stringSet, parser *arguments, bases map[string][]*rpc.Pkg) error {
+	localDb, err := alpmHandle.LocalDb()
+	if err != nil {
+		return err
+	}
+
+	err = prepareChrootBuilds(pkgs, bases)
+	if err != nil {
+		return err
+	}
+
+	if crossArch != "" {
+		return buildCrossPkgBuilds(pkgs, srcinfos, bases)
+	}
+
+	if config.BatchInstall {
+		return buildInstallBatch(pkgs, srcinfos, targets, parser, bases, localDb)
+	}
+
+	if config.BuildJobs > 1 {
+		return buildInstallParallel(pkgs, srcinfos, targets, parser, bases, localDb)
+	}
+
+	deps := baseDeps(bases)
+	failed := make(stringSet)
+	var failedBuilds []string
+
 	//for n := len(pkgs) -1 ; n > 0; n-- {
 	for n := 0; n < len(pkgs); n++ {
 		pkg := pkgs[n]
 
-		dir := config.BuildDir + pkg.PackageBase + "/"
-		built := true
-
-		srcinfo := srcinfos[pkg.PackageBase]
-		version := srcinfo.CompleteVersion()
+		if dep := failedDep(deps[pkg.PackageBase], failed); dep != "" {
+			printSkippedDependent(pkg.PackageBase, dep)
+			failed.set(pkg.PackageBase)
+			continue
+		}
 
-		for _, split := range bases[pkg.PackageBase] {
-			file, err := completeFileName(dir, split.Name+"-"+version.String())
-			if err != nil {
+		buildLog := quietBuildLog(pkg.PackageBase)
+		err := buildPkgBuild(pkg, srcinfos[pkg.PackageBase], bases, buildLog)
+		if err != nil {
+			if !skipFailedBuild(pkg.PackageBase, failureLog(pkg.PackageBase, buildLog), err) {
 				return err
 			}
 
-			if file == "" {
-				built = false
-			}
+			failed.set(pkg.PackageBase)
+			failedBuilds = append(failedBuilds, pkg.PackageBase)
+			continue
 		}
 
-		if built {
-			fmt.Println(boldRedFgBlackBg(arrow+" Warning:"),
-				blackBg(pkg.Name+"-"+pkg.Version+" Already made -- skipping build"))
+		err = installPkgBuild(pkg, srcinfos[pkg.PackageBase], targets, parser, bases, localDb)
+		if err != nil {
+			return err
+		}
+	}
+
+	return failedBuildsError(failedBuilds)
+}
+
+// forcedRebuilds holds the packages to build again even if they were built
+// at the same version before, as an upgrade replaces libraries the package
+// files built then link against.
+var forcedRebuilds = make(stringSet)
+
+// builtBefore reports whether every package of pkgbase was built at
+// version already, so the package files can be installed as they are.
+func builtBefore(pkgbase string, version string, bases map[string][]*rpc.Pkg) (bool, error) {
+	dir := config.BuildDir + pkgbase + "/"
+	for _, split := range bases[pkgbase] {
+		if forcedRebuilds.get(split.Name) {
+			return false, nil
+		}
+
+		file, err := completeFileName(dir, split.Name+"-"+version)
+		if err != nil {
+			return false, err
+		}
+		if crossArch != "" {
+			file = findPkgFile(config.BuildDir+pkgbase, split.Name, version, crossArch)
+		}
+
+		if file == "" {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+// makepkgBuildArgs returns the makepkg arguments building pkgbase.
+func makepkgBuildArgs(pkgbase string) []string {
+	// the sources were all fetched beforehand, --holdver keeps makepkg from
+	// updating VCS sources again so the build needs no network
+	args := append([]string{"-Cscf", "--noconfirm", "--holdver"}, skippedChecks(pkgbase)...)
+	// the dependencies were installed beforehand, makepkg cannot become
+	// root in the sandbox and parallel builds would run pacman side by side
+	if preinstalledDeps() {
+		args[0] = "-Ccf"
+	}
+	if staged(pkgbase) {
+		args = append(args, "--nodeps", "--nocheck")
+	}
+
+	return args
+}
+
+// buildPkgBuild builds the packages of pkg's pkgbase, unless all of them
+// were built already. The build output goes to the terminal, or to the
+// file buildLog when one is given.
+func buildPkgBuild(pkg *rpc.Pkg, srcinfo *gopkg.PKGBUILD, bases map[string][]*rpc.Pkg, buildLog string) error {
+	dir := config.BuildDir + pkg.PackageBase + "/"
+	version := srcinfo.CompleteVersion()
+	built, err := builtBefore(pkg.PackageBase, version.String(), bases)
+	if err != nil {
+		return err
+	}
+
+	if built {
+		fmt.Println(boldRedFgBlackBg(arrow+" Warning:"),
+			blackBg(pkg.Name+"-"+pkg.Version+" Already made -- skipping build"))
+		return nil
+	}
+
+	args := makepkgBuildArgs(pkg.PackageBase)
+	for _, flag := range args[3:] {
+		logTransaction("building %s with %s", pkg.PackageBase, flag)
+	}
+
+	cmd, err := buildCommand(pkg, dir, args)
+	if err != nil {
+		return err
+	}
+	cmd = prioritizedCommand(cmd)
+	if buildLog == "" {
+		cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	} else {
+		out, err := os.Create(buildLog)
+		if err != nil {
+			return err
+		}
+		defer out.Close()
+
+		var w io.Writer = out
+		if showBuildStatus() {
+			pw := &phaseWriter{w: out}
+			w = pw
+			defer startStatusLine(pkg.PackageBase, pw)()
+		}
+
+		// without a pty makepkg, git and curl drop their colors and
+		// progress bars, a plain pipe is still better than no log
+		closePty, err := ptyOutput(cmd, w)
+		if err != nil {
+			cmd.Stdout, cmd.Stderr = w, w
 		} else {
-			err := passToMakepkg(dir, "-Cscf", "--noconfirm")
-			if err != nil {
-				return err
-			}
+			defer closePty()
 		}
+	}
 
-		arguments := parser.copy()
-		arguments.targets = make(stringSet)
-		arguments.op = "U"
-		arguments.delArg("confirm")
-		arguments.delArg("c", "clean")
-		arguments.delArg("q", "quiet")
-		arguments.delArg("q", "quiet")
-		arguments.delArg("y", "refresh")
-		arguments.delArg("u", "sysupgrade")
-		arguments.delArg("w", "downloadonly")
+	start := time.Now()
+	err = runWatchingOOM(pkg.PackageBase, func() error { return runTimeLimited(cmd) })
+	if err != nil {
+		return err
+	}
 
-		depArguments := makeArguments()
-		depArguments.addArg("D", "asdeps")
+	// parallel builds save it from the main goroutine
+	if buildLog == "" {
+		_ = saveVCSInfo()
+	}
+	recordBuildTime(pkg.PackageBase, time.Since(start))
 
-		for _, split := range bases[pkg.PackageBase] {
-			file, err := completeFileName(dir, split.Name+"-"+version.String())
-			if err != nil {
-				return err
-			}
+	return nil
+}
 
-			if file == "" {
-				return fmt.Errorf("Could not find built package " + split.Name + "-" + version.String())
-			}
+// builtFile is a package file built for a pkgbase.
+type builtFile struct {
+	name  string
+	file  string
+	asDep bool
+}
 
-			arguments.addTarget(file)
-			if !targets.get(split.Name) {
-				depArguments.addTarget(split.Name)
-			}
+// builtFiles finds the package files built for pkg's pkgbase and whether
+// each of them is to be installed as a dependency.
+func builtFiles(pkg *rpc.Pkg, srcinfo *gopkg.PKGBUILD, targets stringSet, parser *arguments, bases map[string][]*rpc.Pkg, localDb *alpm.Db) ([]builtFile, error) {
+	dir := config.BuildDir + pkg.PackageBase + "/"
+	version := srcinfo.CompleteVersion()
+	var files []builtFile
+
+	for _, split := range bases[pkg.PackageBase] {
+		file, err := completeFileName(dir, split.Name+"-"+version.String())
+		if err != nil {
+			return nil, err
 		}
 
-		oldConfirm := config.NoConfirm
-		config.NoConfirm = true
-		err := passToPacman(arguments)
+		if file == "" {
+			return nil, fmt.Errorf("Could not find built package " + split.Name + "-" + version.String())
+		}
+
+		files = append(files, builtFile{split.Name, file, installAsDep(split.Name, targets, parser, localDb)})
+	}
+
+	debugFile, err := handleDebugPkg(dir, pkg.PackageBase, version.String(), bases[pkg.PackageBase])
+	if err != nil {
+		return nil, err
+	}
+
+	if debugFile != "" {
+		files = append(files, builtFile{pkg.PackageBase + "-debug", debugFile, installAsDep(pkg.Name, targets, parser, localDb)})
+	}
+
+	return files, nil
+}
+
+// upgradeArguments turns the arguments of the run into ones for installing
+// built packages with pacman -U.
+func upgradeArguments(parser *arguments) *arguments {
+	arguments := parser.copy()
+	arguments.targets = make(stringSet)
+	arguments.op = "U"
+	arguments.delArg("confirm")
+	arguments.delArg("c", "clean")
+	arguments.delArg("q", "quiet")
+	arguments.delArg("q", "quiet")
+	arguments.delArg("y", "refresh")
+	arguments.delArg("u", "sysupgrade")
+	arguments.delArg("w", "downloadonly")
+	arguments.delArg("asdeps")
+	arguments.delArg("asexplicit")
+
+	return arguments
+}
+
+// installPkgBuild installs the packages built from pkg's pkgbase, the
+// dependencies and the targets each in their own transaction.
+func installPkgBuild(pkg *rpc.Pkg, srcinfo *gopkg.PKGBUILD, targets stringSet, parser *arguments, bases map[string][]*rpc.Pkg, localDb *alpm.Db) error {
+	files, err := builtFiles(pkg, srcinfo, targets, parser, bases, localDb)
+	if err != nil {
+		return err
+	}
+
+	// dependencies go first in their own transaction so they can be
+	// installed with --asdeps while the targets stay explicit
+	arguments := upgradeArguments(parser)
+	if staged(pkg.PackageBase) {
+		arguments.addArg("d", "d")
+	}
+	depArguments := arguments.copy()
+	depArguments.addArg("asdeps")
+
+	for _, file := range files {
+		if file.asDep {
+			depArguments.addTarget(file.file)
+		} else {
+			arguments.addTarget(file.file)
+		}
+	}
+
+	oldConfirm := config.NoConfirm
+	config.NoConfirm = true
+	if len(depArguments.targets) > 0 {
+		err := passToPacman(depArguments)
 		if err != nil {
 			return err
 		}
-		if len(depArguments.targets) > 0 {
-			err = passToPacman(depArguments)
-			if err != nil {
-				return err
-			}
+	}
+	if len(arguments.targets) > 0 {
+		err := passToPacman(arguments)
+		if err != nil {
+			return err
 		}
-		config.NoConfirm = oldConfirm
+	}
+	config.NoConfirm = oldConfirm
+	currentTransaction.installed(pkg.PackageBase)
+
+	err = recordMaintainer(pkg)
+	if err != nil {
+		fmt.Println(err)
 	}
 
 	return nil
 }
 
+// handleDebugPkg applies config.DebugPkgs to the -debug package makepkg may
+// have built for pkgbase in dir. It returns the file to install alongside
+// the splits, if any.
+func handleDebugPkg(dir, pkgbase, version string, splits []*rpc.Pkg) (string, error) {
+	name := pkgbase + "-debug"
+	for _, split := range splits {
+		// asked for by name, already installed with the other splits
+		if split.Name == name {
+			return "", nil
+		}
+	}
+
+	file, err := completeFileName(dir, name+"-"+version)
+	if err != nil || file == "" {
+		return "", err
+	}
+
+	switch config.DebugPkgs {
+	case DebugPkgsInstall:
+		return file, nil
+	case DebugPkgsCache:
+		cache := config.BuildDir + "debug/"
+		if err := os.MkdirAll(cache, 0755); err != nil {
+			return "", err
+		}
+
+		dest := cache + filepath.Base(file)
+		if err := os.Rename(file, dest); err != nil {
+			return "", err
+		}
+
+		fmt.Println(boldGreenFg(arrow+" Cached debug package"), dest)
+	}
+
+	return "", nil
+}
+
 func clean(pkgs []*rpc.Pkg) {
 	for _, pkg := range pkgs {
 		dir := config.BuildDir + pkg.PackageBase + "/"
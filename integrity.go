@@ -0,0 +1,237 @@
+package main
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	rpc "github.com/mikkeloscar/aur"
+	gopkg "github.com/mikkeloscar/gopkgbuild"
+)
+
+// checksumKinds are the checksum arrays of a PKGBUILD, each parallel to its
+// sources.
+var checksumKinds = []struct {
+	name string
+	sums func(*gopkg.PKGBUILD) []string
+	hash func() hash.Hash
+}{
+	{"md5sums", func(p *gopkg.PKGBUILD) []string { return p.Md5sums }, md5.New},
+	{"sha1sums", func(p *gopkg.PKGBUILD) []string { return p.Sha1sums }, sha1.New},
+	{"sha224sums", func(p *gopkg.PKGBUILD) []string { return p.Sha224sums }, sha256.New224},
+	{"sha256sums", func(p *gopkg.PKGBUILD) []string { return p.Sha256sums }, sha256.New},
+	{"sha384sums", func(p *gopkg.PKGBUILD) []string { return p.Sha384sums }, sha512.New384},
+	{"sha512sums", func(p *gopkg.PKGBUILD) []string { return p.Sha512sums }, sha512.New},
+}
+
+var integrityFailedRegex = regexp.MustCompile(`(?m)^\s+(\S+) \.\.\. (FAILED|NOT FOUND)`)
+
+// checksumMismatch is a source file whose checksum is not the one listed
+// in the PKGBUILD. actual is empty when the file could not be read.
+type checksumMismatch struct {
+	file     string
+	kind     string
+	expected string
+	actual   string
+}
+
+func (m checksumMismatch) String() string {
+	if m.actual == "" {
+		return fmt.Sprintf("%s: %s expected %s, file not found", m.file, m.kind, m.expected)
+	}
+
+	return fmt.Sprintf("%s: %s expected %s, found %s", m.file, m.kind, m.expected, m.actual)
+}
+
+// sourceFileName returns the name makepkg saves a source entry under.
+func sourceFileName(source string) string {
+	if i := strings.Index(source, "::"); i != -1 {
+		return source[:i]
+	}
+
+	if i := strings.IndexAny(source, "#?"); i != -1 {
+		source = source[:i]
+	}
+	name := path.Base(source)
+
+	// git checkouts are named after the repository, without .git
+	if strings.HasPrefix(source, "git+") || strings.HasPrefix(source, "git://") {
+		if i := strings.Index(name, ".git"); i != -1 {
+			name = name[:i]
+		}
+	}
+
+	return name
+}
+
+// failedSources returns the files makepkg --verifysource reported as
+// failing their checksums.
+func failedSources(output []byte) []string {
+	var files []string
+	for _, match := range integrityFailedRegex.FindAllSubmatch(output, -1) {
+		files = append(files, string(match[1]))
+	}
+
+	return files
+}
+
+// sourcePath returns where makepkg finds the source file of the PKGBUILD
+// in dir: in dir itself, or else in its SRCDEST.
+func sourcePath(dir string, file string) string {
+	if _, err := os.Stat(dir + file); err == nil {
+		return dir + file
+	}
+
+	return sourceDest(filepath.Base(dir)) + file
+}
+
+// checksumMismatches works out which checksum of each failed file in dir
+// does not match, and what the file actually hashes to.
+func checksumMismatches(srcinfo *gopkg.PKGBUILD, dir string, failed []string) []checksumMismatch {
+	var mismatches []checksumMismatch
+
+	for _, file := range failed {
+		for i, source := range srcinfo.Source {
+			if sourceFileName(source) != file {
+				continue
+			}
+
+			for _, kind := range checksumKinds {
+				sums := kind.sums(srcinfo)
+				if i >= len(sums) || sums[i] == "SKIP" {
+					continue
+				}
+
+				actual, err := fileSum(sourcePath(dir, file), kind.hash())
+				if err == nil && actual == sums[i] {
+					continue
+				}
+
+				mismatches = append(mismatches, checksumMismatch{file, kind.name, sums[i], actual})
+			}
+		}
+	}
+
+	return mismatches
+}
+
+func fileSum(path string, h hash.Hash) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	if _, err := io.Copy(h, file); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// resolveSkipChecks narrows SkipInteg and SkipPGPCheck down to the pkgbases
+// of dc, warning about names that are not being built.
+func resolveSkipChecks(dc *depCatagories) {
+	resolve := func(names stringSet) stringSet {
+		bases := make(stringSet)
+		for name := range names {
+			found := false
+			for base, splits := range dc.Bases {
+				for _, split := range splits {
+					if split.Name == name || base == name {
+						bases.set(base)
+						found = true
+					}
+				}
+			}
+
+			if !found {
+				fmt.Println(boldRedFgBlackBg(arrow+" Warning:"),
+					blackBg(name+" is not built from the AUR, its checks are not skipped"))
+			}
+		}
+
+		return bases
+	}
+
+	config.SkipInteg = resolve(config.SkipInteg)
+	config.SkipPGPCheck = resolve(config.SkipPGPCheck)
+}
+
+// skippedChecks returns the makepkg flags skipping the checks pkgbase was
+// asked to skip.
+func skippedChecks(pkgbase string) []string {
+	var flags []string
+	if config.SkipInteg.get(pkgbase) {
+		flags = append(flags, "--skipinteg")
+	} else if config.SkipPGPCheck.get(pkgbase) {
+		flags = append(flags, "--skippgpcheck")
+	}
+
+	return flags
+}
+
+// checkIntegrity verifies the checksums of the downloaded sources of pkgs
+// as a step of its own, reporting every mismatch before giving up. With
+// RegenSums the sums of failing packages are regenerated instead, trusting
+// whatever was downloaded.
+func checkIntegrity(pkgs []*rpc.Pkg, srcinfos map[string]*gopkg.PKGBUILD) error {
+	var failed []string
+
+	for i, pkg := range pkgs {
+		printProgress(i+1, len(pkgs), "Checking integrity of "+pkg.PackageBase)
+		if config.SkipInteg.get(pkg.PackageBase) {
+			fmt.Println(boldRedFgBlackBg(arrow+" Warning:"),
+				blackBg("Skipping the integrity checks of "+pkg.PackageBase+" as asked"))
+			continue
+		}
+
+		dir := config.BuildDir + pkg.PackageBase + "/"
+		tools := sourceTools(srcinfos[pkg.PackageBase].Source)
+		output, err := pkgbuildCommand(makepkgCommand(dir, "--verifysource", "--skippgpcheck"), tools).CombinedOutput()
+		if err == nil {
+			continue
+		}
+
+		mismatches := checksumMismatches(srcinfos[pkg.PackageBase], dir, failedSources(output))
+		if len(mismatches) == 0 {
+			fmt.Print(string(output))
+		}
+		for _, mismatch := range mismatches {
+			fmt.Println(boldRedFgBlackBg(arrow+" Error:"),
+				blackBg(pkg.PackageBase+": "+mismatch.String()))
+		}
+
+		if !config.RegenSums {
+			failed = append(failed, pkg.PackageBase)
+			continue
+		}
+
+		fmt.Println(boldRedFgBlackBg(arrow+" Warning:"),
+			blackBg("Regenerating the checksums of "+pkg.PackageBase+", trusting the downloaded sources"))
+		cmd := exec.Command("updpkgsums")
+		cmd.Dir = dir
+		cmd = pkgbuildCommand(cmd, append(tools, "pacman-contrib"))
+		cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("%s: could not regenerate checksums: %s", pkg.PackageBase, err)
+		}
+	}
+
+	if len(failed) > 0 {
+		return &basesFailedError{"Integrity check", failed}
+	}
+
+	return nil
+}
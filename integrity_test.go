@@ -0,0 +1,95 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+
+	gopkg "github.com/mikkeloscar/gopkgbuild"
+)
+
+func TestSourceFileName(t *testing.T) {
+	sources := map[string]string{
+		"https://example.org/foo-1.0.tar.gz":           "foo-1.0.tar.gz",
+		"foo.tar.gz::https://example.org/download?v=1": "foo.tar.gz",
+		"git+https://example.org/foo.git#tag=v1":       "foo",
+		"git://example.org/bar.git/":                   "bar",
+		"https://example.org/baz.git":                  "baz.git",
+		"fix.patch":                                    "fix.patch",
+	}
+
+	for source, expected := range sources {
+		if name := sourceFileName(source); name != expected {
+			t.Errorf("Expected %s to be saved as %s, found %s", source, expected, name)
+		}
+	}
+}
+
+func TestChecksumMismatches(t *testing.T) {
+	dir, err := ioutil.TempDir("", "yay-integrity")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	dir += "/"
+
+	if err := ioutil.WriteFile(dir+"foo.tar.gz", []byte("foo\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	output := []byte("==> Validating source files with sha256sums...\n" +
+		"    foo.tar.gz ... FAILED\n" +
+		"    fix.patch ... Passed\n" +
+		"    gone.patch ... NOT FOUND\n")
+	failed := failedSources(output)
+	if !reflect.DeepEqual(failed, []string{"foo.tar.gz", "gone.patch"}) {
+		t.Fatalf("Expected foo.tar.gz and gone.patch to fail, found %v", failed)
+	}
+
+	srcinfo := &gopkg.PKGBUILD{
+		Source:     []string{"https://example.org/foo.tar.gz", "fix.patch", "gone.patch"},
+		Sha256sums: []string{"0000", "SKIP", "1111"},
+	}
+
+	expected := []checksumMismatch{
+		{"foo.tar.gz", "sha256sums", "0000", "b5bb9d8014a0f9b1d61e21e796d78dccdf1352f23cd32812f4850b878ae4944c"},
+		{"gone.patch", "sha256sums", "1111", ""},
+	}
+	if mismatches := checksumMismatches(srcinfo, dir, failed); !reflect.DeepEqual(mismatches, expected) {
+		t.Errorf("Expected %v, found %v", expected, mismatches)
+	}
+}
+
+func TestChecksumMismatchesSrcdest(t *testing.T) {
+	dir, err := ioutil.TempDir("", "yay-integrity")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	srcdestOnce.Do(func() {})
+	oldSrcdest := srcdest
+	defer func() {
+		srcdest = oldSrcdest
+	}()
+	srcdest = dir + "/sources"
+
+	os.Mkdir(dir+"/foo", 0755)
+	os.Mkdir(srcdest, 0755)
+	if err := ioutil.WriteFile(srcdest+"/foo.tar.gz", []byte("foo\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	srcinfo := &gopkg.PKGBUILD{
+		Source:     []string{"https://example.org/foo.tar.gz"},
+		Sha256sums: []string{"0000"},
+	}
+
+	expected := []checksumMismatch{
+		{"foo.tar.gz", "sha256sums", "0000", "b5bb9d8014a0f9b1d61e21e796d78dccdf1352f23cd32812f4850b878ae4944c"},
+	}
+	if mismatches := checksumMismatches(srcinfo, dir+"/foo/", []string{"foo.tar.gz"}); !reflect.DeepEqual(mismatches, expected) {
+		t.Errorf("Expected %v, found %v", expected, mismatches)
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	rpc "github.com/mikkeloscar/aur"
+	gopkg "github.com/mikkeloscar/gopkgbuild"
+)
+
+// checkPgpKeys makes sure every key listed in validpgpkeys by the packages
+// to be built is present in the user's keyring, offering to import the
+// missing ones.
+func checkPgpKeys(pkgs []*rpc.Pkg, srcinfos map[string]*gopkg.PKGBUILD) error {
+	missing := make(map[string][]string)
+	var keys []string
+
+	for _, pkg := range pkgs {
+		srcinfo, ok := srcinfos[pkg.PackageBase]
+		if !ok || config.SkipInteg.get(pkg.PackageBase) || config.SkipPGPCheck.get(pkg.PackageBase) {
+			continue
+		}
+
+		for _, key := range srcinfo.Validpgpkeys {
+			if bases, ok := missing[key]; ok {
+				missing[key] = append(bases, pkg.PackageBase)
+				continue
+			}
+
+			if gpgCommand("--list-keys", key).Run() == nil {
+				continue
+			}
+
+			missing[key] = []string{pkg.PackageBase}
+			keys = append(keys, key)
+		}
+	}
+
+	if len(keys) == 0 {
+		return nil
+	}
+
+	fmt.Println(boldCyanFg("::"), boldFg("PGP keys need importing:"))
+	for _, key := range keys {
+		fmt.Println(yellowFg("\t"+key), "wanted by:", missing[key])
+	}
+
+	if !continueTask("importkeys", "Import?", "nN") {
+		return fmt.Errorf("Aborting due to user")
+	}
+
+	return importKeys(keys)
+}
+
+// importKeys fetches keys from the configured keyserver, or from gpg's
+// default one if none is set.
+func importKeys(keys []string) error {
+	args := make([]string, 0, len(keys)+3)
+	if config.Keyserver != "" {
+		args = append(args, "--keyserver", config.Keyserver)
+	}
+	args = append(args, "--recv-keys")
+	args = append(args, keys...)
+
+	cmd := gpgCommand(args...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+
+	fmt.Println(boldGreenFg(arrow), boldFg("Importing keys with gpg..."))
+	err := cmd.Run()
+	if err != nil {
+		return fmt.Errorf("Problem importing keys: %s", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strings"
+)
+
+// lintRule describes a pattern that is dangerous to find in a PKGBUILD.
+type lintRule struct {
+	// function restricts the rule to the body of a PKGBUILD function.
+	// An empty function means the whole file is checked.
+	function string
+	pattern  *regexp.Regexp
+	// allowed matches lines that are fine despite matching pattern.
+	allowed *regexp.Regexp
+	reason  string
+}
+
+// lintWarning is a rule violation found at a given line.
+type lintWarning struct {
+	line   int
+	text   string
+	reason string
+}
+
+var lintRules = []lintRule{
+	{
+		pattern: regexp.MustCompile(`\b(curl|wget)\b[^|#]*\|\s*(sudo\s+)?(ba|z|da)?sh\b`),
+		reason:  "downloads and executes a script",
+	},
+	{
+		function: "build",
+		pattern:  regexp.MustCompile(`\b(curl|wget)\b|\bgit\s+(clone|fetch|pull)\b`),
+		reason:   "accesses the network during build()",
+	},
+	{
+		pattern: regexp.MustCompile(`\brm\s+(-[a-zA-Z]*\s+)*-[a-zA-Z]*[rR][a-zA-Z]*\s+(-[a-zA-Z]*\s+)*["']?(/|~)`),
+		reason:  "recursively removes an absolute path",
+	},
+	{
+		function: "package",
+		pattern:  regexp.MustCompile(`(\b(install|cp|mv|ln|mkdir|touch|tee)\b[^#]*|>>?)\s*["']?/(usr|etc|opt|bin|sbin|lib|lib64|var|home|root|boot|srv)\b`),
+		allowed:  regexp.MustCompile(`\$\{?pkgdir\}?`),
+		reason:   "writes outside of $pkgdir",
+	},
+	{
+		pattern: regexp.MustCompile(`\bbase64\s+(-[a-zA-Z]*d[a-zA-Z]*|--decode)\b`),
+		reason:  "decodes a base64 blob",
+	},
+}
+
+var functionStart = regexp.MustCompile(`^\s*(function\s+)?([a-zA-Z_][a-zA-Z0-9_]*)\s*\(\s*\)`)
+
+// lintPkgbuild checks the contents of a PKGBUILD against lintRules.
+// This is a heuristic meant to draw attention during review, it does not
+// guarantee a PKGBUILD is safe.
+func lintPkgbuild(content string) []lintWarning {
+	var warnings []lintWarning
+	function := ""
+
+	for n, line := range strings.Split(content, "\n") {
+		if match := functionStart.FindStringSubmatch(line); match != nil {
+			function = match[2]
+		}
+
+		code := strings.TrimSpace(line)
+		if !strings.HasPrefix(code, "#") {
+			for _, rule := range lintRules {
+				if rule.function != "" && !strings.HasPrefix(function, rule.function) {
+					continue
+				}
+				if !rule.pattern.MatchString(code) {
+					continue
+				}
+				if rule.allowed != nil && rule.allowed.MatchString(code) {
+					continue
+				}
+
+				warnings = append(warnings, lintWarning{n + 1, code, rule.reason})
+			}
+		}
+
+		if strings.HasPrefix(line, "}") {
+			function = ""
+		}
+	}
+
+	return warnings
+}
+
+// checkPkgbuildLint lints the PKGBUILD and companion files in dir and asks
+// the user to explicitly confirm building them if anything suspicious was
+// found.
+func checkPkgbuildLint(pkgbase string, dir string) error {
+	found := false
+
+	for _, name := range editableFiles(dir) {
+		content, err := ioutil.ReadFile(dir + name)
+		if err != nil {
+			return err
+		}
+
+		warnings := lintPkgbuild(string(content))
+		if len(warnings) == 0 {
+			continue
+		}
+
+		found = true
+		fmt.Println(boldRedFgBlackBg(arrow+" Warning:"),
+			blackBg(pkgbase+" "+name+" contains suspicious code"))
+		for _, w := range warnings {
+			fmt.Printf("%s %s\n\t%s\n", yellowFg(fmt.Sprintf("%4d:", w.line)), w.reason, w.text)
+		}
+	}
+
+	if found && continueTask("lint", "Build "+pkgbase+" anyway?", "yY") {
+		return fmt.Errorf("Aborting due to suspicious PKGBUILD: %s", pkgbase)
+	}
+
+	return nil
+}
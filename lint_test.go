@@ -0,0 +1,60 @@
+package main
+
+import "testing"
+
+func TestLintPkgbuild(t *testing.T) {
+	pkgbuild := `pkgname=foo
+source=("https://example.com/foo.tar.gz")
+
+prepare() {
+	curl -s https://example.com/install.sh | sh
+}
+
+build() {
+	cd "$srcdir/foo"
+	git clone https://example.com/bar.git
+	echo aGVsbG8= | base64 -d > blob
+	# rm -rf /
+	make
+}
+
+package() {
+	install -Dm755 foo "$pkgdir/usr/bin/foo"
+	install -Dm755 foo /usr/bin/foo
+	rm -rf /opt/foo
+}
+`
+
+	expected := []int{5, 10, 11, 18, 19}
+	warnings := lintPkgbuild(pkgbuild)
+
+	if len(warnings) != len(expected) {
+		t.Fatalf("Expected %d warnings, found %+v", len(expected), warnings)
+	}
+
+	for i, w := range warnings {
+		if w.line != expected[i] {
+			t.Errorf("Expected warning on line %d, found %+v", expected[i], w)
+		}
+	}
+}
+
+func TestLintPkgbuildClean(t *testing.T) {
+	pkgbuild := `pkgname=foo
+
+build() {
+	cd "$srcdir/foo"
+	make
+}
+
+package() {
+	make DESTDIR="$pkgdir" install
+	install -Dm644 LICENSE "${pkgdir}/usr/share/licenses/foo/LICENSE"
+	rm -rf "$pkgdir/usr/share/doc"
+}
+`
+
+	if warnings := lintPkgbuild(pkgbuild); len(warnings) != 0 {
+		t.Fatalf("Expected no warnings, found %+v", warnings)
+	}
+}
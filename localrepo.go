@@ -0,0 +1,292 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	rpc "github.com/mikkeloscar/aur"
+)
+
+// localReposCache holds the clones of the local repos given as git URLs.
+var localReposCache string
+
+// localPkg is a package whose PKGBUILD comes from one of the local repos
+// instead of the AUR.
+type localPkg struct {
+	dir     string
+	srcinfo []byte
+	info    rpc.Pkg
+}
+
+var (
+	localPkgsOnce sync.Once
+	localPkgs     map[string]*localPkg
+)
+
+// isGitURL reports whether a local repo is given as a git URL rather than
+// a directory.
+func isGitURL(repo string) bool {
+	return strings.Contains(repo, "://") || strings.HasPrefix(repo, "git@") || strings.HasSuffix(repo, ".git")
+}
+
+// localRepoClone returns the name of the clone of the local repo at the
+// git URL repo, which differs for every URL.
+func localRepoClone(repo string) string {
+	return url.PathEscape(repo)
+}
+
+// localRepoDir returns the directory of a local repo, cloning the ones
+// given as git URLs. Clones are only updated along with the sync
+// databases, by -Sy.
+func localRepoDir(repo string) (string, error) {
+	if !isGitURL(repo) {
+		return repo, nil
+	}
+
+	name := localRepoClone(repo)
+	dir := filepath.Join(localReposCache, name)
+
+	if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+		if !cmdArgs.existsArg("y", "refresh") {
+			return dir, nil
+		}
+		return dir, gitCommand(dir, "pull", "--quiet", "--ff-only").Run()
+	}
+
+	if err := os.MkdirAll(localReposCache, 0755); err != nil {
+		return "", err
+	}
+	return dir, passToGit(localReposCache, "clone", "--quiet", repo, name)
+}
+
+// srcinfoPkgs describes the packages of a .SRCINFO, built for arch, the
+// way the AUR RPC would.
+func srcinfoPkgs(content []byte, arch string) []rpc.Pkg {
+	content = filterSrcinfoArch(content, arch)
+
+	var pkgs []rpc.Pkg
+	pkgbase := ""
+	for _, line := range strings.Split(string(content), "\n") {
+		i := strings.Index(line, " = ")
+		if i == -1 {
+			continue
+		}
+
+		key, name := strings.TrimSpace(line[:i]), strings.TrimSpace(line[i+3:])
+		if key == "pkgbase" {
+			pkgbase = name
+		}
+		if key != "pkgname" {
+			continue
+		}
+
+		values := srcinfoValues(content, name)
+		pkg := rpc.Pkg{
+			Name:        name,
+			PackageBase: pkgbase,
+			Version:     srcinfoVersion(values),
+			Maintainer:  "local",
+			Depends:     values["depends"],
+			MakeDepends: values["makedepends"],
+			Conflicts:   values["conflicts"],
+			Replaces:    values["replaces"],
+			OptDepends:  values["optdepends"],
+			License:     values["license"],
+		}
+		if desc := values["pkgdesc"]; len(desc) > 0 {
+			pkg.Description = desc[0]
+		}
+		if url := values["url"]; len(url) > 0 {
+			pkg.URL = url[0]
+		}
+
+		pkgs = append(pkgs, pkg)
+	}
+
+	return pkgs
+}
+
+// loadLocalRepo adds the packages of every PKGBUILD directory in dir to
+// localPkgs. The first repo to have a package wins. Packages are described
+// by the .SRCINFO next to their PKGBUILD, which is never sourced: those
+// without one are left out.
+func loadLocalRepo(dir string, arch string) error {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		pkgDir := filepath.Join(dir, entry.Name()) + "/"
+		if _, err := os.Stat(pkgDir + "PKGBUILD"); err != nil {
+			continue
+		}
+
+		srcinfo, err := ioutil.ReadFile(pkgDir + ".SRCINFO")
+		if err != nil {
+			fmt.Println(boldRedFgBlackBg(arrow+" Warning:"),
+				blackBg(pkgDir+" has no .SRCINFO -- skipping, commit the output of makepkg --printsrcinfo"))
+			continue
+		}
+
+		modified := 0
+		if info, err := os.Stat(pkgDir + "PKGBUILD"); err == nil {
+			modified = int(info.ModTime().Unix())
+		}
+
+		for _, pkg := range srcinfoPkgs(srcinfo, arch) {
+			if _, ok := localPkgs[pkg.Name]; ok {
+				continue
+			}
+
+			pkg.LastModified = modified
+			localPkgs[pkg.Name] = &localPkg{pkgDir, srcinfo, pkg}
+		}
+	}
+
+	return nil
+}
+
+// localPackages returns the packages of the local repos by name. The repos
+// are only read once per run.
+func localPackages() map[string]*localPkg {
+	localPkgsOnce.Do(func() {
+		localPkgs = make(map[string]*localPkg)
+		if len(config.LocalRepos) == 0 {
+			return
+		}
+
+		arch, err := alpmHandle.Arch()
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+
+		for _, repo := range config.LocalRepos {
+			dir, err := localRepoDir(repo)
+			if err == nil {
+				err = loadLocalRepo(dir, arch)
+			}
+			if err != nil {
+				fmt.Println(boldRedFgBlackBg(arrow+" Warning:"),
+					blackBg("Local repo "+repo+": "+err.Error()))
+			}
+		}
+	})
+
+	return localPkgs
+}
+
+// localPackageBase returns the local package of pkgbase, if there is one.
+func localPackageBase(pkgbase string) (*localPkg, bool) {
+	for _, pkg := range localPackages() {
+		if pkg.info.PackageBase == pkgbase {
+			return pkg, true
+		}
+	}
+
+	return nil, false
+}
+
+// localInfo splits names into the packages the local repos have and the
+// names left to look up in the AUR.
+func localInfo(names []string) (found []rpc.Pkg, remaining []string) {
+	local := localPackages()
+	for _, name := range names {
+		if pkg, ok := local[name]; ok {
+			found = append(found, pkg.info)
+		} else {
+			remaining = append(remaining, name)
+		}
+	}
+
+	return
+}
+
+// localSearch returns the local packages whose name or description
+// contains query.
+func localSearch(query string) []rpc.Pkg {
+	query = strings.ToLower(query)
+
+	var found []rpc.Pkg
+	for _, pkg := range localPackages() {
+		if strings.Contains(strings.ToLower(pkg.info.Name), query) ||
+			strings.Contains(strings.ToLower(pkg.info.Description), query) {
+			found = append(found, pkg.info)
+		}
+	}
+
+	return found
+}
+
+// localFetch is gitFetch for a package of the local repos: the build
+// directory becomes a git repository whose upstream branch gets a commit
+// of the PKGBUILD directory every time it changed, so its checkout is
+// updated, reviewed and overlaid like the ones of AUR packages.
+func localFetch(pkg *localPkg) (fresh bool, err error) {
+	pkgbase := pkg.info.PackageBase
+	dir := config.BuildDir + pkgbase + "/"
+
+	if _, err = os.Stat(dir + ".git"); err != nil || !gitHealthy(dir) {
+		fresh = true
+		if err = os.RemoveAll(dir); err != nil {
+			return
+		}
+		if err = os.MkdirAll(dir, 0755); err != nil {
+			return
+		}
+		if err = gitCommand(dir, "init", "--quiet").Run(); err != nil {
+			return
+		}
+	}
+
+	// stage the PKGBUILD directory in an index of its own, leaving the
+	// checkout alone
+	index := dir + ".git/yay-local-index"
+	defer os.Remove(index)
+	withIndex := func(args ...string) ([]byte, error) {
+		cmd := gitCommand(dir, args...)
+		if cmd.Env == nil {
+			cmd.Env = os.Environ()
+		}
+		cmd.Env = append(cmd.Env, "GIT_INDEX_FILE="+index)
+		return cmd.Output()
+	}
+
+	_, err = withIndex("--work-tree="+pkg.dir, "add", "--all", "--",
+		".", ":(exclude,top)src", ":(exclude,top)pkg", ":(exclude)*.pkg.tar*", ":(exclude)*.log")
+	if err != nil {
+		return
+	}
+	tree, err := withIndex("write-tree")
+	if err != nil {
+		return
+	}
+
+	commitTree := append(gitIdent, "commit-tree", strings.TrimSpace(string(tree)), "-m", "Local PKGBUILD of "+pkgbase)
+	parent, err := gitCommand(dir, "rev-parse", "--verify", "--quiet", gitUpstream).Output()
+	if err == nil {
+		parentTree, _ := gitCommand(dir, "rev-parse", gitUpstream+"^{tree}").Output()
+		if string(parentTree) == string(tree) {
+			return
+		}
+		commitTree = append(commitTree, "-p", strings.TrimSpace(string(parent)))
+	}
+
+	commit, err := gitCommand(dir, commitTree...).Output()
+	if err != nil {
+		return
+	}
+	err = gitCommand(dir, "update-ref", "refs/remotes/"+gitUpstream, strings.TrimSpace(string(commit))).Run()
+	if err != nil || !fresh {
+		return
+	}
+
+	err = gitCommand(dir, "reset", "--quiet", "--hard", gitUpstream).Run()
+	return
+}
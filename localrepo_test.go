@@ -0,0 +1,72 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+const testLocalSrcinfo = `pkgbase = mytool
+	pkgdesc = A private tool
+	pkgver = 1.2
+	pkgrel = 3
+	epoch = 1
+	url = https://example.com
+	license = MIT
+	depends = glibc
+	depends_aarch64 = libatomic
+	makedepends = go
+
+pkgname = mytool
+
+pkgname = mytool-docs
+	pkgdesc = Documentation of mytool
+	depends = 
+`
+
+func TestSrcinfoPkgs(t *testing.T) {
+	pkgs := srcinfoPkgs([]byte(testLocalSrcinfo), "x86_64")
+	if len(pkgs) != 2 {
+		t.Fatalf("Expected 2 packages, found %+v", pkgs)
+	}
+
+	tool := pkgs[0]
+	if tool.Name != "mytool" || tool.PackageBase != "mytool" || tool.Version != "1:1.2-3" {
+		t.Errorf("Expected mytool 1:1.2-3, found %+v", tool)
+	}
+	if tool.Maintainer != "local" || tool.Description != "A private tool" || tool.URL != "https://example.com" {
+		t.Errorf("Expected the metadata of the pkgbase, found %+v", tool)
+	}
+	if len(tool.Depends) != 1 || tool.Depends[0] != "glibc" {
+		t.Errorf("Expected the x86_64 depends only, found %v", tool.Depends)
+	}
+
+	docs := pkgs[1]
+	if docs.PackageBase != "mytool" || docs.Description != "Documentation of mytool" || len(docs.Depends) != 0 {
+		t.Errorf("Expected mytool-docs with its own pkgdesc and depends, found %+v", docs)
+	}
+	if len(docs.MakeDepends) != 1 {
+		t.Errorf("Expected the makedepends of the pkgbase, found %v", docs.MakeDepends)
+	}
+}
+
+func TestIsGitURL(t *testing.T) {
+	for repo, expected := range map[string]bool{
+		"/home/me/pkgbuilds":               false,
+		"https://example.com/me/pkgbuilds": true,
+		"git@example.com:me/pkgbuilds.git": true,
+		"/srv/git/pkgbuilds.git":           true,
+		"~/src/pkgbuilds":                  false,
+	} {
+		if git := isGitURL(repo); git != expected {
+			t.Errorf("Expected %s to be a git URL %t, found %t", repo, expected, git)
+		}
+	}
+}
+
+func TestLocalRepoClone(t *testing.T) {
+	a := localRepoClone("https://example.com/alice/pkgbuilds.git")
+	b := localRepoClone("https://example.com/bob/pkgbuilds.git")
+	if a == b || strings.Contains(a, "/") {
+		t.Errorf("Expected distinct clone names without slashes, found %q and %q", a, b)
+	}
+}
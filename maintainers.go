@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+
+	rpc "github.com/mikkeloscar/aur"
+)
+
+// savedMaintainers maps a pkgbase to the maintainer it had when last installed.
+var savedMaintainers = make(map[string]string)
+
+// maintainerFile holds yay maintainer info file path.
+var maintainerFile string
+
+// maintainerChanged reports whether pkg was last installed while being
+// maintained by somebody else. Packages never installed by yay before
+// are not considered changed.
+func maintainerChanged(pkg *rpc.Pkg) (old string, changed bool) {
+	old, ok := savedMaintainers[pkg.PackageBase]
+	return old, ok && old != pkg.Maintainer
+}
+
+// recordMaintainer stores the maintainer of an installed pkgbase.
+func recordMaintainer(pkg *rpc.Pkg) error {
+	if old, ok := savedMaintainers[pkg.PackageBase]; ok && old == pkg.Maintainer {
+		return nil
+	}
+
+	savedMaintainers[pkg.PackageBase] = pkg.Maintainer
+	return saveMaintainers()
+}
+
+func loadMaintainers() {
+	in, err := os.Open(maintainerFile)
+	if err != nil {
+		return
+	}
+	defer in.Close()
+
+	_ = json.NewDecoder(in).Decode(&savedMaintainers)
+}
+
+func saveMaintainers() error {
+	marshalledinfo, err := json.MarshalIndent(savedMaintainers, "", "\t")
+	if err != nil {
+		return err
+	}
+	in, err := os.OpenFile(maintainerFile, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	_, err = in.Write(marshalledinfo)
+	if err != nil {
+		return err
+	}
+	err = in.Sync()
+	return err
+}
+
+// printMaintained lists the AUR packages user maintains or co-maintains
+// and which of them are installed.
+func printMaintained(user string) error {
+	if user == "" {
+		return fmt.Errorf("No user given")
+	}
+
+	localDb, err := alpmHandle.LocalDb()
+	if err != nil {
+		return err
+	}
+
+	maintained, err := aurSearchBy("maintainer", user)
+	if err != nil {
+		return err
+	}
+
+	comaintained, err := aurSearchBy("comaintainers", user)
+	if err != nil {
+		fmt.Println(boldRedFgBlackBg(arrow+" Warning:"),
+			blackBg("Unable to list co-maintained packages: "+err.Error()))
+	}
+
+	role := make(map[string]string)
+	for _, pkg := range comaintained {
+		role[pkg.Name] = "co-maintainer"
+	}
+	for _, pkg := range maintained {
+		role[pkg.Name] = "maintainer"
+	}
+
+	all := append(maintained, comaintained...)
+	sort.Slice(all, func(i, j int) bool { return all[i].Name < all[j].Name })
+
+	fmt.Println(boldCyanFg("::"), boldFg("Packages of "+user+":"))
+	installed := 0
+	for i, pkg := range all {
+		if i > 0 && all[i-1].Name == pkg.Name {
+			continue
+		}
+
+		str := boldWhiteFg("aur/") + boldYellowFg(pkg.Name) + " " +
+			boldCyanFg(pkg.Version) + " (" + role[pkg.Name] + ")"
+		if _, err := localDb.PkgByName(pkg.Name); err == nil {
+			str += " " + greenFgBlackBg("Installed")
+			installed++
+		}
+		fmt.Println(str)
+	}
+
+	fmt.Println(len(role), "packages,", installed, "installed")
+
+	return nil
+}
+
+// printMaintainerChange warns that pkg changed hands since it was installed.
+func printMaintainerChange(pkg *rpc.Pkg, old string) {
+	maintainer := pkg.Maintainer
+	if maintainer == "" {
+		maintainer = "nobody"
+	}
+	if old == "" {
+		old = "nobody"
+	}
+
+	fmt.Println(boldRedFgBlackBg(arrow+" Warning:"),
+		blackBg(fmt.Sprintf("%s changed maintainer from %s to %s -- review required",
+			pkg.PackageBase, old, maintainer)))
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	alpm "github.com/jguer/go-alpm"
+)
+
+// manifestPkg is a package recorded in a manifest.
+type manifestPkg struct {
+	Name    string `json:"name"`
+	Version string `json:"version,omitempty"`
+	AsDeps  bool   `json:"asdeps,omitempty"`
+}
+
+// manifest describes the installed packages well enough to install them
+// again: the explicitly installed repo packages, leaving their
+// dependencies to pacman, and every foreign package with its version.
+type manifest struct {
+	Repo []manifestPkg `json:"repo"`
+	AUR  []manifestPkg `json:"aur"`
+}
+
+// buildManifest describes the installed packages.
+func buildManifest() (*manifest, error) {
+	local, remote, _, _, err := filterPackages()
+	if err != nil {
+		return nil, err
+	}
+
+	m := &manifest{Repo: []manifestPkg{}, AUR: []manifestPkg{}}
+	for _, pkg := range local {
+		if pkg.Reason() == alpm.PkgReasonExplicit {
+			m.Repo = append(m.Repo, manifestPkg{Name: pkg.Name()})
+		}
+	}
+
+	for _, pkg := range remote {
+		m.AUR = append(m.AUR, manifestPkg{
+			Name:    pkg.Name(),
+			Version: pkg.Version(),
+			AsDeps:  pkg.Reason() == alpm.PkgReasonDepend,
+		})
+	}
+
+	sort.Slice(m.Repo, func(i, j int) bool { return m.Repo[i].Name < m.Repo[j].Name })
+	sort.Slice(m.AUR, func(i, j int) bool { return m.AUR[i].Name < m.AUR[j].Name })
+	return m, nil
+}
+
+// printManifest prints the manifest of the installed packages.
+func printManifest() error {
+	m, err := buildManifest()
+	if err != nil {
+		return err
+	}
+
+	out, err := json.MarshalIndent(m, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(string(out))
+	return nil
+}
+
+// restoreTargets returns the packages of m that are not installed yet.
+// Foreign packages are installed by name, the recorded version is only
+// informative as the AUR only offers the latest one.
+func restoreTargets(m *manifest, installed func(string) bool) (targets []string) {
+	for _, pkgs := range [][]manifestPkg{m.Repo, m.AUR} {
+		for _, pkg := range pkgs {
+			if !installed(pkg.Name) {
+				targets = append(targets, pkg.Name)
+			}
+		}
+	}
+
+	return
+}
+
+// restoreManifest installs the packages of the manifest in path that are
+// missing, then sets the install reason of the foreign ones to the
+// recorded one. Dependency resolution orders the AUR builds.
+func restoreManifest(path string) error {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	m := new(manifest)
+	err = json.Unmarshal(content, m)
+	if err != nil {
+		return fmt.Errorf("%s: %s", path, err)
+	}
+
+	localDb, err := alpmHandle.LocalDb()
+	if err != nil {
+		return err
+	}
+	installed := func(name string) bool {
+		_, err := localDb.PkgByName(name)
+		return err == nil
+	}
+
+	targets := restoreTargets(m, installed)
+	if len(targets) == 0 {
+		fmt.Println(boldGreenFg(arrow), "Every package of", path, "is installed")
+	} else {
+		arguments := makeArguments()
+		arguments.op = "S"
+		arguments.addArg("needed")
+		arguments.addTarget(targets...)
+		err = install(arguments, true)
+		if err != nil {
+			return err
+		}
+	}
+
+	// pacman changed the local db behind the back of our handle
+	err = reopenAlpmHandle()
+	if err != nil {
+		return err
+	}
+	localDb, err = alpmHandle.LocalDb()
+	if err != nil {
+		return err
+	}
+
+	missing := make([]string, 0)
+	for _, name := range targets {
+		if !installed(name) {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) != 0 {
+		fmt.Println(boldRedFgBlackBg(arrow+" Warning:"),
+			blackBg("Not installed: "+strings.Join(missing, " ")))
+	}
+
+	asdeps := makeArguments()
+	asdeps.op = "D"
+	asdeps.addArg("asdeps")
+	asexplicit := makeArguments()
+	asexplicit.op = "D"
+	asexplicit.addArg("asexplicit")
+
+	for _, pkg := range m.AUR {
+		if !installed(pkg.Name) {
+			continue
+		}
+
+		if pkg.AsDeps {
+			asdeps.addTarget(pkg.Name)
+		} else {
+			asexplicit.addTarget(pkg.Name)
+		}
+	}
+
+	for _, arguments := range []*arguments{asdeps, asexplicit} {
+		if len(arguments.targets) == 0 {
+			continue
+		}
+
+		err = passToPacman(arguments)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
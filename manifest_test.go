@@ -0,0 +1,25 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestRestoreTargets(t *testing.T) {
+	m := &manifest{
+		Repo: []manifestPkg{{Name: "base"}, {Name: "git"}},
+		AUR:  []manifestPkg{{Name: "yay", Version: "2.297-1"}, {Name: "libfoo", AsDeps: true}},
+	}
+
+	installed := stringSet{"base": {}, "yay": {}}
+	targets := restoreTargets(m, installed.get)
+
+	expected := []string{"git", "libfoo"}
+	if len(targets) != len(expected) {
+		t.Fatalf("Expected %v, found %v", expected, targets)
+	}
+	for i := range expected {
+		if targets[i] != expected[i] {
+			t.Errorf("Expected %v, found %v", expected, targets)
+		}
+	}
+}
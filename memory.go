@@ -0,0 +1,193 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	rpc "github.com/mikkeloscar/aur"
+)
+
+// heavyBuilds are pkgbases known to need a lot of memory to build, with
+// the GiB of RAM and swap they need when built with every core.
+var heavyBuilds = map[string]int{
+	"chromium-wayland-vaapi": 16,
+	"ungoogled-chromium":     16,
+	"electron-git":           16,
+	"firefox-nightly":        12,
+	"librewolf":              12,
+	"qt5-webengine-git":      12,
+	"qt6-webengine-git":      12,
+	"llvm-git":               8,
+	"gcc-git":                8,
+	"rust-git":               8,
+}
+
+// oomFile holds the path of the record of builds killed for lack of memory.
+var oomFile string
+
+// oomFailures maps the pkgbases whose builds were killed for lack of
+// memory to the GiB of RAM and swap there were, rounded up.
+var oomFailures map[string]int
+
+var oomMut sync.Mutex
+
+// parseMeminfo returns the RAM and swap in KiB of /proc/meminfo content.
+func parseMeminfo(content string) (int64, error) {
+	var total int64
+	found := 0
+
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || (fields[0] != "MemTotal:" && fields[0] != "SwapTotal:") {
+			continue
+		}
+
+		kib, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			return 0, err
+		}
+		total += kib
+		found++
+	}
+
+	if found != 2 {
+		return 0, fmt.Errorf("MemTotal or SwapTotal missing from meminfo")
+	}
+
+	return total, nil
+}
+
+// systemMemory returns the RAM and swap of the system in MiB. Whole GiB
+// would read a system of 16 GiB as 15, as the kernel keeps some for itself.
+func systemMemory() (int, error) {
+	content, err := ioutil.ReadFile("/proc/meminfo")
+	if err != nil {
+		return 0, err
+	}
+
+	kib, err := parseMeminfo(string(content))
+	return int(kib / 1024), err
+}
+
+// oomKills returns how many processes the kernel killed for lack of memory
+// since boot.
+func oomKills() (int, error) {
+	content, err := ioutil.ReadFile("/proc/vmstat")
+	if err != nil {
+		return 0, err
+	}
+
+	for _, line := range strings.Split(string(content), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 2 && fields[0] == "oom_kill" {
+			return strconv.Atoi(fields[1])
+		}
+	}
+
+	return 0, fmt.Errorf("oom_kill missing from vmstat")
+}
+
+// memoryNeeded returns the GiB of RAM and swap building pkgbase needs, as
+// configured in MemoryHungry, learned from a build killed for lack of
+// memory, or known beforehand.
+func memoryNeeded(pkgbase string) (int, bool) {
+	if gib, ok := config.MemoryHungry[pkgbase]; ok {
+		return gib, true
+	}
+
+	oomMut.Lock()
+	gib, ok := oomFailures[pkgbase]
+	oomMut.Unlock()
+	if ok {
+		return gib + 1, true
+	}
+
+	gib, ok = heavyBuilds[pkgbase]
+	return gib, ok
+}
+
+// warnMemoryHungry warns about the pkgbases of pkgs needing more memory
+// to build than the system has.
+func warnMemoryHungry(pkgs []*rpc.Pkg) {
+	memory, err := systemMemory()
+	if err != nil {
+		return
+	}
+
+	for _, pkg := range pkgs {
+		needed, ok := memoryNeeded(pkg.PackageBase)
+		if !ok || needed*1024 <= memory {
+			continue
+		}
+
+		fmt.Println(boldRedFgBlackBg(arrow+" Warning:"),
+			blackBg(fmt.Sprintf("%s needs about %d GiB of memory to build, there are %.1f GiB of RAM and swap",
+				pkg.PackageBase, needed, float64(memory)/1024)))
+		fmt.Println(boldRedFgBlackBg(arrow+" Warning:"),
+			blackBg("Consider adding swap or building it with fewer jobs, for example with --makejobs 2"))
+	}
+}
+
+// recordOOM remembers that building pkgbase was killed for lack of memory.
+func recordOOM(pkgbase string) {
+	memory, err := systemMemory()
+	if err != nil {
+		return
+	}
+
+	oomMut.Lock()
+	defer oomMut.Unlock()
+
+	if oomFailures == nil {
+		oomFailures = make(map[string]int)
+	}
+	// rounded up, the build needs more than there was
+	if gib := (memory + 1023) / 1024; gib > oomFailures[pkgbase] {
+		oomFailures[pkgbase] = gib
+	}
+
+	marshalledinfo, err := json.MarshalIndent(oomFailures, "", "\t")
+	if err == nil {
+		err = ioutil.WriteFile(oomFile, marshalledinfo, 0644)
+	}
+	if err != nil {
+		fmt.Println(err)
+	}
+}
+
+func loadOOMFailures() {
+	in, err := os.Open(oomFile)
+	if err != nil {
+		return
+	}
+	defer in.Close()
+
+	oomMut.Lock()
+	defer oomMut.Unlock()
+	json.NewDecoder(in).Decode(&oomFailures)
+}
+
+// runWatchingOOM runs a build with run and records pkgbase when it fails
+// while processes were killed for lack of memory.
+func runWatchingOOM(pkgbase string, run func() error) error {
+	before, errBefore := oomKills()
+	err := run()
+	if err == nil || errBefore != nil {
+		return err
+	}
+
+	if after, errAfter := oomKills(); errAfter == nil && after > before {
+		fmt.Println(boldRedFgBlackBg(arrow+" Warning:"),
+			blackBg(pkgbase+" ran out of memory while building"))
+		recordOOM(pkgbase)
+	}
+
+	return err
+}
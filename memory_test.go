@@ -0,0 +1,31 @@
+package main
+
+import "testing"
+
+func TestParseMeminfo(t *testing.T) {
+	content := `MemTotal:        8044316 kB
+MemFree:          312508 kB
+MemAvailable:    4520660 kB
+SwapCached:        12884 kB
+SwapTotal:       4194300 kB
+SwapFree:        4094460 kB
+`
+
+	kib, err := parseMeminfo(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if kib != 8044316+4194300 {
+		t.Errorf("Expected %d KiB, found %d", 8044316+4194300, kib)
+	}
+
+	_, err = parseMeminfo("MemTotal:        8044316 kB\n")
+	if err == nil {
+		t.Error("Expected an error without SwapTotal")
+	}
+
+	_, err = parseMeminfo("MemTotal: x kB\nSwapTotal: 0 kB\n")
+	if err == nil {
+		t.Error("Expected an error for a malformed value")
+	}
+}
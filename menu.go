@@ -0,0 +1,185 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// intRange is an inclusive range of menu numbers.
+type intRange struct {
+	min int
+	max int
+}
+
+type intRanges []intRange
+
+func (rs intRanges) get(n int) bool {
+	for _, r := range rs {
+		if n >= r.min && n <= r.max {
+			return true
+		}
+	}
+
+	return false
+}
+
+// menuSelection is what was typed into a numbered menu: numbers and
+// ranges such as 1-3, and keywords like all or none. Each of them can be
+// negated with a leading ^. Keywords are lowercased and left to the menu
+// to interpret.
+type menuSelection struct {
+	include      intRanges
+	exclude      intRanges
+	otherInclude stringSet
+	otherExclude stringSet
+}
+
+// parseNumberMenu parses the input of a numbered menu.
+func parseNumberMenu(input string) menuSelection {
+	m := menuSelection{
+		otherInclude: make(stringSet),
+		otherExclude: make(stringSet),
+	}
+
+	for _, word := range strings.Fields(input) {
+		negate := strings.HasPrefix(word, "^")
+		word = strings.TrimPrefix(word, "^")
+
+		r, err := parseRange(word)
+		switch {
+		case err != nil && negate:
+			m.otherExclude.set(strings.ToLower(word))
+		case err != nil:
+			m.otherInclude.set(strings.ToLower(word))
+		case negate:
+			m.exclude = append(m.exclude, r)
+		default:
+			m.include = append(m.include, r)
+		}
+	}
+
+	return m
+}
+
+// parseRange parses a number or a range of numbers such as 1-10.
+func parseRange(word string) (intRange, error) {
+	parts := strings.SplitN(word, "-", 2)
+
+	min, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return intRange{}, err
+	}
+
+	max := min
+	if len(parts) == 2 {
+		max, err = strconv.Atoi(parts[1])
+		if err != nil {
+			return intRange{}, err
+		}
+	}
+
+	if max < min {
+		min, max = max, min
+	}
+
+	return intRange{min, max}, nil
+}
+
+// selected reports whether n was picked. Without any number or keyword
+// picked, everything that was not excluded is.
+func (m menuSelection) selected(n int) bool {
+	if m.exclude.get(n) {
+		return false
+	}
+
+	if len(m.include) == 0 && len(m.otherInclude) == 0 {
+		return len(m.exclude) > 0 || len(m.otherExclude) > 0
+	}
+
+	return m.include.get(n)
+}
+
+// addKeyword turns the keyword into the range of numbers it stands for,
+// honoring whether it was negated.
+func (m *menuSelection) addKeyword(keyword string, min int, max int) {
+	if max < min {
+		return
+	}
+
+	if m.otherInclude.get(keyword) {
+		m.include = append(m.include, intRange{min, max})
+	}
+	if m.otherExclude.get(keyword) {
+		m.exclude = append(m.exclude, intRange{min, max})
+	}
+}
+
+// takeOpen removes the o<n> words, asking to open the web page of entry n,
+// from the selection and returns their numbers.
+func (m menuSelection) takeOpen() []int {
+	var open []int
+	for word := range m.otherInclude {
+		if !strings.HasPrefix(word, "o") {
+			continue
+		}
+
+		n, err := strconv.Atoi(word[1:])
+		if err != nil {
+			continue
+		}
+
+		open = append(open, n)
+		m.otherInclude.remove(word)
+	}
+
+	sort.Ints(open)
+	return open
+}
+
+// readNumberMenuOpen reads a number menu like readNumberMenu, opening the
+// web page of entry n for every o<n> typed and asking again until a
+// selection is made.
+func readNumberMenuOpen(key string, keywords string, open func(n int)) (menuSelection, error) {
+	for {
+		menu, err := readNumberMenu(key, keywords+", o<n> to open a web page")
+		if err != nil {
+			return menu, err
+		}
+
+		numbers := menu.takeOpen()
+		for _, n := range numbers {
+			open(n)
+		}
+
+		// a predetermined answer would be the same again
+		if _, answered := answers[key]; len(numbers) == 0 || answered {
+			return menu, nil
+		}
+	}
+}
+
+// readNumberMenu prints the syntax of numbered menus and reads one. key
+// names the menu in answers files.
+func readNumberMenu(key string, keywords string) (menuSelection, error) {
+	fmt.Println(greenFg("(eg: 1 2 3, 1-3, ^4" + keywords + ")"))
+	fmt.Print("Numbers: ")
+
+	if response, ok := answer(key); ok {
+		return parseNumberMenu(response), nil
+	}
+
+	reader := bufio.NewReader(os.Stdin)
+	numberBuf, overflow, err := reader.ReadLine()
+	if err != nil {
+		return menuSelection{}, err
+	}
+	if overflow {
+		return menuSelection{}, fmt.Errorf("Input too long")
+	}
+
+	return parseNumberMenu(string(numberBuf)), nil
+}
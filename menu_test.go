@@ -0,0 +1,70 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestParseNumberMenu(t *testing.T) {
+	menus := []struct {
+		input    string
+		selected []int
+	}{
+		{"", nil},
+		{"1 3", []int{1, 3}},
+		{"1-3 ^2", []int{1, 3}},
+		{"4-2", []int{2, 3, 4}},
+		{"^2", []int{1, 3, 4, 5}},
+		{"^2-4", []int{1, 5}},
+	}
+
+	for _, menu := range menus {
+		m := parseNumberMenu(menu.input)
+
+		var selected []int
+		for n := 1; n <= 5; n++ {
+			if m.selected(n) {
+				selected = append(selected, n)
+			}
+		}
+
+		if len(selected) != len(menu.selected) {
+			t.Errorf("Expected %q to select %v, found %v", menu.input, menu.selected, selected)
+			continue
+		}
+		for i := range selected {
+			if selected[i] != menu.selected[i] {
+				t.Errorf("Expected %q to select %v, found %v", menu.input, menu.selected, selected)
+				break
+			}
+		}
+	}
+}
+
+func TestMenuKeywords(t *testing.T) {
+	m := parseNumberMenu("AUR ^3 abort")
+	if !m.otherInclude.get("aur") || !m.otherInclude.get("abort") {
+		t.Fatalf("Expected keywords aur and abort, found %v", m.otherInclude)
+	}
+
+	m.addKeyword("aur", 1, 4)
+	if !m.selected(1) || m.selected(3) || m.selected(5) {
+		t.Errorf("Expected 1-4 without 3 to be selected")
+	}
+}
+
+func TestTakeOpen(t *testing.T) {
+	m := parseNumberMenu("o3 1 O1 on all")
+	open := m.takeOpen()
+
+	if len(open) != 2 || open[0] != 1 || open[1] != 3 {
+		t.Errorf("Expected [1 3] to be opened, found %v", open)
+	}
+
+	if !m.otherInclude.get("on") || !m.otherInclude.get("all") || len(m.otherInclude) != 2 {
+		t.Errorf("Expected on and all to be left, found %v", m.otherInclude)
+	}
+
+	if !m.selected(1) || m.selected(3) {
+		t.Errorf("Expected takeOpen to leave the numbers alone")
+	}
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"html"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// newsFile holds the path of the GUIDs of the news items already shown.
+var newsFile string
+
+// newsItem is an item of the news feed.
+type newsItem struct {
+	Title       string `xml:"title"`
+	Link        string `xml:"link"`
+	Description string `xml:"description"`
+	PubDate     string `xml:"pubDate"`
+	GUID        string `xml:"guid"`
+}
+
+type newsFeed struct {
+	Items []newsItem `xml:"channel>item"`
+}
+
+func parseNews(content []byte) ([]newsItem, error) {
+	var feed newsFeed
+	if err := xml.Unmarshal(content, &feed); err != nil {
+		return nil, err
+	}
+
+	return feed.Items, nil
+}
+
+func getNews() ([]newsItem, error) {
+	client := http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Get(currentDistro().newsURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("news feed returned: %s", resp.Status)
+	}
+
+	content, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseNews(content)
+}
+
+var htmlTagRegex = regexp.MustCompile("<[^>]*>")
+
+// newsText turns the HTML description of a news item into plain text.
+func newsText(description string) string {
+	text := htmlTagRegex.ReplaceAllString(description, "")
+	text = html.UnescapeString(text)
+
+	var lines []string
+	for _, line := range strings.Split(text, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+func loadReadNews() stringSet {
+	read := make(stringSet)
+
+	in, err := os.Open(newsFile)
+	if err != nil {
+		return read
+	}
+	defer in.Close()
+
+	var guids []string
+	if json.NewDecoder(in).Decode(&guids) == nil {
+		for _, guid := range guids {
+			read.set(guid)
+		}
+	}
+
+	return read
+}
+
+// saveReadNews records the items of the feed that were shown. Items gone
+// from the feed are forgotten as they cannot show up again.
+func saveReadNews(items []newsItem, read stringSet) error {
+	guids := make([]string, 0, len(items))
+	for _, item := range items {
+		if read.get(item.GUID) {
+			guids = append(guids, item.GUID)
+		}
+	}
+
+	marshalledinfo, err := json.MarshalIndent(guids, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(newsFile, marshalledinfo, 0644)
+}
+
+// unreadNews returns the items of the feed that were not shown before,
+// oldest first.
+func unreadNews(items []newsItem, read stringSet) []newsItem {
+	var unread []newsItem
+	for i := len(items) - 1; i >= 0; i-- {
+		if !read.get(items[i].GUID) {
+			unread = append(unread, items[i])
+		}
+	}
+
+	return unread
+}
+
+func printNewsItem(item newsItem) {
+	date := item.PubDate
+	if t, err := time.Parse(time.RFC1123Z, item.PubDate); err == nil {
+		date = t.Format("2006-01-02")
+	}
+
+	fmt.Println(boldCyanFg("::"), boldFg(item.Title), yellowFg(date))
+	for _, line := range strings.Split(newsText(item.Description), "\n") {
+		fmt.Println("    " + line)
+	}
+	fmt.Println("    " + item.Link)
+	fmt.Println()
+}
+
+// printNews shows the news items of the distribution not shown before, or all of
+// them, and records them as read.
+func printNews(all bool) error {
+	items, err := getNews()
+	if err != nil {
+		return err
+	}
+
+	read := loadReadNews()
+	shown := unreadNews(items, read)
+	if all {
+		shown = unreadNews(items, make(stringSet))
+	}
+
+	if len(shown) == 0 {
+		fmt.Println(boldGreenFg(arrow), boldFg("No unread news"))
+		return nil
+	}
+
+	for _, item := range shown {
+		printNewsItem(item)
+		read.set(item.GUID)
+	}
+
+	return saveReadNews(items, read)
+}
+
+// printUpgradeNews shows the news items not shown before ahead of a system
+// upgrade, as they often call for manual intervention.
+func printUpgradeNews() {
+	items, err := getNews()
+	if err != nil {
+		fmt.Println(boldRedFgBlackBg(arrow+" Warning:"),
+			blackBg("Could not fetch the "+currentDistro().name+" news: "+err.Error()))
+		return
+	}
+
+	read := loadReadNews()
+	unread := unreadNews(items, read)
+	if len(unread) == 0 {
+		return
+	}
+
+	fmt.Println(boldCyanFg("::"), boldFg(currentDistro().name+" news since the last upgrade"))
+	fmt.Println()
+	for _, item := range unread {
+		printNewsItem(item)
+		read.set(item.GUID)
+	}
+
+	if err := saveReadNews(items, read); err != nil {
+		fmt.Println(err)
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import "testing"
+
+const testNewsFeed = `<?xml version="1.0" encoding="utf-8"?>
+<rss version="2.0"><channel><title>Arch Linux: Recent news updates</title>
+<item><title>Newer item</title><link>https://archlinux.org/news/newer/</link>
+<description>&lt;p&gt;Manual intervention &amp;amp; care&lt;/p&gt;
+&lt;p&gt;Second paragraph&lt;/p&gt;</description>
+<pubDate>Tue, 14 Oct 2025 10:00:00 +0000</pubDate><guid isPermaLink="false">tag:archlinux.org,2025-10-14:/news/newer/</guid></item>
+<item><title>Older item</title><link>https://archlinux.org/news/older/</link>
+<description>&lt;p&gt;Nothing to do&lt;/p&gt;</description>
+<pubDate>Mon, 01 Sep 2025 10:00:00 +0000</pubDate><guid isPermaLink="false">tag:archlinux.org,2025-09-01:/news/older/</guid></item>
+</channel></rss>`
+
+func TestParseNews(t *testing.T) {
+	items, err := parseNews([]byte(testNewsFeed))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(items) != 2 || items[0].Title != "Newer item" || items[1].GUID != "tag:archlinux.org,2025-09-01:/news/older/" {
+		t.Fatalf("Expected the newer and the older item, found %+v", items)
+	}
+
+	expected := "Manual intervention & care\nSecond paragraph"
+	if text := newsText(items[0].Description); text != expected {
+		t.Errorf("Expected %q, found %q", expected, text)
+	}
+}
+
+func TestUnreadNews(t *testing.T) {
+	items, err := parseNews([]byte(testNewsFeed))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	unread := unreadNews(items, make(stringSet))
+	if len(unread) != 2 || unread[0].Title != "Older item" {
+		t.Errorf("Expected every item oldest first, found %+v", unread)
+	}
+
+	read := make(stringSet)
+	read.set(items[1].GUID)
+	unread = unreadNews(items, read)
+	if len(unread) != 1 || unread[0].Title != "Newer item" {
+		t.Errorf("Expected the newer item only, found %+v", unread)
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"os/exec"
+)
+
+// officialRepos are the repos of Arch Linux, with package pages on
+// archlinux.org and packaging at archPackagingURL. Other distributions
+// have some of them, see distroInfo.
+var officialRepos = stringSet{
+	"core": {}, "extra": {}, "community": {}, "multilib": {},
+	"testing": {}, "community-testing": {}, "multilib-testing": {},
+	"core-testing": {}, "extra-testing": {},
+}
+
+// webPage returns the address of the web page of the package name: its
+// archlinux.org page for official repo packages, the upstream URL for
+// other repos and its AUR page otherwise.
+func webPage(name string) string {
+	dbList, err := alpmHandle.SyncDbs()
+	if err == nil {
+		for _, db := range dbList.Slice() {
+			pkg, err := db.PkgByName(name)
+			if err != nil {
+				continue
+			}
+
+			if currentDistro().archRepos.get(db.Name()) {
+				return "https://archlinux.org/packages/" + db.Name() + "/" +
+					pkg.Architecture() + "/" + name + "/"
+			}
+			return pkg.URL()
+		}
+	}
+
+	return config.AURURL + "/packages/" + url.PathEscape(name) + "/"
+}
+
+// openWebPage opens the web page of the package name in the browser.
+func openWebPage(name string) {
+	page := webPage(name)
+	fmt.Println(boldGreenFg(arrow), "Opening", page)
+
+	err := exec.Command("xdg-open", page).Start()
+	if err != nil {
+		fmt.Println("Unable to open", page+":", err)
+	}
+}
+
+// openPkgs opens the web pages of pkgs.
+func openPkgs(pkgs []string) error {
+	if len(pkgs) == 0 {
+		return fmt.Errorf("No packages to open")
+	}
+
+	for _, pkg := range pkgs {
+		openWebPage(pkg)
+	}
+
+	return nil
+}
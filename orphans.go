@@ -0,0 +1,178 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	alpm "github.com/jguer/go-alpm"
+)
+
+// orphans returns the installed packages that were installed as
+// dependencies but that nothing requires anymore, like pacman -Qdt.
+func orphans() ([]alpm.Package, error) {
+	localDb, err := alpmHandle.LocalDb()
+	if err != nil {
+		return nil, err
+	}
+
+	var pkgs []alpm.Package
+	err = localDb.PkgCache().ForEach(func(pkg alpm.Package) error {
+		if pkg.Reason() == alpm.PkgReasonDepend && len(pkg.ComputeRequiredBy()) == 0 {
+			pkgs = append(pkgs, pkg)
+		}
+		return nil
+	})
+
+	return pkgs, err
+}
+
+// unseenNames returns the names that are not in seen, adding them to it.
+func unseenNames(names []string, seen stringSet) []string {
+	var unseen []string
+	for _, name := range names {
+		if !seen.get(name) {
+			unseen = append(unseen, name)
+			seen.set(name)
+		}
+	}
+
+	return unseen
+}
+
+// orphanMenu lists the orphans in a numbered menu and removes the ones
+// picked. Removing packages can orphan their dependencies in turn, those
+// are offered in another round.
+func orphanMenu() error {
+	seen := make(stringSet)
+	first := true
+
+	for {
+		pkgs, err := orphans()
+		if err != nil {
+			return err
+		}
+
+		byName := make(map[string]alpm.Package)
+		names := make([]string, 0, len(pkgs))
+		for _, pkg := range pkgs {
+			byName[pkg.Name()] = pkg
+			names = append(names, pkg.Name())
+		}
+
+		names = unseenNames(names, seen)
+		if len(names) == 0 {
+			if first {
+				fmt.Println(boldGreenFg(arrow), boldFg("No orphans"))
+			}
+			return nil
+		}
+
+		if !first && !continueTask("neworphans", strconv.Itoa(len(names))+
+			" packages were left orphaned by the removal. Show them?", "nN") {
+			return nil
+		}
+		first = false
+
+		fmt.Println(boldCyanFg("::"), boldFg(strconv.Itoa(len(names))+" orphans, packages to remove?"))
+		for i, name := range names {
+			pkg := byName[name]
+			fmt.Print(yellowFg(fmt.Sprintf("%3d ", i+1)))
+			fmt.Println(boldWhiteFg(name), greenFg(pkg.Version()), yellowFg("("+human(pkg.ISize())+")"))
+			fmt.Println("    " + pkg.Description())
+		}
+
+		// like -Yc, --noconfirm removes every orphan
+		var menu menuSelection
+		if skipPrompt("orphans") {
+			menu = parseNumberMenu("all")
+		} else if menu, err = readNumberMenu("orphans", ", all, none or abort"); err != nil {
+			return err
+		}
+
+		if menu.otherInclude.get("abort") {
+			return fmt.Errorf("Aborting due to user")
+		}
+		menu.addKeyword("all", 1, len(names))
+
+		var remove []string
+		for i, name := range names {
+			if menu.selected(i + 1) {
+				remove = append(remove, name)
+			}
+		}
+
+		if len(remove) == 0 {
+			return nil
+		}
+
+		err = cleanRemove(remove)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// changesPackages tells whether running parser may install or remove
+// packages, and with them orphan others.
+func changesPackages(parser *arguments) bool {
+	switch parser.op {
+	case "R", "remove", "S", "sync", "U", "upgrade":
+		return parser.needRoot()
+	default:
+		return false
+	}
+}
+
+// orphanNames returns the names of the current orphans.
+func orphanNames() (stringSet, error) {
+	pkgs, err := orphans()
+	if err != nil {
+		return nil, err
+	}
+
+	names := make(stringSet)
+	for _, pkg := range pkgs {
+		names.set(pkg.Name())
+	}
+
+	return names, nil
+}
+
+// reportNewOrphans lists the packages orphaned since the orphans before
+// were taken note of, offering to remove them.
+func reportNewOrphans(before stringSet) error {
+	if err := reopenAlpmHandle(); err != nil {
+		return err
+	}
+
+	pkgs, err := orphans()
+	if err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(pkgs))
+	for _, pkg := range pkgs {
+		names = append(names, pkg.Name())
+	}
+
+	orphaned := unseenNames(names, before)
+	if len(orphaned) == 0 {
+		return nil
+	}
+
+	fmt.Println()
+	fmt.Println(boldCyanFg("::"), boldFg("Packages left orphaned:"), strings.Join(orphaned, "  "))
+
+	// removing packages unasked is not something to do on --noconfirm
+	if skipPrompt("orphaned") {
+		fmt.Println("Run yay -Y --orphans to remove them")
+		return nil
+	}
+
+	if continueTask("orphaned", "Remove them now?", "yY") {
+		return nil
+	}
+
+	return cleanRemove(orphaned)
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestUnseenNames(t *testing.T) {
+	seen := make(stringSet)
+
+	names := unseenNames([]string{"foo", "bar"}, seen)
+	if !reflect.DeepEqual(names, []string{"foo", "bar"}) {
+		t.Errorf("Expected foo and bar to be new, found %v", names)
+	}
+
+	// foo was kept, baz was orphaned by removing bar
+	names = unseenNames([]string{"foo", "baz"}, seen)
+	if !reflect.DeepEqual(names, []string{"baz"}) {
+		t.Errorf("Expected baz to be new, found %v", names)
+	}
+
+	if names := unseenNames([]string{"foo", "baz"}, seen); len(names) != 0 {
+		t.Errorf("Expected nothing new, found %v", names)
+	}
+}
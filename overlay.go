@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// overlayFiles lists the files in the overlay directory of a pkgbase,
+// relative to it: the patches to apply with git am, in name order, and
+// the files to copy over the checkout.
+func overlayFiles(overlay string) (patches []string, files []string, err error) {
+	err = filepath.Walk(overlay, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		name, err := filepath.Rel(overlay, path)
+		if err != nil {
+			return err
+		}
+
+		if strings.HasSuffix(name, ".patch") && !strings.Contains(name, "/") {
+			patches = append(patches, name)
+		} else {
+			files = append(files, name)
+		}
+		return nil
+	})
+
+	return
+}
+
+// copyOverlayFile copies src to dst, keeping its mode.
+func copyOverlayFile(src string, dst string) error {
+	info, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+
+	content, err := ioutil.ReadFile(src)
+	if err != nil {
+		return err
+	}
+
+	if err = os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(dst, content, info.Mode().Perm())
+}
+
+// applyOverlay commits the user's overlay of pkgbase on top of the
+// upstream checkout. Checkouts are moved back to upstream on every update
+// so the overlay is applied again to each new version. Checkouts with
+// local changes are left alone.
+func applyOverlay(pkgbase string) error {
+	overlay := filepath.Join(config.OverlayDir, pkgbase)
+	if _, err := os.Stat(overlay); os.IsNotExist(err) {
+		return nil
+	}
+
+	patches, files, err := overlayFiles(overlay)
+	if err != nil || len(patches)+len(files) == 0 {
+		return err
+	}
+
+	dir := config.BuildDir + pkgbase + "/"
+	head, err := gitCommand(dir, "rev-parse", "HEAD").Output()
+	if err != nil {
+		return err
+	}
+	upstream, err := gitCommand(dir, "rev-parse", gitUpstream).Output()
+	if err != nil {
+		return err
+	}
+
+	if string(head) != string(upstream) || gitModified(dir) {
+		fmt.Println(boldRedFgBlackBg(arrow+" Warning:"),
+			blackBg(pkgbase+" has local changes -- overlay not applied"))
+		return nil
+	}
+
+	for _, patch := range patches {
+		am := append(gitIdent, "am", "--quiet", "--3way", filepath.Join(overlay, patch))
+		if err := gitCommand(dir, am...).Run(); err != nil {
+			gitCommand(dir, "am", "--abort").Run()
+			gitCommand(dir, "reset", "--quiet", "--hard", gitUpstream).Run()
+			return fmt.Errorf("%s does not apply to %s anymore", patch, pkgbase)
+		}
+	}
+
+	if len(files) > 0 {
+		for _, file := range files {
+			if err := copyOverlayFile(filepath.Join(overlay, file), dir+file); err != nil {
+				gitCommand(dir, "reset", "--quiet", "--hard", gitUpstream).Run()
+				return err
+			}
+		}
+
+		add := append([]string{"add", "--force", "--"}, files...)
+		commit := append(gitIdent, "commit", "--quiet", "--allow-empty", "-m", "yay overlay")
+		if err := gitCommand(dir, add...).Run(); err != nil {
+			return err
+		}
+		if err := gitCommand(dir, commit...).Run(); err != nil {
+			return err
+		}
+	}
+
+	fmt.Println(boldGreenFg(arrow), boldFg("Applied overlay of "+pkgbase))
+	return nil
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestOverlayFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "yay-overlay")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, name := range []string{"0002-later.patch", "0001-first.patch", "config.h", "sub/extra.patch"} {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	patches, files, err := overlayFiles(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := []string{"0001-first.patch", "0002-later.patch"}; !reflect.DeepEqual(patches, expected) {
+		t.Errorf("Expected patches %v, found %v", expected, patches)
+	}
+	if expected := []string{"config.h", "sub/extra.patch"}; !reflect.DeepEqual(files, expected) {
+		t.Errorf("Expected files %v, found %v", expected, files)
+	}
+}
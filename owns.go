@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// maxOwnerSuggestions is how many packages of the repos and the AUR are
+// suggested by name at most for a file no package owns.
+const maxOwnerSuggestions = 10
+
+// handleQuery passes -Q to pacman and, for -Qo, suggests the packages
+// that may provide the files and commands no installed package owns.
+func handleQuery() error {
+	err := passToPacman(cmdArgs)
+	if err == nil || !cmdArgs.existsArg("o", "owns") {
+		return nil
+	}
+
+	targets := cmdArgs.targets.toSlice()
+	sort.Strings(targets)
+	for _, target := range targets {
+		if !isOwned(target) {
+			suggestOwners(target)
+		}
+	}
+
+	return nil
+}
+
+// isOwned reports whether an installed package owns target, a path or a
+// command looked up in PATH.
+func isOwned(target string) bool {
+	args := append(cmdArgs.formatGlobals(), "-Qqo", target)
+	return exec.Command(config.PacmanBin, args...).Run() == nil
+}
+
+// ownerFilePath returns the path to look for in the files databases for
+// target: commands are taken to live in /usr/bin.
+func ownerFilePath(target string) string {
+	if !strings.Contains(target, "/") {
+		return "/usr/bin/" + target
+	}
+
+	if abs, err := filepath.Abs(target); err == nil {
+		return abs
+	}
+	return target
+}
+
+// repoOwners returns the repo packages shipping path according to the
+// files databases, as repo/name.
+func repoOwners(path string) []string {
+	args := makeArguments()
+	args.op = "F"
+	args.addArg("q")
+	args.addTarget(path)
+
+	output, _ := pacmanOutput(args)
+	return strings.Fields(output)
+}
+
+// readCompletionNames returns the package names of the completion cache,
+// AUR and repo ones alike, or none when it was not created yet.
+func readCompletionNames() []string {
+	var names []string
+	for _, shell := range []string{"sh", "fish"} {
+		in, err := os.Open(completionFile + shell + ".cache")
+		if err != nil {
+			continue
+		}
+
+		scanner := bufio.NewScanner(in)
+		for scanner.Scan() {
+			if fields := strings.Fields(scanner.Text()); len(fields) > 0 {
+				names = append(names, fields[0])
+			}
+		}
+		in.Close()
+		break
+	}
+
+	return names
+}
+
+// likelyProviders returns the names likely to provide the command cmd: cmd
+// itself first, then its variants such as cmd-git or cmd-bin.
+func likelyProviders(cmd string, names []string) []string {
+	var exact []string
+	var variants []string
+	seen := make(stringSet)
+	for _, name := range names {
+		if seen.get(name) {
+			continue
+		}
+		seen.set(name)
+
+		if name == cmd {
+			exact = append(exact, name)
+		} else if strings.HasPrefix(name, cmd+"-") {
+			variants = append(variants, name)
+		}
+	}
+
+	sort.Strings(variants)
+	providers := append(exact, variants...)
+	if len(providers) > maxOwnerSuggestions {
+		providers = providers[:maxOwnerSuggestions]
+	}
+	return providers
+}
+
+// suggestOwners lists the repo packages the files databases say ship
+// target and the packages of the completion cache named after it.
+func suggestOwners(target string) {
+	path := ownerFilePath(target)
+	repo := repoOwners(path)
+	// the completion cache lists the names of the repos and the AUR
+	byName := likelyProviders(filepath.Base(path), readCompletionNames())
+
+	inRepos := make(stringSet)
+	for _, pkg := range repo {
+		inRepos.set(pkg[strings.Index(pkg, "/")+1:])
+	}
+
+	var others []string
+	for _, name := range byName {
+		if !inRepos.get(name) {
+			others = append(others, name)
+		}
+	}
+
+	if len(repo) == 0 && len(others) == 0 {
+		return
+	}
+
+	fmt.Println(boldCyanFg("::"), boldFg("Packages that may provide "+path+":"))
+	if len(repo) > 0 {
+		fmt.Println("    Repos:", strings.Join(repo, " "))
+	}
+	if len(others) > 0 {
+		fmt.Println("    By name:", strings.Join(others, " "))
+	}
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestOwnerFilePath(t *testing.T) {
+	if path := ownerFilePath("foo"); path != "/usr/bin/foo" {
+		t.Errorf("Expected foo to be looked up as /usr/bin/foo, found %q", path)
+	}
+	if path := ownerFilePath("/opt/foo/bin/foo"); path != "/opt/foo/bin/foo" {
+		t.Errorf("Expected /opt/foo/bin/foo to be kept, found %q", path)
+	}
+}
+
+func TestLikelyProviders(t *testing.T) {
+	names := []string{"foobar", "foo-git", "python-foo", "foo", "foo-bin", "foo-git", "bar"}
+
+	expected := []string{"foo", "foo-bin", "foo-git"}
+	if providers := likelyProviders("foo", names); !reflect.DeepEqual(providers, expected) {
+		t.Errorf("Expected %v, found %v", expected, providers)
+	}
+
+	if providers := likelyProviders("baz", names); len(providers) != 0 {
+		t.Errorf("Expected no providers, found %v", providers)
+	}
+}
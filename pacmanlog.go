@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// logChange is a package a transaction in pacman.log changed.
+type logChange struct {
+	action  string
+	name    string
+	old     string
+	new     string
+	logTime string
+}
+
+// pacmanTransaction is a transaction found in pacman.log, with the command
+// that ran it if pacman logged one.
+type pacmanTransaction struct {
+	started string
+	command string
+	changes []logChange
+}
+
+// parseLogLine splits a pacman.log line into its timestamp, the program
+// that logged it and the message.
+func parseLogLine(line string) (stamp, source, msg string, ok bool) {
+	if !strings.HasPrefix(line, "[") {
+		return
+	}
+
+	end := strings.Index(line, "] ")
+	if end == -1 {
+		return
+	}
+	stamp, line = line[1:end], line[end+2:]
+
+	if !strings.HasPrefix(line, "[") {
+		return
+	}
+	end = strings.Index(line, "] ")
+	if end == -1 {
+		return
+	}
+
+	return stamp, line[1:end], line[end+2:], true
+}
+
+// parseLogChange parses an ALPM message like "upgraded foo (1.0-1 -> 1.1-1)".
+func parseLogChange(msg string) (logChange, bool) {
+	fields := strings.SplitN(msg, " ", 3)
+	if len(fields) != 3 {
+		return logChange{}, false
+	}
+
+	switch fields[0] {
+	case "installed", "upgraded", "downgraded", "reinstalled", "removed":
+	default:
+		return logChange{}, false
+	}
+
+	versions := strings.TrimSuffix(strings.TrimPrefix(fields[2], "("), ")")
+	change := logChange{action: fields[0], name: fields[1]}
+
+	if from, to := splitArrow(versions); to != "" {
+		change.old, change.new = from, to
+	} else if fields[0] == "removed" {
+		change.old = versions
+	} else {
+		change.new = versions
+	}
+
+	return change, true
+}
+
+func splitArrow(versions string) (string, string) {
+	parts := strings.SplitN(versions, " -> ", 2)
+	if len(parts) != 2 {
+		return versions, ""
+	}
+
+	return parts[0], parts[1]
+}
+
+// parsePacmanLog reads the transactions logged by pacman, oldest first.
+func parsePacmanLog(r io.Reader) ([]pacmanTransaction, error) {
+	var txs []pacmanTransaction
+	var current *pacmanTransaction
+	command := ""
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		stamp, source, msg, ok := parseLogLine(scanner.Text())
+		if !ok {
+			continue
+		}
+
+		switch {
+		case source == "PACMAN" && strings.HasPrefix(msg, "Running '"):
+			command = strings.TrimSuffix(strings.TrimPrefix(msg, "Running '"), "'")
+		case source != "ALPM":
+		case msg == "transaction started":
+			txs = append(txs, pacmanTransaction{started: stamp, command: command})
+			current = &txs[len(txs)-1]
+		case msg == "transaction completed" || msg == "transaction interrupted":
+			current = nil
+			command = ""
+		default:
+			change, ok := parseLogChange(msg)
+			if !ok {
+				continue
+			}
+			change.logTime = stamp
+
+			// logs from before pacman noted transactions lack the markers
+			if current == nil {
+				txs = append(txs, pacmanTransaction{started: stamp, command: command})
+				current = &txs[len(txs)-1]
+			}
+			current.changes = append(current.changes, change)
+		}
+	}
+
+	// transactions that changed nothing are not worth listing
+	kept := txs[:0]
+	for _, tx := range txs {
+		if len(tx.changes) > 0 {
+			kept = append(kept, tx)
+		}
+	}
+
+	return kept, scanner.Err()
+}
+
+// printPacmanLog prints the last n transactions of pacman.log.
+func printPacmanLog(targets []string) error {
+	n := 10
+	if len(targets) > 0 {
+		var err error
+		n, err = strconv.Atoi(targets[0])
+		if err != nil || n < 1 {
+			return fmt.Errorf("Invalid number of transactions: %s", targets[0])
+		}
+	}
+
+	file, err := os.Open(alpmConf.LogFile)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	txs, err := parsePacmanLog(file)
+	if err != nil {
+		return err
+	}
+
+	if len(txs) > n {
+		txs = txs[len(txs)-n:]
+	}
+
+	for i, tx := range txs {
+		if i > 0 {
+			fmt.Println()
+		}
+
+		title := tx.started
+		if tx.command != "" {
+			title += " " + tx.command
+		}
+		fmt.Println(boldCyanFg("::"), boldFg(title))
+
+		rows := [][]string{{"Action", "Package", "Old Version", "New Version", "Time"}}
+		for _, change := range tx.changes {
+			rows = append(rows, []string{change.action, change.name, change.old, change.new, change.logTime})
+		}
+
+		lines := formatTable(rows)
+		fmt.Println(boldFg(lines[0]))
+		for _, line := range lines[1:] {
+			fmt.Println(line)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testPacmanLog = `[2025-10-01T10:00:00+0200] [PACMAN] Running 'pacman -Syu'
+[2025-10-01T10:00:01+0200] [PACMAN] synchronizing package lists
+[2025-10-01T10:00:05+0200] [ALPM] transaction started
+[2025-10-01T10:00:06+0200] [ALPM] upgraded foo (1.0-1 -> 1.1-1)
+[2025-10-01T10:00:06+0200] [ALPM-SCRIPTLET] some output
+[2025-10-01T10:00:07+0200] [ALPM] installed bar (2.0-1)
+[2025-10-01T10:00:08+0200] [ALPM] transaction completed
+[2025-10-02T09:00:00+0200] [PACMAN] Running 'pacman -R baz'
+[2025-10-02T09:00:01+0200] [ALPM] transaction started
+[2025-10-02T09:00:02+0200] [ALPM] removed baz (3.0-1)
+[2025-10-02T09:00:02+0200] [ALPM] transaction completed
+[2025-10-03T09:00:00+0200] [PACMAN] Running 'pacman -Sy'
+[2025-10-03T09:00:00+0200] [ALPM] transaction started
+[2025-10-03T09:00:00+0200] [ALPM] transaction completed
+`
+
+func TestParsePacmanLog(t *testing.T) {
+	txs, err := parsePacmanLog(strings.NewReader(testPacmanLog))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []pacmanTransaction{
+		{"2025-10-01T10:00:05+0200", "pacman -Syu", []logChange{
+			{"upgraded", "foo", "1.0-1", "1.1-1", "2025-10-01T10:00:06+0200"},
+			{"installed", "bar", "", "2.0-1", "2025-10-01T10:00:07+0200"},
+		}},
+		{"2025-10-02T09:00:01+0200", "pacman -R baz", []logChange{
+			{"removed", "baz", "3.0-1", "", "2025-10-02T09:00:02+0200"},
+		}},
+	}
+
+	if !reflect.DeepEqual(txs, expected) {
+		t.Errorf("Expected %+v, found %+v", expected, txs)
+	}
+}
+
+func TestParseLogChange(t *testing.T) {
+	change, ok := parseLogChange("downgraded foo (2.0-1 -> 1.0-1)")
+	if !ok || change != (logChange{action: "downgraded", name: "foo", old: "2.0-1", new: "1.0-1"}) {
+		t.Errorf("Expected foo to be downgraded from 2.0-1 to 1.0-1, found %+v, %t", change, ok)
+	}
+
+	if _, ok := parseLogChange("transaction started"); ok {
+		t.Error("Expected a message that is no change to be left out")
+	}
+}
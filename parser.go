@@ -1,9 +1,10 @@
 package main
 
 import (
+	"bufio"
 	"fmt"
-	"io"
 	"os"
+	"regexp"
 	"strings"
 )
 
@@ -47,6 +48,19 @@ func (set stringSet) removeAny() string {
 	return v
 }
 
+// splitNames turns a comma separated list, possibly given more than once,
+// into a set.
+func splitNames(value string) stringSet {
+	set := make(stringSet)
+	for _, name := range strings.FieldsFunc(value, func(r rune) bool {
+		return r == ',' || r == '\n'
+	}) {
+		set.set(strings.TrimSpace(name))
+	}
+
+	return set
+}
+
 type arguments struct {
 	op      string
 	options map[string]string
@@ -170,7 +184,9 @@ func (parser *arguments) addParam(option string, arg string) (err error) {
 		return
 	}
 
-	if parser.existsArg(option) {
+	if parser.existsArg(option) && isRepeatable(option) {
+		parser.options[option] += "\n" + arg
+	} else if parser.existsArg(option) {
 		parser.doubles[option] = struct{}{}
 	} else if isGlobal(option) {
 		parser.globals[option] = arg
@@ -271,6 +287,14 @@ func (parser *arguments) formatArgs() (args []string) {
 
 	for option, arg := range parser.options {
 		formatedOption := formatArg(option)
+
+		if isRepeatable(option) {
+			for _, value := range strings.Split(arg, "\n") {
+				args = append(args, formatedOption, value)
+			}
+			continue
+		}
+
 		args = append(args, formatedOption)
 
 		if hasParam(option) {
@@ -350,6 +374,10 @@ func isGlobal(op string) bool {
 		return true
 	case "r", "root":
 		return true
+	case "sysroot":
+		return true
+	case "ask":
+		return true
 	case "v", "verbose":
 		return true
 	case "arch":
@@ -398,6 +426,23 @@ func isYayParam(arg string) bool {
 	}
 }
 
+// isRepeatable reports whether every occurrence of option is kept instead
+// of doubling it. Their values are joined by newlines.
+func isRepeatable(option string) bool {
+	switch option {
+	case "assume-installed":
+		return true
+	case "ignore", "ignoregroup":
+		return true
+	case "overwrite":
+		return true
+	case "skipinteg", "skippgpcheck":
+		return true
+	default:
+		return false
+	}
+}
+
 func hasParam(arg string) bool {
 	switch arg {
 	case "dbpath", "b":
@@ -432,6 +477,60 @@ func hasParam(arg string) bool {
 		return true
 	case "color":
 		return true
+	case "config-makepkg":
+		return true
+	case "pacman":
+		return true
+	case "git", "gitflags":
+		return true
+	case "gpg", "gpgflags":
+		return true
+	case "keyserver":
+		return true
+	case "sandbox":
+		return true
+	case "buildbackend", "pkgctl", "pkgctlflags":
+		return true
+	case "container", "containerimage", "containerflags":
+		return true
+	case "makejobs":
+		return true
+	case "buildprofile":
+		return true
+	case "buildjobs":
+		return true
+	case "nice", "cpuquota":
+		return true
+	case "buildtimeout":
+		return true
+	case "answers":
+		return true
+	case "provider":
+		return true
+	case "distro":
+		return true
+	case "aurdeps":
+		return true
+	case "debugpkgs":
+		return true
+	case "onfailure":
+		return true
+	case "skipinteg", "skippgpcheck":
+		return true
+	case "addignore", "delignore":
+		return true
+	case "develinterval":
+		return true
+	case "dbmaxage":
+		return true
+	case "aurrpc":
+		return true
+	case "restore":
+		return true
+	case "maintainer":
+		return true
+	case "mirrorcmd", "mirrorage":
+		return true
 	default:
 		return false
 	}
@@ -491,20 +590,39 @@ func (parser *arguments) parseLongOption(arg string, param string) (usedNext boo
 	return
 }
 
-func (parser *arguments) parseStdin() (err error) {
-	for true {
-		var target string
-		_, err = fmt.Scan(&target)
+// versionRegex matches the versions pacman -Q prints, such as 1:2.0-1.
+var versionRegex = regexp.MustCompile(`^([0-9]+:)?[0-9][^-\s]*-[0-9.]+$`)
 
-		if err != nil {
-			if err == io.EOF {
-				err = nil
-			}
+// stdinTargets returns the targets on a line of a package list. Lines hold
+// whitespace separated names, or a name and a version like the output of
+// pacman -Q. Everything after a # is a comment.
+func stdinTargets(line string) []string {
+	if i := strings.Index(line, "#"); i != -1 {
+		line = line[:i]
+	}
 
-			return
-		}
+	fields := strings.Fields(line)
+	if len(fields) == 2 && versionRegex.MatchString(fields[1]) {
+		return fields[:1]
+	}
+
+	return fields
+}
 
-		parser.addTarget(target)
+func (parser *arguments) parseStdin() (err error) {
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		parser.addTarget(stdinTargets(scanner.Text())...)
+	}
+
+	err = scanner.Err()
+	if err != nil {
+		return
+	}
+
+	// prompts are answered from the terminal, like pacman does
+	if tty, errTty := os.Open("/dev/tty"); errTty == nil {
+		os.Stdin = tty
 	}
 
 	return
@@ -512,13 +630,36 @@ func (parser *arguments) parseStdin() (err error) {
 
 func (parser *arguments) parseCommandLine() (err error) {
 	args := os.Args[1:]
-	usedNext := false
 
 	if len(args) < 1 {
 		err = fmt.Errorf("no operation specified (use -h for help)")
 		return
 	}
 
+	err = parser.parseArgs(args)
+	if err != nil {
+		return
+	}
+
+	if parser.op == "" {
+		parser.op = "Y"
+	}
+
+	if cmdArgs.existsArg("-") {
+		err = cmdArgs.parseStdin()
+
+		if err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+// parseArgs parses command line arguments into parser.
+func (parser *arguments) parseArgs(args []string) (err error) {
+	usedNext := false
+
 	for k, arg := range args {
 		var nextArg string
 
@@ -546,17 +687,5 @@ func (parser *arguments) parseCommandLine() (err error) {
 		}
 	}
 
-	if parser.op == "" {
-		parser.op = "Y"
-	}
-
-	if cmdArgs.existsArg("-") {
-		err = cmdArgs.parseStdin()
-
-		if err != nil {
-			return
-		}
-	}
-
 	return
 }
@@ -0,0 +1,59 @@
+package main
+
+import "testing"
+
+func TestStdinTargets(t *testing.T) {
+	lines := []struct {
+		line    string
+		targets []string
+	}{
+		{"", nil},
+		{"# comment", nil},
+		{"foo bar baz", []string{"foo", "bar", "baz"}},
+		{"yay 2.297-1", []string{"yay"}},
+		{"python 1:3.6.4-2 # pinned", []string{"python"}},
+		{"0ad 0ad-data", []string{"0ad", "0ad-data"}},
+		{"foo git", []string{"foo", "git"}},
+	}
+
+	for _, test := range lines {
+		targets := stdinTargets(test.line)
+		if len(targets) != len(test.targets) {
+			t.Errorf("Expected %q to give %v, found %v", test.line, test.targets, targets)
+			continue
+		}
+		for i := range targets {
+			if targets[i] != test.targets[i] {
+				t.Errorf("Expected %q to give %v, found %v", test.line, test.targets, targets)
+			}
+		}
+	}
+}
+
+func TestSplitNames(t *testing.T) {
+	set := splitNames("foo,bar\nbaz, qux")
+	for _, name := range []string{"foo", "bar", "baz", "qux"} {
+		if !set.get(name) {
+			t.Errorf("Expected %s in %v", name, set)
+		}
+	}
+
+	if len(set) != 4 {
+		t.Errorf("Expected 4 names, found %v", set)
+	}
+}
+
+func TestParseMaintainer(t *testing.T) {
+	parser := makeArguments()
+	err := parser.parseArgs([]string{"-P", "--maintainer", "foo"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if user, _, _ := parser.getArg("maintainer"); user != "foo" {
+		t.Errorf("Expected foo as the maintainer, found %q", user)
+	}
+	if len(parser.targets) != 0 {
+		t.Errorf("Expected no targets, found %v", parser.targets)
+	}
+}
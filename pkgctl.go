@@ -0,0 +1,234 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	alpm "github.com/jguer/go-alpm"
+	rpc "github.com/mikkeloscar/aur"
+)
+
+// Backends AUR packages can be built with
+const (
+	BackendMakepkg   = "makepkg"
+	BackendPkgctl    = "pkgctl"
+	BackendContainer = "container"
+)
+
+// validBuildBackend reports whether backend is a supported build backend.
+func validBuildBackend(backend string) bool {
+	switch backend {
+	case BackendMakepkg, BackendPkgctl, BackendContainer:
+		return true
+	default:
+		return false
+	}
+}
+
+// parsePkgFileName splits a package file name like
+// foo-1.0-1-x86_64.pkg.tar.zst into the package name, its version and its
+// architecture.
+func parsePkgFileName(file string) (name string, version string, arch string, ok bool) {
+	file = filepath.Base(file)
+	i := strings.Index(file, ".pkg.tar")
+	if i == -1 || strings.HasSuffix(file, ".sig") {
+		return "", "", "", false
+	}
+
+	fields := strings.Split(file[:i], "-")
+	if len(fields) < 4 {
+		return "", "", "", false
+	}
+
+	n := len(fields)
+	return strings.Join(fields[:n-3], "-"), fields[n-3] + "-" + fields[n-2], fields[n-1], true
+}
+
+// findPkgFile returns the newest package file of name in the directories
+// matching pattern, at version and built for arch or any architecture
+// unless they are empty.
+func findPkgFile(pattern string, name string, version string, arch string) string {
+	matches, _ := filepath.Glob(pattern + "/" + name + "-*.pkg.tar*")
+
+	found := ""
+	var newest int64
+	for _, match := range matches {
+		n, v, a, ok := parsePkgFileName(match)
+		if !ok || n != name || (version != "" && v != version) {
+			continue
+		}
+		if arch != "" && a != arch && a != "any" {
+			continue
+		}
+
+		info, err := os.Stat(match)
+		if err == nil && info.ModTime().Unix() >= newest {
+			found, newest = match, info.ModTime().Unix()
+		}
+	}
+
+	return found
+}
+
+// chrootDeps are the foreign packages a clean chroot or container build
+// of a pkgbase needs, as those can only get repo packages themselves:
+// packages built in this run, whose files only exist once they are built,
+// and the files of packages installed before.
+type chrootDeps struct {
+	built []*rpc.Pkg
+	files []string
+}
+
+// chrootDepsOf holds the chrootDeps of the pkgbases of the run. It is
+// filled before the builds start, which may run at the same time.
+var chrootDepsOf = make(map[string]chrootDeps)
+
+// findChrootDeps finds the foreign packages pkgbase needs, and the ones
+// they need in turn. Installed packages are looked up in the local
+// database and their files in the build directories.
+func findChrootDeps(pkgbase string, bases map[string][]*rpc.Pkg) (chrootDeps, error) {
+	var deps chrootDeps
+
+	dbList, err := alpmHandle.SyncDbs()
+	if err != nil {
+		return deps, err
+	}
+	localDb, err := alpmHandle.LocalDb()
+	if err != nil {
+		return deps, err
+	}
+
+	runPkgs := make(map[string]*rpc.Pkg)
+	for _, splits := range bases {
+		for _, split := range splits {
+			runPkgs[split.Name] = split
+		}
+	}
+
+	seen := make(stringSet)
+	var visit func(dep string)
+	visit = func(dep string) {
+		if _, err := dbList.FindSatisfier(dep); err == nil {
+			return
+		}
+
+		name := getNameFromDep(dep)
+		if provider, ok := sonameProviders[name]; ok {
+			name = provider
+		}
+		if seen.get(name) {
+			return
+		}
+		seen.set(name)
+
+		if pkg, ok := runPkgs[name]; ok {
+			// built after pkgbase to break a cycle
+			if stagedDeps[pkgbase].get(pkg.PackageBase) {
+				return
+			}
+			if pkg.PackageBase != pkgbase {
+				deps.built = append(deps.built, pkg)
+			}
+			for _, dep := range pkg.Depends {
+				visit(dep)
+			}
+			return
+		}
+
+		pkg, err := localDb.PkgCache().FindSatisfier(dep)
+		if err != nil {
+			return
+		}
+		seen.set(pkg.Name())
+
+		// what is installed here is of no use to cross builds, any version
+		// built for their architecture before will do
+		file := findPkgFile(config.BuildDir+"*", pkg.Name(), pkg.Version(), "")
+		if crossArch != "" {
+			file = findPkgFile(config.BuildDir+"*", pkg.Name(), "", crossArch)
+		}
+		if file == "" {
+			fmt.Println(boldRedFgBlackBg(arrow+" Warning:"),
+				blackBg("No package file of "+pkg.Name()+"-"+pkg.Version()+" to install in the chroot of "+pkgbase))
+		} else {
+			deps.files = append(deps.files, file)
+		}
+		pkg.Depends().ForEach(func(dep alpm.Depend) error {
+			visit(dep.String())
+			return nil
+		})
+	}
+
+	for _, split := range bases[pkgbase] {
+		for _, list := range [2][]string{split.Depends, split.MakeDepends} {
+			for _, dep := range list {
+				visit(dep)
+			}
+		}
+	}
+
+	return deps, nil
+}
+
+// prepareChrootBuilds fills chrootDepsOf for pkgs when they are built with
+// pkgctl or in a container.
+func prepareChrootBuilds(pkgs []*rpc.Pkg, bases map[string][]*rpc.Pkg) error {
+	if config.BuildBackend == BackendMakepkg {
+		return nil
+	}
+
+	for _, pkg := range pkgs {
+		deps, err := findChrootDeps(pkg.PackageBase, bases)
+		if err != nil {
+			return err
+		}
+		chrootDepsOf[pkg.PackageBase] = deps
+	}
+
+	return nil
+}
+
+// pkgctlCommand prepares a clean chroot build of the PKGBUILD in dir with
+// pkgctl from devtools, installing files into the chroot first.
+func pkgctlCommand(dir string, files []string) *exec.Cmd {
+	args := append([]string{"build"}, strings.Fields(config.PkgctlFlags)...)
+	for _, file := range files {
+		args = append(args, "--install-to-chroot", file)
+	}
+
+	cmd := exec.Command(config.PkgctlBin, args...)
+	cmd.Dir = dir
+	return cmd
+}
+
+// buildCommand prepares the build of pkg's pkgbase in dir with the
+// configured backend, makepkg taking args.
+func buildCommand(pkg *rpc.Pkg, dir string, args []string) (*exec.Cmd, error) {
+	if config.BuildBackend == BackendMakepkg {
+		return sandboxedMakepkgCommand(dir, args...), nil
+	}
+
+	deps := chrootDepsOf[pkg.PackageBase]
+	files := append([]string(nil), deps.files...)
+	for _, dep := range deps.built {
+		file := findPkgFile(config.BuildDir+dep.PackageBase, dep.Name, "", crossArch)
+		if file == "" {
+			return nil, fmt.Errorf("Could not find the built package of %s", dep.Name)
+		}
+		files = append(files, file)
+	}
+
+	if config.BuildBackend == BackendContainer {
+		return containerCommand(dir, args, files), nil
+	}
+
+	if checks := skippedChecks(pkg.PackageBase); len(checks) > 0 {
+		fmt.Println(boldRedFgBlackBg(arrow+" Warning:"),
+			blackBg("pkgctl cannot build "+pkg.PackageBase+" with "+strings.Join(checks, " ")+" -- checking anyway"))
+	}
+
+	return pkgctlCommand(dir, files), nil
+}
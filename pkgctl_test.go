@@ -0,0 +1,26 @@
+package main
+
+import "testing"
+
+func TestParsePkgFileName(t *testing.T) {
+	tests := []struct {
+		file    string
+		name    string
+		version string
+		arch    string
+		ok      bool
+	}{
+		{"/build/foo/foo-1.0-1-x86_64.pkg.tar.zst", "foo", "1.0-1", "x86_64", true},
+		{"foo-bar-git-r12.abc-2-any.pkg.tar.xz", "foo-bar-git", "r12.abc-2", "any", true},
+		{"foo-1:2.0-3-aarch64.pkg.tar.zst", "foo", "1:2.0-3", "aarch64", true},
+		{"foo-1.0-1-x86_64.pkg.tar.zst.sig", "", "", "", false},
+		{"PKGBUILD", "", "", "", false},
+	}
+
+	for _, test := range tests {
+		name, version, arch, ok := parsePkgFileName(test.file)
+		if name != test.name || version != test.version || arch != test.arch || ok != test.ok {
+			t.Errorf("Expected %s to give %q %q %q %t, found %q %q %q %t", test.file, test.name, test.version, test.arch, test.ok, name, version, arch, ok)
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	rpc "github.com/mikkeloscar/aur"
+)
+
+// isBinaryRepo reports whether the sync database name is one of the
+// binary repos, which ship prebuilt AUR packages and only stand in for
+// the AUR.
+func isBinaryRepo(name string) bool {
+	for _, repo := range config.BinaryRepos {
+		if repo == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// binaryRepoPkg finds name in the binary repos, in the order they are
+// configured, and returns the repo that has it with its version.
+func binaryRepoPkg(name string) (repo string, version string, ok bool) {
+	for _, repo := range config.BinaryRepos {
+		db, err := alpmHandle.SyncDbByName(repo)
+		if err != nil {
+			continue
+		}
+
+		if pkg, err := db.PkgByName(name); err == nil {
+			return repo, pkg.Version(), true
+		}
+	}
+
+	return "", "", false
+}
+
+// prebuiltBases returns the repo/name targets that can be installed
+// instead of building each pkgbase of bases. A pkgbase qualifies when
+// lookup finds every one of its packages at the version the AUR has, and
+// none of them depends on a pkgbase of bases that is still to be built:
+// prebuilt packages are installed before the builds start.
+func prebuiltBases(bases map[string][]*rpc.Pkg, lookup func(string) (string, string, bool)) map[string][]string {
+	prebuilt := make(map[string][]string)
+
+outer:
+	for base, pkgs := range bases {
+		var targets []string
+		for _, pkg := range pkgs {
+			repo, version, ok := lookup(pkg.Name)
+			if !ok || version != pkg.Version {
+				continue outer
+			}
+			targets = append(targets, repo+"/"+pkg.Name)
+		}
+
+		if len(targets) > 0 {
+			prebuilt[base] = targets
+		}
+	}
+
+	provider := baseProviders(bases)
+	needsBuilt := func(base string) bool {
+		for _, pkg := range bases[base] {
+			for _, dep := range pkg.Depends {
+				depBase, ok := provider[getNameFromDep(dep)]
+				if ok && depBase != base && prebuilt[depBase] == nil {
+					return true
+				}
+			}
+		}
+		return false
+	}
+
+	// leaving out a pkgbase can leave out the ones depending on it
+	for changed := true; changed; {
+		changed = false
+		for base := range prebuilt {
+			if needsBuilt(base) {
+				delete(prebuilt, base)
+				changed = true
+			}
+		}
+	}
+
+	return prebuilt
+}
+
+// askPrebuilt offers to install the AUR packages of dc the binary repos
+// have at the same version instead of building them. The accepted
+// pkgbases are dropped from dc and their targets returned. Cross builds
+// are never offered packages of this machine.
+func askPrebuilt(dc *depCatagories) []string {
+	if len(config.BinaryRepos) == 0 || crossArch != "" {
+		return nil
+	}
+
+	prebuilt := prebuiltBases(dc.Bases, binaryRepoPkg)
+	if len(prebuilt) == 0 {
+		return nil
+	}
+
+	bases := make([]string, 0, len(prebuilt))
+	for base := range prebuilt {
+		bases = append(bases, base)
+	}
+	sort.Strings(bases)
+
+	fmt.Println(boldCyanFg("::"), boldFg("Prebuilt packages of the same version are available:"))
+	for _, base := range bases {
+		fmt.Println("    " + strings.Join(prebuilt[base], " "))
+	}
+	if !continueTask("prebuilt", "Install them instead of building?", "nN") {
+		return nil
+	}
+
+	var targets []string
+	for _, base := range bases {
+		removeAurBase(dc, base)
+		targets = append(targets, prebuilt[base]...)
+	}
+
+	return targets
+}
+
+// installPrebuilt installs the prebuilt targets, with the install reason
+// built packages would get.
+func installPrebuilt(targets []string, parser *arguments) error {
+	localDb, err := alpmHandle.LocalDb()
+	if err != nil {
+		return err
+	}
+
+	var explicit, deps []string
+	for _, target := range targets {
+		name := target[strings.Index(target, "/")+1:]
+		if installAsDep(name, parser.targets, parser, localDb) {
+			deps = append(deps, target)
+		} else {
+			explicit = append(explicit, target)
+		}
+	}
+
+	oldConfirm := config.NoConfirm
+	config.NoConfirm = true
+	defer func() { config.NoConfirm = oldConfirm }()
+
+	for _, group := range []struct {
+		targets []string
+		reason  string
+	}{
+		{explicit, "asexplicit"},
+		{deps, "asdeps"},
+	} {
+		if len(group.targets) == 0 {
+			continue
+		}
+
+		arguments := parser.copy()
+		arguments.delArg("u", "sysupgrade")
+		arguments.delArg("y", "refresh")
+		arguments.delArg("asdeps", "asexplicit")
+		arguments.op = "S"
+		arguments.targets = make(stringSet)
+		arguments.addArg(group.reason)
+		arguments.addTarget(group.targets...)
+
+		if err := passToPacman(arguments); err != nil {
+			return fmt.Errorf("Error installing prebuilt packages")
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	rpc "github.com/mikkeloscar/aur"
+)
+
+func TestPrebuiltBases(t *testing.T) {
+	bases := map[string][]*rpc.Pkg{
+		"foo":   {{Name: "foo", PackageBase: "foo", Version: "1.0-1"}},
+		"split": {{Name: "split-a", PackageBase: "split", Version: "2-1"}, {Name: "split-b", PackageBase: "split", Version: "2-1"}},
+		"stale": {{Name: "stale", PackageBase: "stale", Version: "3-1"}},
+	}
+
+	repo := map[string]string{
+		"foo":     "1.0-1",
+		"split-a": "2-1",
+		"stale":   "2-1",
+	}
+	lookup := func(name string) (string, string, bool) {
+		version, ok := repo[name]
+		return "chaotic-aur", version, ok
+	}
+
+	expected := map[string][]string{"foo": {"chaotic-aur/foo"}}
+	if found := prebuiltBases(bases, lookup); !reflect.DeepEqual(found, expected) {
+		t.Errorf("Expected %v, found %v", expected, found)
+	}
+
+	repo["split-b"] = "2-1"
+	expected["split"] = []string{"chaotic-aur/split-a", "chaotic-aur/split-b"}
+	if found := prebuiltBases(bases, lookup); !reflect.DeepEqual(found, expected) {
+		t.Errorf("Expected %v, found %v", expected, found)
+	}
+}
+
+func TestPrebuiltBasesBuiltDeps(t *testing.T) {
+	bases := map[string][]*rpc.Pkg{
+		"app":     {{Name: "app", PackageBase: "app", Version: "1-1", Depends: []string{"lib>=1", "glibc"}}},
+		"lib":     {{Name: "lib", PackageBase: "lib", Version: "1-1", Depends: []string{"built"}}},
+		"built":   {{Name: "built", PackageBase: "built", Version: "1-1"}},
+		"tool":    {{Name: "tool", PackageBase: "tool", Version: "1-1", MakeDepends: []string{"built"}}},
+		"plugins": {{Name: "plugin", PackageBase: "plugins", Version: "1-1", Depends: []string{"tool"}}},
+	}
+
+	lookup := func(name string) (string, string, bool) {
+		if name == "built" {
+			return "", "", false
+		}
+		return "chaotic-aur", "1-1", true
+	}
+
+	expected := map[string][]string{
+		"tool":    {"chaotic-aur/tool"},
+		"plugins": {"chaotic-aur/plugin"},
+	}
+	if found := prebuiltBases(bases, lookup); !reflect.DeepEqual(found, expected) {
+		t.Errorf("Expected %v, found %v", expected, found)
+	}
+}
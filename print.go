@@ -2,7 +2,9 @@ package main
 
 import (
 	"fmt"
+	"net/url"
 	"os"
+	"sort"
 	"strconv"
 	"strings"
 
@@ -53,6 +55,10 @@ func (q aurQuery) printSearch(start int) {
 			toprint += redFgBlackBg("(Out-of-date)") + " "
 		}
 
+		if savedVotes.get(res.PackageBase) {
+			toprint += greenFgBlackBg("(Voted)") + " "
+		}
+
 		if _, err := localDb.PkgByName(res.Name); err == nil {
 			toprint += greenFgBlackBg("Installed")
 		}
@@ -96,6 +102,11 @@ func (s repoQuery) printSearch() {
 
 // printDownloadsFromRepo prints repository packages to be downloaded
 func printDepCatagories(dc *depCatagories) {
+	if alpmConf.Options&alpm.ConfVerbosePkgLists > 0 {
+		printVerboseDepCatagories(dc)
+		return
+	}
+
 	repo := ""
 	repoMake := ""
 	aur := ""
@@ -149,6 +160,14 @@ func printDepCatagories(dc *depCatagories) {
 			push = true
 		}
 
+		if d, ok := estimateBuildTime(pkg.PackageBase); ok {
+			if push {
+				pkgStr += " ~" + formatEstimate(d)
+			} else {
+				pkgStrMake += " ~" + formatEstimate(d)
+			}
+		}
+
 		if push {
 			aur += pkgStr
 		}
@@ -161,6 +180,145 @@ func printDepCatagories(dc *depCatagories) {
 	printDownloads("Repo Make", repoMakeLen, repoMake)
 	printDownloads("Aur", aurLen, aur)
 	printDownloads("Aur Make", aurMakeLen, aurMake)
+	printBuildEstimate(dc)
+}
+
+// printVerboseDepCatagories prints the packages to install as a table like
+// pacman does with VerbosePkgLists.
+func printVerboseDepCatagories(dc *depCatagories) {
+	localDb, err := alpmHandle.LocalDb()
+	if err != nil {
+		return
+	}
+
+	oldVersion := func(name string) string {
+		if pkg, err := localDb.PkgByName(name); err == nil {
+			return pkg.Version()
+		}
+		return ""
+	}
+
+	kind := func(source, name string) string {
+		if dc.MakeOnly.get(name) {
+			return source + " make"
+		}
+		return source
+	}
+
+	rows := [][]string{{"Package", "Old Version", "New Version", "Type", "Build Time"}}
+	for _, pkg := range dc.Repo {
+		rows = append(rows, []string{pkg.DB().Name() + "/" + pkg.Name(),
+			oldVersion(pkg.Name()), pkg.Version(), kind("repo", pkg.Name()), ""})
+	}
+
+	estimated := false
+	for _, pkg := range dc.Aur {
+		estimate := ""
+		if d, ok := estimateBuildTime(pkg.PackageBase); ok {
+			estimate = "~" + formatEstimate(d)
+			estimated = true
+		}
+
+		// the estimate is for the whole pkgbase, shown with its first package
+		for _, split := range dc.Bases[pkg.PackageBase] {
+			rows = append(rows, []string{"aur/" + split.Name,
+				oldVersion(split.Name), split.Version, kind("aur", split.Name), estimate})
+			estimate = ""
+		}
+	}
+
+	if len(rows) == 1 {
+		return
+	}
+
+	if !estimated {
+		for i := range rows {
+			rows[i] = rows[i][:4]
+		}
+	}
+
+	lines := formatTable(rows)
+	fmt.Println(boldFg(lines[0]))
+	fmt.Println()
+	for _, line := range lines[1:] {
+		fmt.Println(line)
+	}
+	if estimated {
+		fmt.Println()
+		printBuildEstimate(dc)
+	}
+}
+
+// formatTable pads the columns of rows to line up.
+func formatTable(rows [][]string) []string {
+	widths := make([]int, 0)
+	for _, row := range rows {
+		for i, cell := range row {
+			if i == len(widths) {
+				widths = append(widths, 0)
+			}
+			if len(cell) > widths[i] {
+				widths[i] = len(cell)
+			}
+		}
+	}
+
+	lines := make([]string, 0, len(rows))
+	for _, row := range rows {
+		line := ""
+		for i, cell := range row {
+			if i == len(row)-1 {
+				line += cell
+			} else {
+				line += cell + strings.Repeat(" ", widths[i]-len(cell)+2)
+			}
+		}
+		lines = append(lines, strings.TrimRight(line, " "))
+	}
+
+	return lines
+}
+
+// progressBar draws done out of total steps, with pacman's ILoveCandy
+// style if it is set in pacman.conf.
+func progressBar(done, total, width int, candy bool) string {
+	if total < 1 {
+		total = 1
+	}
+	filled := width * done / total
+
+	if !candy {
+		return "[" + strings.Repeat("#", filled) + strings.Repeat("-", width-filled) + "]"
+	}
+
+	bar := strings.Repeat("-", filled)
+	if filled < width {
+		// the mouth opens and closes as it moves, eating pellets that
+		// stay in place
+		if filled%2 == 0 {
+			bar += "C"
+		} else {
+			bar += "c"
+		}
+		for i := filled + 1; i < width; i++ {
+			if i%3 == 0 {
+				bar += "o"
+			} else {
+				bar += " "
+			}
+		}
+	}
+
+	return "[" + bar + "]"
+}
+
+// printProgress prints a step of a multi-package task, like pacman's
+// "(1/3) installing foo" lines.
+func printProgress(done, total int, str string) {
+	count := strconv.Itoa(total)
+	step := fmt.Sprintf("(%*d/%s)", len(count), done, count)
+	bar := progressBar(done, total, 20, alpmConf.Options&alpm.ConfILoveCandy > 0)
+	fmt.Println(boldFg(step), str, bar)
 }
 
 func printDownloads(repoName string, length int, packages string) {
@@ -193,8 +351,12 @@ func printDeps(repoDeps []string, aurDeps []string) {
 
 // PrintInfo prints package info like pacman -Si.
 func PrintInfo(a *rpc.Pkg) {
+	base := config.AURURL + "/cgit/aur.git"
+	query := "?h=" + url.QueryEscape(a.PackageBase)
+
 	fmt.Println(boldWhiteFg("Repository      :"), "aur")
 	fmt.Println(boldWhiteFg("Name            :"), a.Name)
+	fmt.Println(boldWhiteFg("Package Base    :"), a.PackageBase)
 	fmt.Println(boldWhiteFg("Version         :"), a.Version)
 	fmt.Println(boldWhiteFg("Description     :"), a.Description)
 	fmt.Println(boldWhiteFg("URL             :"), a.URL)
@@ -205,14 +367,32 @@ func PrintInfo(a *rpc.Pkg) {
 	fmt.Println(boldWhiteFg("Conflicts With  :"), strings.Join(a.Conflicts, "  "))
 	fmt.Println(boldWhiteFg("Maintainer      :"), a.Maintainer)
 	fmt.Println(boldWhiteFg("Votes           :"), a.NumVotes)
+	if config.AURSession != "" {
+		if voted, err := votedFor(a.PackageBase); err == nil {
+			fmt.Println(boldWhiteFg("Voted           :"), yesNo(voted))
+		}
+	} else if savedVotes.get(a.PackageBase) {
+		fmt.Println(boldWhiteFg("Voted           :"), "Yes")
+	}
 	fmt.Println(boldWhiteFg("Popularity      :"), a.Popularity)
 	if a.OutOfDate != 0 {
 		fmt.Println(boldWhiteFg("Out-of-date     :"), "Yes")
 	}
+	fmt.Println(boldWhiteFg("AUR URL         :"), config.AURURL+"/pkgbase/"+url.PathEscape(a.PackageBase)+"/")
+	fmt.Println(boldWhiteFg("Git Clone URL   :"), config.AURURL+"/"+a.PackageBase+".git")
+	fmt.Println(boldWhiteFg("PKGBUILD        :"), base+"/tree/PKGBUILD"+query)
+	fmt.Println(boldWhiteFg("Log             :"), base+"/log/"+query)
 
 	fmt.Println()
 }
 
+func yesNo(b bool) string {
+	if b {
+		return "Yes"
+	}
+	return "No"
+}
+
 // BiggestPackages prints the name of the ten biggest packages in the system.
 func biggestPackages() {
 	localDb, err := alpmHandle.LocalDb()
@@ -263,7 +443,7 @@ func localStatistics() error {
 		if j < 0 {
 			j = 0
 		}
-		qtemp, err := rpc.Info(remoteNames[j:i])
+		qtemp, err := aurInfo(remoteNames[j:i])
 		q = append(q, qtemp...)
 		if err != nil {
 			return err
@@ -304,13 +484,38 @@ func localStatistics() error {
 			boldYellowFgBlackBg(res), whiteFgBlackBg("is not available in AUR"))
 	}
 
+	// Scanning every installed file is slow, only do it when asked
+	if cmdArgs.existsArg("broken") {
+		broken, err := brokenPackages()
+		if err != nil {
+			fmt.Println(boldRedFgBlackBg(arrow+"Warning:"),
+				whiteFgBlackBg("could not check for broken packages: "+err.Error()))
+		}
+		for _, pkg := range broken {
+			fmt.Println(boldRedFgBlackBg(arrow+"Warning:"),
+				boldYellowFgBlackBg(pkg.name), whiteFgBlackBg("needs a rebuild, missing: "+strings.Join(pkg.missing, " ")))
+		}
+	}
+
+	if config.SecurityCheck {
+		fmt.Println(boldCyanFg("==========================================="))
+		fmt.Println(boldGreenFg("Security advisories"))
+		err = printSecurity()
+		if err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
 //todo make pretty
 func printMissing(missing stringSet) {
-	fmt.Print("Packages not found in repos or aur:")
-	for pkg := range missing {
+	names := missing.toSlice()
+	sort.Strings(names)
+
+	fmt.Print(boldRedFgBlackBg(arrow+" Packages not found in repos or aur:"))
+	for _, pkg := range names {
 		fmt.Print(" ", pkg)
 	}
 	fmt.Println()
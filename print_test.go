@@ -34,3 +34,45 @@ func BenchmarkPrintSearchComplexBottomUp(b *testing.B) {
 	config.SortMode = BottomUp
 	benchmarkPrintSearch("linux", b)
 }
+
+func TestFormatTable(t *testing.T) {
+	lines := formatTable([][]string{
+		{"Package", "Old Version", "New Version"},
+		{"core/linux", "4.15-1", "4.16-1"},
+		{"aur/yay", "", "5.0-1"},
+	})
+
+	expected := []string{
+		"Package     Old Version  New Version",
+		"core/linux  4.15-1       4.16-1",
+		"aur/yay                  5.0-1",
+	}
+
+	for i := range expected {
+		if lines[i] != expected[i] {
+			t.Errorf("Expected line %d to be %q, found %q", i, expected[i], lines[i])
+		}
+	}
+}
+
+func TestProgressBar(t *testing.T) {
+	tests := []struct {
+		done, total int
+		candy       bool
+		expected    string
+	}{
+		{0, 2, false, "[----------]"},
+		{1, 2, false, "[#####-----]"},
+		{2, 2, false, "[##########]"},
+		{0, 2, true, "[C  o  o  o]"},
+		{1, 2, true, "[-----co  o]"},
+		{2, 2, true, "[----------]"},
+	}
+
+	for _, test := range tests {
+		bar := progressBar(test.done, test.total, 10, test.candy)
+		if bar != test.expected {
+			t.Errorf("Expected %q for %d/%d with candy %t, found %q", test.expected, test.done, test.total, test.candy, bar)
+		}
+	}
+}
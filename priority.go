@@ -0,0 +1,56 @@
+package main
+
+import (
+	"os/exec"
+	"strconv"
+)
+
+// systemdPriorityArgs are the systemd-run options applying the configured
+// build priority to a unit.
+func systemdPriorityArgs() []string {
+	var args []string
+	if config.Nice > 0 {
+		args = append(args, "--nice="+strconv.Itoa(config.Nice))
+	}
+	if config.IONice {
+		args = append(args, "--property=IOSchedulingClass=idle")
+	}
+	if config.CPUQuota != "" {
+		args = append(args, "--property=CPUQuota="+config.CPUQuota)
+	}
+
+	return args
+}
+
+// priorityPrefix is the command line a build is run through to apply the
+// configured build priority. A CPU quota needs a systemd scope, nice and
+// ionice do the rest.
+func priorityPrefix() []string {
+	var prefix []string
+	if config.CPUQuota != "" {
+		prefix = append(prefix, "systemd-run", "--user", "--scope", "--quiet",
+			"--property=CPUQuota="+config.CPUQuota, "--")
+	}
+	if config.Nice > 0 {
+		prefix = append(prefix, "nice", "-n", strconv.Itoa(config.Nice))
+	}
+	if config.IONice {
+		prefix = append(prefix, "ionice", "-c", "3")
+	}
+
+	return prefix
+}
+
+// prioritizedCommand runs cmd with the configured build priority. Builds
+// sandboxed with systemd-run get it from the unit properties instead.
+func prioritizedCommand(cmd *exec.Cmd) *exec.Cmd {
+	prefix := priorityPrefix()
+	if len(prefix) == 0 || config.Sandbox == SandboxSystemdRun {
+		return cmd
+	}
+
+	wrapped := exec.Command(prefix[0], append(prefix[1:], cmd.Args...)...)
+	wrapped.Dir = cmd.Dir
+	wrapped.Env = cmd.Env
+	return wrapped
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPriorityPrefix(t *testing.T) {
+	old := config
+	defer func() { config = old }()
+
+	config.Nice = 0
+	config.IONice = false
+	config.CPUQuota = ""
+	if prefix := priorityPrefix(); len(prefix) != 0 {
+		t.Errorf("Expected no prefix, found %v", prefix)
+	}
+
+	config.Nice = 10
+	config.IONice = true
+	config.CPUQuota = "50%"
+	expected := []string{
+		"systemd-run", "--user", "--scope", "--quiet", "--property=CPUQuota=50%", "--",
+		"nice", "-n", "10",
+		"ionice", "-c", "3",
+	}
+	if prefix := priorityPrefix(); !reflect.DeepEqual(prefix, expected) {
+		t.Errorf("Expected %v, found %v", expected, prefix)
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// profilesDir holds the makepkg.conf files generated for build profiles.
+var profilesDir string
+
+// buildProfile is a named set of compiler options builds can be run with.
+// Empty flags are left to makepkg.conf, March is appended to CFLAGS and
+// CXXFLAGS and LTO, when set, turns the lto option on or off.
+type buildProfile struct {
+	CFLAGS    string `json:"cflags,omitempty"`
+	CXXFLAGS  string `json:"cxxflags,omitempty"`
+	LDFLAGS   string `json:"ldflags,omitempty"`
+	RUSTFLAGS string `json:"rustflags,omitempty"`
+	March     string `json:"march,omitempty"`
+	LTO       *bool  `json:"lto,omitempty"`
+}
+
+// shellQuote quotes s for bash.
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+// profileConf returns a makepkg.conf reading base, the makepkg.conf it
+// replaces, and its drop-in directory, then applying profile.
+func profileConf(base string, profile buildProfile) string {
+	var conf strings.Builder
+	fmt.Fprintf(&conf, "source %s\n", shellQuote(base))
+	fmt.Fprintf(&conf, "for conf in %s/*.conf; do [[ -f $conf ]] && source \"$conf\"; done\n", shellQuote(base+".d"))
+
+	vars := []struct {
+		name  string
+		value string
+	}{
+		{"CFLAGS", profile.CFLAGS},
+		{"CXXFLAGS", profile.CXXFLAGS},
+		{"LDFLAGS", profile.LDFLAGS},
+		{"RUSTFLAGS", profile.RUSTFLAGS},
+	}
+	for _, v := range vars {
+		if v.value != "" {
+			fmt.Fprintf(&conf, "%s=%s\n", v.name, shellQuote(v.value))
+		}
+	}
+
+	// gcc goes by the last -march given
+	if profile.March != "" {
+		march := shellQuote(" -march=" + profile.March)
+		fmt.Fprintf(&conf, "CFLAGS+=%s\nCXXFLAGS+=%s\n", march, march)
+	}
+
+	if profile.LTO != nil {
+		option := "lto"
+		if !*profile.LTO {
+			option = "!lto"
+		}
+		fmt.Fprintf(&conf, "OPTIONS=(\"${OPTIONS[@]/?(!)lto}\" %s)\n", option)
+	}
+
+	return conf.String()
+}
+
+// profileName returns the build profile pkgbase is built with. The one given
+// for this invocation takes precedence over the per package ones, which
+// take precedence over the default one.
+func profileName(pkgbase string) string {
+	if config.BuildProfile != "" {
+		return config.BuildProfile
+	}
+	if name, ok := config.PackageProfiles[pkgbase]; ok {
+		return name
+	}
+
+	return config.DefaultProfile
+}
+
+// profileNames returns the configured profiles, sorted.
+func profileNames() []string {
+	names := make([]string, 0, len(config.BuildProfiles))
+	for name := range config.BuildProfiles {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+// writeProfileConf writes the makepkg.conf of the profile pkgbase is built
+// with and returns its path, or an empty path when it has none.
+func writeProfileConf(pkgbase string) (string, error) {
+	name := profileName(pkgbase)
+	if name == "" {
+		return "", nil
+	}
+
+	profile, ok := config.BuildProfiles[name]
+	if !ok {
+		return "", fmt.Errorf("Unknown build profile %s for %s, known: %s",
+			name, pkgbase, strings.Join(profileNames(), " "))
+	}
+
+	base := config.MakepkgConf
+	if base == "" {
+		base = "/etc/makepkg.conf"
+	}
+
+	if err := os.MkdirAll(profilesDir, 0755); err != nil {
+		return "", err
+	}
+
+	// builds running at the same time must not share a file
+	path := filepath.Join(profilesDir, pkgbase+".conf")
+	return path, ioutil.WriteFile(path, []byte(profileConf(base, profile)), 0644)
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestProfileConf(t *testing.T) {
+	lto := false
+	conf := profileConf("/etc/makepkg.conf", buildProfile{
+		CFLAGS: "-O3 -pipe",
+		March:  "native",
+		LTO:    &lto,
+	})
+
+	expected := []string{
+		"source '/etc/makepkg.conf'",
+		"for conf in '/etc/makepkg.conf.d'/*.conf; do",
+		"CFLAGS='-O3 -pipe'",
+		"CFLAGS+=' -march=native'",
+		"CXXFLAGS+=' -march=native'",
+		`OPTIONS=("${OPTIONS[@]/?(!)lto}" !lto)`,
+	}
+	for _, line := range expected {
+		if !strings.Contains(conf, line) {
+			t.Errorf("Expected %q, found:\n%s", line, conf)
+		}
+	}
+
+	if strings.Contains(conf, "LDFLAGS") {
+		t.Errorf("Expected unset flags to be left alone, found:\n%s", conf)
+	}
+}
+
+func TestShellQuote(t *testing.T) {
+	expected := `'it'\''s'`
+	if quoted := shellQuote("it's"); quoted != expected {
+		t.Errorf("Expected %s, found %s", expected, quoted)
+	}
+}
+
+func TestProfileName(t *testing.T) {
+	config.BuildProfile = ""
+	config.PackageProfiles = map[string]string{"ffmpeg": "fast"}
+	defer func() {
+		config.PackageProfiles = nil
+	}()
+
+	if name := profileName("ffmpeg"); name != "fast" {
+		t.Errorf("Expected the per package profile, found %q", name)
+	}
+	if name := profileName("other"); name != "" {
+		t.Errorf("Expected no profile, found %q", name)
+	}
+
+	config.DefaultProfile = "native"
+	defer func() { config.DefaultProfile = "" }()
+	if name := profileName("other"); name != "native" {
+		t.Errorf("Expected the default profile, found %q", name)
+	}
+	if name := profileName("ffmpeg"); name != "fast" {
+		t.Errorf("Expected the per package profile over the default one, found %q", name)
+	}
+
+	config.BuildProfile = "debug"
+	defer func() { config.BuildProfile = "" }()
+	if name := profileName("ffmpeg"); name != "debug" {
+		t.Errorf("Expected the profile of the run, found %q", name)
+	}
+}
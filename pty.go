@@ -0,0 +1,98 @@
+package main
+
+import (
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// winsize mirrors struct winsize of the TIOCGWINSZ and TIOCSWINSZ ioctls.
+type winsize struct {
+	rows, cols, xpixel, ypixel uint16
+}
+
+func ioctl(fd, req uintptr, arg unsafe.Pointer) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, req, uintptr(arg))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// isTerminal reports whether f is a terminal.
+func isTerminal(f *os.File) bool {
+	var termios syscall.Termios
+	return ioctl(f.Fd(), syscall.TCGETS, unsafe.Pointer(&termios)) == nil
+}
+
+// openPty opens a new pseudo terminal, sized like the terminal yay runs in
+// if there is one.
+func openPty() (master, slave *os.File, err error) {
+	// non-blocking so closing the master interrupts a pending read
+	master, err = os.OpenFile("/dev/ptmx", os.O_RDWR|syscall.O_NONBLOCK, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var unlock int32
+	var n uint32
+	err = ioctl(master.Fd(), syscall.TIOCSPTLCK, unsafe.Pointer(&unlock))
+	if err == nil {
+		err = ioctl(master.Fd(), syscall.TIOCGPTN, unsafe.Pointer(&n))
+	}
+	if err == nil {
+		slave, err = os.OpenFile("/dev/pts/"+strconv.Itoa(int(n)), os.O_RDWR|syscall.O_NOCTTY, 0)
+	}
+	if err != nil {
+		master.Close()
+		return nil, nil, err
+	}
+
+	// progress bars are drawn for the width of the terminal
+	size := winsize{rows: 24, cols: 80}
+	_ = ioctl(os.Stdout.Fd(), syscall.TIOCGWINSZ, unsafe.Pointer(&size))
+	_ = ioctl(slave.Fd(), syscall.TIOCSWINSZ, unsafe.Pointer(&size))
+
+	return master, slave, nil
+}
+
+// ptyGrace is how long the output of a pseudo terminal is still copied
+// after the command writing to it exited.
+const ptyGrace = 2 * time.Second
+
+// ptyOutput makes cmd write its output to a pseudo terminal copied to w,
+// so it keeps its colors and progress bars although it is not written to
+// the terminal. The returned function is to be called once cmd exited, it
+// waits for the output to be copied, for ptyGrace at most.
+func ptyOutput(cmd *exec.Cmd, w io.Writer) (func(), error) {
+	master, slave, err := openPty()
+	if err != nil {
+		return nil, err
+	}
+
+	cmd.Stdout, cmd.Stderr = slave, slave
+
+	copied := make(chan struct{})
+	go func() {
+		// reading fails with EIO once every end of the slave is closed
+		_, _ = io.Copy(w, master)
+		close(copied)
+	}()
+
+	return func() {
+		slave.Close()
+
+		// processes cmd left behind may still hold the slave open, their
+		// output is given up on rather than waiting for them to exit
+		select {
+		case <-copied:
+		case <-time.After(ptyGrace):
+		}
+		master.Close()
+		<-copied
+	}, nil
+}
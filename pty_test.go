@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPtyOutput(t *testing.T) {
+	var out bytes.Buffer
+	cmd := exec.Command("sh", "-c", "test -t 1 && test -t 2 && echo terminal")
+
+	closePty, err := ptyOutput(cmd, &out)
+	if err != nil {
+		t.Skip("no pseudo terminals:", err)
+	}
+
+	err = cmd.Run()
+	closePty()
+	if err != nil {
+		t.Fatal("Expected the output to be a terminal, found", err)
+	}
+
+	if !strings.Contains(out.String(), "terminal") {
+		t.Errorf("Expected the output to be copied, found %q", out.String())
+	}
+}
+
+func TestPtyOutputLeftBehind(t *testing.T) {
+	var out bytes.Buffer
+	cmd := exec.Command("sh", "-c", "echo started; sleep 10 &")
+
+	closePty, err := ptyOutput(cmd, &out)
+	if err != nil {
+		t.Skip("no pseudo terminals:", err)
+	}
+
+	if err := cmd.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	closePty()
+	if elapsed := time.Since(start); elapsed > ptyGrace+time.Second {
+		t.Errorf("Expected to stop waiting after %s, found %s", ptyGrace, elapsed)
+	}
+
+	if !strings.Contains(out.String(), "started") {
+		t.Errorf("Expected the output to be copied, found %q", out.String())
+	}
+}
+
+func TestIsTerminal(t *testing.T) {
+	master, slave, err := openPty()
+	if err != nil {
+		t.Skip(err)
+	}
+	defer master.Close()
+	defer slave.Close()
+
+	if !isTerminal(slave) {
+		t.Errorf("Expected a pseudo terminal to be a terminal")
+	}
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	defer w.Close()
+
+	if isTerminal(w) {
+		t.Errorf("Expected a pipe not to be a terminal")
+	}
+}
@@ -92,7 +92,7 @@ func narrowSearch(pkgS []string, sortS bool) (aurQuery, error) {
 		return nil, nil
 	}
 
-	r, err := rpc.Search(pkgS[0])
+	r, err := aurSearch(pkgS[0])
 	if err != nil {
 		return nil, err
 	}
@@ -171,7 +171,7 @@ func syncInfo(pkgS []string) (err error) {
 	}
 
 	if len(aurS) != 0 {
-		q, err := rpc.Info(aurS)
+		q, err := aurInfo(aurS)
 		if err != nil {
 			fmt.Println(err)
 		}
@@ -246,15 +246,27 @@ func packageSlices(toCheck []string) (aur []string, repo []string, missing []str
 		return
 	}
 
+	// packages of binary repos are looked up in the AUR first, unless a
+	// repo was given
+	binaryOnly := make(stringSet)
+
 	for _, _pkg := range toCheck {
+		explicitRepo := false
 		if i := strings.Index(_pkg, "/"); i != -1 {
+			explicitRepo = _pkg[:i] != "aur"
 			_pkg = _pkg[i+1:]
 		}
 		pkg := getNameFromDep(_pkg)
 
-		_, errdb := dbList.FindSatisfier(_pkg)
+		satisfier, errdb := dbList.FindSatisfier(_pkg)
 		found := errdb == nil
 
+		if found && !explicitRepo && isBinaryRepo(satisfier.DB().Name()) {
+			binaryOnly.set(pkg)
+			possibleAur = append(possibleAur, pkg)
+			continue
+		}
+
 		if !found {
 			_, errdb = dbList.PkgCachebyGroup(_pkg)
 			found = errdb == nil
@@ -271,9 +283,19 @@ func packageSlices(toCheck []string) (aur []string, repo []string, missing []str
 		return
 	}
 
-	info, err := rpc.Info(possibleAur)
-	if err != nil {
-		fmt.Println(err)
+	var info []rpc.Pkg
+	for i := 0; i < len(possibleAur); i += config.RequestSplitN {
+		j := i + config.RequestSplitN
+		if j > len(possibleAur) {
+			j = len(possibleAur)
+		}
+
+		qtemp, errInfo := aurInfo(possibleAur[i:j])
+		if errInfo != nil {
+			err = errInfo
+			return
+		}
+		info = append(info, qtemp...)
 	}
 
 outer:
@@ -284,7 +306,12 @@ outer:
 				continue outer
 			}
 		}
-		missing = append(missing, pkg)
+
+		if binaryOnly.get(pkg) {
+			repo = append(repo, pkg)
+		} else {
+			missing = append(missing, pkg)
+		}
 	}
 
 	return
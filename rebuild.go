@@ -0,0 +1,212 @@
+package main
+
+import (
+	"debug/elf"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// defaultLibDirs are searched for libraries besides the ld.so.conf ones.
+var defaultLibDirs = []string{"/usr/lib", "/usr/lib32", "/usr/lib64", "/lib", "/lib64"}
+
+// brokenPkg is an installed package with files linked against libraries
+// that are not installed anymore, usually after a repo package bumped its
+// soname.
+type brokenPkg struct {
+	name    string
+	missing []string
+}
+
+// parseLdSoConf returns the directories listed in ld.so.conf content and
+// the patterns of the files it includes.
+func parseLdSoConf(content string) (dirs []string, includes []string) {
+	for _, line := range strings.Split(content, "\n") {
+		if i := strings.Index(line, "#"); i != -1 {
+			line = line[:i]
+		}
+		line = strings.TrimSpace(line)
+
+		switch {
+		case line == "":
+		case strings.HasPrefix(line, "include "):
+			includes = append(includes, strings.TrimSpace(strings.TrimPrefix(line, "include ")))
+		default:
+			dirs = append(dirs, line)
+		}
+	}
+
+	return
+}
+
+// ldSoConfDirs returns the library directories configured under root.
+func ldSoConfDirs(root, file string) []string {
+	content, err := ioutil.ReadFile(root + file)
+	if err != nil {
+		return nil
+	}
+
+	dirs, includes := parseLdSoConf(string(content))
+	for _, pattern := range includes {
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(filepath.Dir(file), pattern)
+		}
+
+		matches, _ := filepath.Glob(root + pattern)
+		for _, match := range matches {
+			dirs = append(dirs, ldSoConfDirs(root, strings.TrimPrefix(match, root))...)
+		}
+	}
+
+	return dirs
+}
+
+// sonameResolver finds out whether libraries can be found, remembering
+// which files exist.
+type sonameResolver struct {
+	root   string
+	dirs   []string
+	exists map[string]bool
+}
+
+func newSonameResolver(root string) *sonameResolver {
+	root = strings.TrimSuffix(root, "/")
+	return &sonameResolver{
+		root:   root,
+		dirs:   append(ldSoConfDirs(root, "/etc/ld.so.conf"), defaultLibDirs...),
+		exists: make(map[string]bool),
+	}
+}
+
+func (r *sonameResolver) fileExists(path string) bool {
+	exists, ok := r.exists[path]
+	if !ok {
+		_, err := os.Stat(r.root + path)
+		exists = err == nil
+		r.exists[path] = exists
+	}
+
+	return exists
+}
+
+// expandOrigin replaces $ORIGIN in an rpath by dir, the directory of the
+// file it is from.
+func expandOrigin(rpath, dir string) []string {
+	var dirs []string
+	for _, path := range strings.Split(rpath, ":") {
+		path = strings.Replace(path, "${ORIGIN}", dir, -1)
+		path = strings.Replace(path, "$ORIGIN", dir, -1)
+		if path != "" {
+			dirs = append(dirs, path)
+		}
+	}
+
+	return dirs
+}
+
+// missingSonames returns the libraries the ELF file at path, relative to
+// the root, needs but that cannot be found. Files that are not ELF files
+// need nothing.
+func (r *sonameResolver) missingSonames(path string) []string {
+	f, err := elf.Open(r.root + path)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	needed, err := f.ImportedLibraries()
+	if err != nil || len(needed) == 0 {
+		return nil
+	}
+
+	var dirs []string
+	for _, tag := range []elf.DynTag{elf.DT_RPATH, elf.DT_RUNPATH} {
+		rpaths, _ := f.DynString(tag)
+		for _, rpath := range rpaths {
+			dirs = append(dirs, expandOrigin(rpath, filepath.Dir(path))...)
+		}
+	}
+	dirs = append(dirs, r.dirs...)
+
+	var missing []string
+outer:
+	for _, soname := range needed {
+		if strings.Contains(soname, "/") {
+			if r.fileExists(soname) {
+				continue
+			}
+		}
+
+		for _, dir := range dirs {
+			if r.fileExists(filepath.Join(dir, soname)) {
+				continue outer
+			}
+		}
+
+		missing = append(missing, soname)
+	}
+
+	return missing
+}
+
+// brokenPackages returns the foreign packages, usually from the AUR, with
+// files linked against libraries that cannot be found.
+func brokenPackages() ([]brokenPkg, error) {
+	_, remote, _, _, err := filterPackages()
+	if err != nil {
+		return nil, err
+	}
+
+	resolver := newSonameResolver(alpmConf.RootDir)
+
+	var broken []brokenPkg
+	for _, pkg := range remote {
+		missing := make(stringSet)
+		for _, file := range pkg.Files() {
+			path := "/" + file.Name
+			info, err := os.Lstat(resolver.root + path)
+			if err != nil || !mayBeELF(path, info.Mode()) {
+				continue
+			}
+
+			for _, soname := range resolver.missingSonames(path) {
+				missing.set(soname)
+			}
+		}
+
+		if len(missing) > 0 {
+			sonames := missing.toSlice()
+			sort.Strings(sonames)
+			broken = append(broken, brokenPkg{pkg.Name(), sonames})
+		}
+	}
+
+	return broken, nil
+}
+
+// printBroken lists the foreign packages that need rebuilding as they are
+// linked against libraries that are not installed anymore.
+func printBroken() error {
+	broken, err := brokenPackages()
+	if err != nil {
+		return err
+	}
+
+	if len(broken) == 0 {
+		fmt.Println(boldGreenFg(arrow), boldFg("No packages linked against missing libraries"))
+		return nil
+	}
+
+	names := make([]string, 0, len(broken))
+	for _, pkg := range broken {
+		fmt.Println(boldRedFgBlackBg(arrow+" Warning:"),
+			boldYellowFgBlackBg(pkg.name), whiteFgBlackBg("needs a rebuild, missing: "+strings.Join(pkg.missing, " ")))
+		names = append(names, pkg.name)
+	}
+
+	fmt.Println("Rebuild them with yay -S " + strings.Join(names, " "))
+	return nil
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseLdSoConf(t *testing.T) {
+	content := `# Dynamic linker configuration
+include ld.so.conf.d/*.conf
+/usr/local/lib   # local libraries
+
+/opt/foo/lib
+`
+
+	dirs, includes := parseLdSoConf(content)
+	if !reflect.DeepEqual(dirs, []string{"/usr/local/lib", "/opt/foo/lib"}) {
+		t.Errorf("Expected /usr/local/lib and /opt/foo/lib, found %v", dirs)
+	}
+	if !reflect.DeepEqual(includes, []string{"ld.so.conf.d/*.conf"}) {
+		t.Errorf("Expected ld.so.conf.d/*.conf to be included, found %v", includes)
+	}
+}
+
+func TestExpandOrigin(t *testing.T) {
+	dirs := expandOrigin("$ORIGIN/../lib:${ORIGIN}:/opt/foo/lib:", "/opt/foo/bin")
+	expected := []string{"/opt/foo/bin/../lib", "/opt/foo/bin", "/opt/foo/lib"}
+	if !reflect.DeepEqual(dirs, expected) {
+		t.Errorf("Expected %v, found %v", expected, dirs)
+	}
+}
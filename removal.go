@@ -0,0 +1,208 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// formatRequiredBy lists the packages requiring name, marking the foreign
+// ones, usually from the AUR, and the ones removed along with it.
+func formatRequiredBy(name string, requiredBy []string, foreign, removed stringSet) string {
+	list := make([]string, 0, len(requiredBy))
+	for _, pkg := range requiredBy {
+		switch {
+		case removed.get(pkg):
+			list = append(list, pkg+" (removed too)")
+		case foreign.get(pkg):
+			list = append(list, pkg+" "+yellowFg("(AUR)"))
+		default:
+			list = append(list, pkg)
+		}
+	}
+
+	return boldFg(name) + " is required by: " + strings.Join(list, " ")
+}
+
+// printRequiredBy lists, before pacman asks for confirmation, what requires
+// each package about to be removed, so AUR packages that would break stand
+// out.
+func printRequiredBy(targets []string) error {
+	localDb, err := alpmHandle.LocalDb()
+	if err != nil {
+		return err
+	}
+
+	_, _, _, remoteNames, err := filterPackages()
+	if err != nil {
+		return err
+	}
+
+	foreign := make(stringSet)
+	for _, name := range remoteNames {
+		foreign.set(name)
+	}
+
+	removed := make(stringSet)
+	for _, name := range targets {
+		removed.set(name)
+	}
+
+	var lines []string
+	for _, name := range targets {
+		pkg, err := localDb.PkgByName(name)
+		if err != nil {
+			continue
+		}
+
+		if requiredBy := pkg.ComputeRequiredBy(); len(requiredBy) > 0 {
+			lines = append(lines, formatRequiredBy(name, requiredBy, foreign, removed))
+		}
+	}
+
+	if len(lines) == 0 {
+		return nil
+	}
+
+	fmt.Println(boldCyanFg("::"), boldFg("Reverse dependencies of the packages to remove"))
+	for _, line := range lines {
+		fmt.Println("    " + line)
+	}
+	fmt.Println()
+
+	return nil
+}
+
+// removal is a package pacman would remove.
+type removal struct {
+	name    string
+	version string
+}
+
+// parseRemovals parses the output of pacman -Rp --print-format "%n %v".
+func parseRemovals(output string) []removal {
+	var removals []removal
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+
+		removals = append(removals, removal{fields[0], fields[1]})
+	}
+
+	return removals
+}
+
+// removedBuildDir returns the build directory in the cache of a removed
+// foreign package, if there is one. It is named after the pkgbase, which
+// split packages do not share their name with.
+func removedBuildDir(name string, base string) string {
+	if base == "" {
+		base = name
+	}
+
+	dir := config.BuildDir + base
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		return ""
+	}
+
+	return dir
+}
+
+// previewRemoval lists everything removing the targets of parser with -Rns
+// would remove before doing it, then offers to delete the build
+// directories of the foreign packages removed.
+func previewRemoval(parser *arguments) error {
+	args := parser.copy()
+	args.addArg("n", "s")
+
+	preview := args.copy()
+	preview.addArg("p")
+	preview.addParam("print-format", "%n %v")
+	output, err := pacmanOutput(preview)
+	if err != nil {
+		return err
+	}
+
+	removals := parseRemovals(output)
+	if len(removals) == 0 {
+		return fmt.Errorf("Nothing to remove")
+	}
+
+	_, _, _, remoteNames, err := filterPackages()
+	if err != nil {
+		return err
+	}
+
+	foreign := make(stringSet)
+	for _, name := range remoteNames {
+		foreign.set(name)
+	}
+
+	localDb, err := alpmHandle.LocalDb()
+	if err != nil {
+		return err
+	}
+
+	var buildDirs []string
+	seenDirs := make(stringSet)
+	rows := [][]string{{"Package", "Version", "Source", "Build Directory"}}
+	for _, pkg := range removals {
+		source, dir := "repo", ""
+		if foreign.get(pkg.name) {
+			source = "foreign"
+			base := ""
+			if local, err := localDb.PkgByName(pkg.name); err == nil {
+				base = local.Base()
+			}
+			// split packages share the build directory of their pkgbase
+			if dir = removedBuildDir(pkg.name, base); dir != "" && !seenDirs.get(dir) {
+				seenDirs.set(dir)
+				buildDirs = append(buildDirs, dir)
+			}
+		}
+
+		rows = append(rows, []string{pkg.name, pkg.version, source, dir})
+	}
+
+	fmt.Println(boldCyanFg("::"), boldFg(fmt.Sprintf("%d packages to remove with -Rns", len(removals))))
+	fmt.Println()
+	lines := formatTable(rows)
+	fmt.Println(boldFg(lines[0]))
+	for _, line := range lines[1:] {
+		fmt.Println(line)
+	}
+	fmt.Println()
+
+	if !continueTask("removal", "Proceed with removal?", "nN") {
+		return fmt.Errorf("Aborting due to user")
+	}
+
+	oldValue := config.NoConfirm
+	config.NoConfirm = true
+	err = passToPacman(args)
+	config.NoConfirm = oldValue
+	if err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(removals))
+	for _, pkg := range removals {
+		names = append(names, pkg.name)
+	}
+	removeVCSPackage(names)
+
+	if len(buildDirs) == 0 || continueTask("cleanbuild", "Delete the build directories of the removed foreign packages?", "yY") {
+		return nil
+	}
+
+	for _, dir := range buildDirs {
+		fmt.Println(boldGreenFg(arrow + " Deleting " + dir))
+		if err := os.RemoveAll(dir); err != nil {
+			fmt.Println(err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestFormatRequiredBy(t *testing.T) {
+	foreign := make(stringSet)
+	foreign.set("foo-git")
+	removed := make(stringSet)
+	removed.set("libfoo")
+	removed.set("bar")
+
+	str := formatRequiredBy("libfoo", []string{"bar", "foo-git", "baz"}, foreign, removed)
+	expected := "libfoo is required by: bar (removed too) foo-git (AUR) baz"
+	if str != expected {
+		t.Errorf("Expected %q, found %q", expected, str)
+	}
+}
+
+func TestParseRemovals(t *testing.T) {
+	output := "foo-git 1.0.r12.gabcdef-1\nlibfoo 2.3-1\n\n"
+
+	removals := parseRemovals(output)
+	if len(removals) != 2 {
+		t.Fatalf("Expected 2 removals, found %d", len(removals))
+	}
+	if removals[0] != (removal{"foo-git", "1.0.r12.gabcdef-1"}) || removals[1] != (removal{"libfoo", "2.3-1"}) {
+		t.Errorf("Expected foo-git and libfoo with their versions, found %v", removals)
+	}
+}
+
+func TestRemovedBuildDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "yay-builddir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	oldBuildDir := config.BuildDir
+	defer func() {
+		config.BuildDir = oldBuildDir
+	}()
+	config.BuildDir = dir + "/"
+	os.Mkdir(dir+"/foo", 0755)
+
+	if found := removedBuildDir("foo-libs", "foo"); found != dir+"/foo" {
+		t.Errorf("Expected the split package foo-libs to use %s/foo, found %q", dir, found)
+	}
+	if found := removedBuildDir("foo", ""); found != dir+"/foo" {
+		t.Errorf("Expected foo to use %s/foo without a pkgbase, found %q", dir, found)
+	}
+	if found := removedBuildDir("bar", "bar"); found != "" {
+		t.Errorf("Expected no build directory for bar, found %q", found)
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// savedReviews maps a pkgbase to the hash of the files the user last reviewed.
+var savedReviews = make(map[string]string)
+
+// reviewFile holds yay review info file path.
+var reviewFile string
+
+// reviewFiles lists the files shipped by the AUR for the pkgbase in dir:
+// the PKGBUILD, .SRCINFO and every other file of the checkout, referenced
+// by the PKGBUILD or not. The local files the .SRCINFO references follow,
+// as they may not be tracked.
+func reviewFiles(dir string) []string {
+	files := []string{"PKGBUILD", ".SRCINFO"}
+
+	if tracked, err := gitCommand(dir, "ls-files", "-z").Output(); err == nil {
+		for _, name := range strings.Split(string(tracked), "\x00") {
+			if name != "" && name != "PKGBUILD" && name != ".SRCINFO" {
+				files = append(files, name)
+			}
+		}
+	}
+
+	srcinfo, err := parseSrcinfo(dir + ".SRCINFO")
+	if err != nil {
+		return files
+	}
+
+	for _, source := range srcinfo.Source {
+		if i := strings.Index(source, "::"); i != -1 {
+			source = source[i+2:]
+		}
+		if !strings.Contains(source, "://") {
+			files = append(files, source)
+		}
+	}
+
+	if srcinfo.Install != "" {
+		files = append(files, srcinfo.Install)
+	}
+	if srcinfo.Changelog != "" {
+		files = append(files, srcinfo.Changelog)
+	}
+
+	return files
+}
+
+// editableFiles lists the reviewable files present in dir that are written
+// by hand, leaving out the generated .SRCINFO.
+func editableFiles(dir string) []string {
+	var files []string
+	seen := make(stringSet)
+
+	for _, name := range reviewFiles(dir) {
+		if name == ".SRCINFO" || seen.get(name) {
+			continue
+		}
+		seen.set(name)
+
+		if info, err := os.Stat(dir + name); err == nil && info.Mode().IsRegular() {
+			files = append(files, name)
+		}
+	}
+
+	return files
+}
+
+// hashReviewFiles hashes the names and contents of the reviewable files in dir.
+func hashReviewFiles(dir string) (string, error) {
+	files := reviewFiles(dir)
+	sort.Strings(files)
+
+	h := sha256.New()
+	seen := make(stringSet)
+	for _, name := range files {
+		if seen.get(name) {
+			continue
+		}
+		seen.set(name)
+
+		f, err := os.Open(dir + name)
+		if err != nil {
+			return "", err
+		}
+
+		io.WriteString(h, name+"\x00")
+		_, err = io.Copy(h, f)
+		f.Close()
+		if err != nil {
+			return "", err
+		}
+		io.WriteString(h, "\x00")
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// alreadyReviewed reports whether the files in dir are identical to the
+// ones the user approved the last time pkgbase was reviewed.
+func alreadyReviewed(pkgbase string, dir string) bool {
+	saved, ok := savedReviews[pkgbase]
+	if !ok {
+		return false
+	}
+
+	hash, err := hashReviewFiles(dir)
+	return err == nil && hash == saved
+}
+
+// recordReview remembers the files in dir as approved for pkgbase.
+func recordReview(pkgbase string, dir string) error {
+	hash, err := hashReviewFiles(dir)
+	if err != nil {
+		return err
+	}
+
+	savedReviews[pkgbase] = hash
+	return saveReviews()
+}
+
+func loadReviews() {
+	in, err := os.Open(reviewFile)
+	if err != nil {
+		return
+	}
+	defer in.Close()
+
+	_ = json.NewDecoder(in).Decode(&savedReviews)
+}
+
+func saveReviews() error {
+	marshalledinfo, err := json.MarshalIndent(savedReviews, "", "\t")
+	if err != nil {
+		return err
+	}
+	in, err := os.OpenFile(reviewFile, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	_, err = in.Write(marshalledinfo)
+	if err != nil {
+		return err
+	}
+	err = in.Sync()
+	return err
+}
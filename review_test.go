@@ -0,0 +1,45 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestReviewFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "yay-review")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	dir += "/"
+
+	oldGitBin := config.GitBin
+	defer func() {
+		config.GitBin = oldGitBin
+	}()
+	config.GitBin = "git"
+
+	for _, name := range []string{"PKGBUILD", "helper.sh", "foo.install"} {
+		if err := ioutil.WriteFile(dir+name, []byte("true\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := gitCommand(dir, "init", "--quiet").Run(); err != nil {
+		t.Skip(err)
+	}
+	if err := gitCommand(dir, "add", "PKGBUILD", "helper.sh").Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"PKGBUILD", ".SRCINFO", "helper.sh"}
+	if files := reviewFiles(dir); !reflect.DeepEqual(files, expected) {
+		t.Errorf("Expected %v, found %v", expected, files)
+	}
+
+	expected = []string{"PKGBUILD", "helper.sh"}
+	if files := editableFiles(dir); !reflect.DeepEqual(files, expected) {
+		t.Errorf("Expected %v, found %v", expected, files)
+	}
+}
@@ -0,0 +1,303 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	rpc "github.com/mikkeloscar/aur"
+	gopkg "github.com/mikkeloscar/gopkgbuild"
+)
+
+// Sandboxes builds can be confined in
+const (
+	SandboxNone       = ""
+	SandboxBubblewrap = "bwrap"
+	SandboxSystemdRun = "systemd-run"
+)
+
+// validSandbox reports whether sandbox is a supported sandbox name.
+func validSandbox(sandbox string) bool {
+	switch sandbox {
+	case SandboxNone, SandboxBubblewrap, SandboxSystemdRun:
+		return true
+	default:
+		return false
+	}
+}
+
+// makepkgDestVars are the makepkg.conf variables naming directories makepkg
+// writes to besides the build directory.
+var makepkgDestVars = []string{"SRCDEST", "SRCPKGDEST", "PKGDEST", "LOGDEST", "BUILDDIR"}
+
+var (
+	makepkgDestDirs []string
+	makepkgDestOnce sync.Once
+)
+
+// makepkgDests returns the directories makepkg is configured to write to
+// besides the build directory.
+func makepkgDests() []string {
+	makepkgDestOnce.Do(func() {
+		for _, name := range makepkgDestVars {
+			if dir := makepkgConfVar(name); dir != "" {
+				makepkgDestDirs = append(makepkgDestDirs, dir)
+			}
+		}
+	})
+
+	return makepkgDestDirs
+}
+
+// sandboxedMakepkgCommand prepares a makepkg build in dir. When a sandbox
+// is configured makepkg runs without network access and can only write to
+// dir and the directories makepkg.conf sets for its sources, packages and
+// logs. Sources must have been fetched beforehand.
+func sandboxedMakepkgCommand(dir string, args ...string) *exec.Cmd {
+	cmd := makepkgCommand(dir, args...)
+
+	var prefix []string
+	switch config.Sandbox {
+	case SandboxBubblewrap:
+		prefix = bwrapArgs(dir)
+	case SandboxSystemdRun:
+		prefix = systemdRunArgs(dir, cmd.Env)
+	default:
+		return cmd
+	}
+
+	wrapped := exec.Command(prefix[0], append(prefix[1:], cmd.Args...)...)
+	wrapped.Dir = cmd.Dir
+	wrapped.Env = cmd.Env
+	return wrapped
+}
+
+func bwrapArgs(dir string) []string {
+	home := os.Getenv("HOME")
+
+	args := []string{
+		"bwrap",
+		"--ro-bind", "/", "/",
+		"--dev", "/dev",
+		"--proc", "/proc",
+		"--tmpfs", "/tmp",
+		"--tmpfs", home,
+		"--ro-bind-try", home + "/.gnupg", home + "/.gnupg",
+		"--ro-bind-try", profilesDir, profilesDir,
+	}
+
+	// the tmpfs hides the makepkg configuration of the user
+	for _, conf := range makepkgUserConfs(home) {
+		args = append(args, "--ro-bind-try", conf, conf)
+	}
+
+	for _, dest := range makepkgDests() {
+		args = append(args, "--bind-try", dest, dest)
+	}
+
+	return append(args,
+		"--bind", dir, dir,
+		"--unshare-net",
+		"--unshare-ipc",
+		"--die-with-parent",
+		"--",
+	)
+}
+
+// makepkgUserConfs returns the makepkg configuration files under home that
+// makepkg may read: the configured one and the per-user ones.
+func makepkgUserConfs(home string) []string {
+	confs := []string{
+		home + "/.makepkg.conf",
+		filepath.Join(os.Getenv("XDG_CONFIG_HOME"), "pacman", "makepkg.conf"),
+		home + "/.config/pacman/makepkg.conf",
+		config.MakepkgConf,
+	}
+
+	var found []string
+	seen := make(stringSet)
+	for _, conf := range confs {
+		if !filepath.IsAbs(conf) || seen.get(conf) || !strings.HasPrefix(conf, home+"/") {
+			continue
+		}
+		seen.set(conf)
+		found = append(found, conf)
+	}
+
+	return found
+}
+
+func systemdRunArgs(dir string, env []string) []string {
+	args := []string{
+		"systemd-run",
+		"--user",
+		"--pty",
+		"--same-dir",
+		"--wait",
+		"--collect",
+		"--quiet",
+		"--unit=" + sandboxUnit(dir),
+		"--property=PrivateNetwork=yes",
+		"--property=PrivateTmp=yes",
+		"--property=ProtectSystem=strict",
+		"--property=ProtectHome=read-only",
+		"--property=ReadWritePaths=" + dir,
+	}
+
+	// missing directories are ignored with a leading -
+	for _, dest := range makepkgDests() {
+		args = append(args, "--property=ReadWritePaths=-"+dest)
+	}
+
+	// systemd-run does not forward our environment to the unit, the
+	// variables systemd sets for the unit itself are left out
+	if env == nil {
+		env = os.Environ()
+	}
+	for _, e := range env {
+		if i := strings.Index(e, "="); i != -1 && !unitEnvVars.get(e[:i]) {
+			args = append(args, "--setenv="+e)
+		}
+	}
+
+	if config.BuildTimeout > 0 {
+		args = append(args, "--property=RuntimeMaxSec="+strconv.Itoa(config.BuildTimeout*60))
+	}
+
+	return append(args, systemdPriorityArgs()...)
+}
+
+// unitEnvVars are the variables systemd sets for a unit itself, which are
+// not forwarded to it.
+var unitEnvVars = stringSet{
+	"INVOCATION_ID": {}, "JOURNAL_STREAM": {}, "LISTEN_FDNAMES": {}, "LISTEN_FDS": {},
+	"LISTEN_PID": {}, "MANAGERPID": {}, "NOTIFY_SOCKET": {}, "SYSTEMD_EXEC_PID": {},
+}
+
+// sandboxUnit names the transient unit a build in dir runs as with
+// systemd-run, so it can be stopped when it times out.
+func sandboxUnit(dir string) string {
+	name := strings.Map(func(r rune) rune {
+		if r == '+' || r == '@' {
+			return '_'
+		}
+		return r
+	}, filepath.Base(dir))
+
+	return "yay-" + name + "-" + strconv.Itoa(os.Getpid()) + ".service"
+}
+
+// sandboxed reports whether builds run in a sandbox, where makepkg cannot
+// become root to install what they need.
+func sandboxed() bool {
+	return config.Sandbox != SandboxNone && config.BuildBackend == BackendMakepkg && crossArch == ""
+}
+
+// buildDepends returns the dependencies, with their version constraints,
+// a build of the .SRCINFO content for arch needs installed: the depends of
+// each of pkgnames, architecture specific ones included, the makedepends
+// and, if check is set, the checkdepends.
+func buildDepends(content []byte, arch string, pkgnames []string, check bool) []string {
+	content = filterSrcinfoArch(content, arch)
+	fields := []string{"depends", "makedepends"}
+	if check {
+		fields = append(fields, "checkdepends")
+	}
+
+	var deps []string
+	seen := make(stringSet)
+	for _, pkgname := range pkgnames {
+		values := srcinfoValues(content, pkgname)
+		for _, field := range fields {
+			for _, dep := range values[field] {
+				if dep != "" && !seen.get(dep) {
+					seen.set(dep)
+					deps = append(deps, dep)
+				}
+			}
+		}
+	}
+
+	return deps
+}
+
+// preinstalledDeps reports whether the repo dependencies of the builds are
+// installed before they start rather than by makepkg: it cannot become root
+// in the sandbox, and parallel builds would run pacman side by side.
+func preinstalledDeps() bool {
+	return sandboxed() || (config.BuildJobs > 1 && !config.BatchInstall &&
+		config.BuildBackend == BackendMakepkg && crossArch == "")
+}
+
+// installBuildDeps installs the repo packages the pkgbases of pkgs depend
+// on, check dependencies included, that are not installed yet, for builds
+// where makepkg does not install them itself. They are installed as make
+// dependencies of dc, to be removed afterwards.
+func installBuildDeps(dc *depCatagories, pkgs []*rpc.Pkg, srcinfos map[string]*gopkg.PKGBUILD, parser *arguments) error {
+	dbList, err := alpmHandle.SyncDbs()
+	if err != nil {
+		return err
+	}
+	localDb, err := alpmHandle.LocalDb()
+	if err != nil {
+		return err
+	}
+
+	arch, err := alpmHandle.Arch()
+	if err != nil {
+		return err
+	}
+
+	arguments := parser.copy()
+	arguments.delArg("u", "sysupgrade")
+	arguments.delArg("y", "refresh")
+	arguments.op = "S"
+	arguments.targets = make(stringSet)
+	arguments.addArg("needed", "asdeps")
+
+	for _, pkg := range pkgs {
+		srcinfo, ok := srcinfos[pkg.PackageBase]
+		if !ok {
+			continue
+		}
+
+		content, err := readSrcinfo(config.BuildDir + pkg.PackageBase + "/")
+		if err != nil {
+			return err
+		}
+
+		// staged builds skip their checks
+		deps := buildDepends(content, arch, srcinfo.Pkgnames, !staged(pkg.PackageBase))
+		for _, dep := range deps {
+			if _, err := localDb.PkgCache().FindSatisfier(dep); err == nil {
+				continue
+			}
+			// AUR dependencies are built and installed in order
+			repoPkg, err := dbList.FindSatisfier(dep)
+			if err != nil {
+				continue
+			}
+
+			arguments.addTarget(repoPkg.Name())
+			dc.MakeOnly.set(repoPkg.Name())
+		}
+	}
+
+	if len(arguments.targets) == 0 {
+		return nil
+	}
+
+	oldConfirm := config.NoConfirm
+	config.NoConfirm = true
+	defer func() { config.NoConfirm = oldConfirm }()
+
+	if err := passToPacman(arguments); err != nil {
+		return fmt.Errorf("Error installing the dependencies of the builds")
+	}
+
+	return nil
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMakepkgUserConfs(t *testing.T) {
+	oldConf := config.MakepkgConf
+	oldXDG, hadXDG := os.LookupEnv("XDG_CONFIG_HOME")
+	defer func() {
+		config.MakepkgConf = oldConf
+		if hadXDG {
+			os.Setenv("XDG_CONFIG_HOME", oldXDG)
+		} else {
+			os.Unsetenv("XDG_CONFIG_HOME")
+		}
+	}()
+
+	os.Unsetenv("XDG_CONFIG_HOME")
+	config.MakepkgConf = "/home/user/build/makepkg.conf"
+	expected := []string{
+		"/home/user/.makepkg.conf",
+		"/home/user/.config/pacman/makepkg.conf",
+		"/home/user/build/makepkg.conf",
+	}
+	if confs := makepkgUserConfs("/home/user"); !reflect.DeepEqual(confs, expected) {
+		t.Errorf("Expected %v, found %v", expected, confs)
+	}
+
+	os.Setenv("XDG_CONFIG_HOME", "/home/user/.config")
+	config.MakepkgConf = "/etc/makepkg.conf"
+	expected = expected[:2]
+	if confs := makepkgUserConfs("/home/user"); !reflect.DeepEqual(confs, expected) {
+		t.Errorf("Expected %v, found %v", expected, confs)
+	}
+}
+
+func TestBuildDepends(t *testing.T) {
+	content := []byte(`pkgbase = foo
+	makedepends = cmake>=3.10
+	checkdepends = python-pytest
+	depends = glibc
+	depends_x86_64 = lib32-glibc
+	depends_aarch64 = libarm
+
+pkgname = foo
+	depends = glibc
+	depends = zlib>=1.2.11
+
+pkgname = foo-libs
+`)
+
+	expected := []string{"glibc", "zlib>=1.2.11", "cmake>=3.10", "python-pytest", "lib32-glibc"}
+	deps := buildDepends(content, "x86_64", []string{"foo", "foo-libs"}, true)
+	if !reflect.DeepEqual(deps, expected) {
+		t.Errorf("Expected %v, found %v", expected, deps)
+	}
+
+	expected = []string{"glibc", "zlib>=1.2.11", "cmake>=3.10"}
+	deps = buildDepends(content, "i686", []string{"foo"}, false)
+	if !reflect.DeepEqual(deps, expected) {
+		t.Errorf("Expected %v, found %v", expected, deps)
+	}
+}
+
+func TestSandboxDests(t *testing.T) {
+	oldDirs := makepkgDestDirs
+	defer func() { makepkgDestDirs = oldDirs }()
+	makepkgDestOnce.Do(func() {})
+	makepkgDestDirs = []string{"/srv/pkgs"}
+
+	args := strings.Join(bwrapArgs("/tmp/build/foo"), " ")
+	if !strings.Contains(args, "--bind-try /srv/pkgs /srv/pkgs") {
+		t.Errorf("Expected bwrap to bind /srv/pkgs, found %s", args)
+	}
+
+	env := []string{"PACKAGER=John Doe <john@doe.com>", "INVOCATION_ID=1234"}
+	args = strings.Join(systemdRunArgs("/tmp/build/foo", env), " ")
+	if !strings.Contains(args, "--property=ReadWritePaths=-/srv/pkgs") {
+		t.Errorf("Expected systemd-run to allow writing /srv/pkgs, found %s", args)
+	}
+	if !strings.Contains(args, "--setenv=PACKAGER=John Doe <john@doe.com>") {
+		t.Errorf("Expected systemd-run to forward PACKAGER, found %s", args)
+	}
+	if strings.Contains(args, "INVOCATION_ID") {
+		t.Errorf("Expected systemd-run not to forward INVOCATION_ID, found %s", args)
+	}
+}
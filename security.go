@@ -0,0 +1,138 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	alpm "github.com/jguer/go-alpm"
+)
+
+// securityURL is the Arch Linux security tracker's list of advisory groups.
+const securityURL string = "https://security.archlinux.org/all.json"
+
+// avg is an Arch Vulnerability Group as served by the security tracker.
+type avg struct {
+	Name     string   `json:"name"`
+	Packages []string `json:"packages"`
+	Status   string   `json:"status"`
+	Severity string   `json:"severity"`
+	Type     string   `json:"type"`
+	Affected string   `json:"affected"`
+	Fixed    string   `json:"fixed"`
+	Issues   []string `json:"issues"`
+}
+
+// vulnerablePkg is an installed package affected by an advisory group.
+type vulnerablePkg struct {
+	Name      string
+	Version   string
+	Group     avg
+	Available string
+}
+
+func getAVGs() (groups []avg, err error) {
+	resp, err := http.Get(securityURL)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("security tracker returned: %s", resp.Status)
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(&groups)
+	return
+}
+
+// vulnerablePackages matches the installed packages against the open
+// advisory groups of the security tracker.
+func vulnerablePackages() (vulnerable []vulnerablePkg, err error) {
+	groups, err := getAVGs()
+	if err != nil {
+		return
+	}
+
+	localDb, err := alpmHandle.LocalDb()
+	if err != nil {
+		return
+	}
+	dbList, err := alpmHandle.SyncDbs()
+	if err != nil {
+		return
+	}
+
+	for _, group := range groups {
+		if group.Status == "Not affected" {
+			continue
+		}
+
+		for _, name := range group.Packages {
+			pkg, err := localDb.PkgByName(name)
+			if err != nil {
+				continue
+			}
+
+			version := pkg.Version()
+			if group.Affected != "" && alpm.VerCmp(version, group.Affected) < 0 {
+				continue
+			}
+			if group.Fixed != "" && alpm.VerCmp(version, group.Fixed) >= 0 {
+				continue
+			}
+
+			vp := vulnerablePkg{Name: name, Version: version, Group: group}
+			if newPkg := pkg.NewVersion(dbList); newPkg != nil {
+				if group.Fixed != "" && alpm.VerCmp(newPkg.Version(), group.Fixed) >= 0 {
+					vp.Available = newPkg.Version()
+				}
+			}
+
+			vulnerable = append(vulnerable, vp)
+		}
+	}
+
+	sort.Slice(vulnerable, func(i, j int) bool {
+		return vulnerable[i].Name < vulnerable[j].Name
+	})
+
+	return
+}
+
+// printSecurity reports installed packages with open CVEs.
+func printSecurity() error {
+	vulnerable, err := vulnerablePackages()
+	if err != nil {
+		return fmt.Errorf("Unable to query security tracker: %s", err)
+	}
+
+	if len(vulnerable) == 0 {
+		fmt.Println(boldGreenFg("No installed packages are affected by open advisories"))
+		return nil
+	}
+
+	for _, vp := range vulnerable {
+		str := boldYellowFg(vp.Name) + " " + vp.Version + " " +
+			boldRedFgBlackBg("["+vp.Group.Severity+"]") + " " +
+			vp.Group.Name + " " + vp.Group.Type
+
+		switch {
+		case vp.Available != "":
+			str += greenFg(" -- update to " + vp.Available)
+		case vp.Group.Fixed != "":
+			str += yellowFg(" -- fixed in " + vp.Group.Fixed + ", not yet in your repos")
+		default:
+			str += redFg(" -- no fix available")
+		}
+
+		fmt.Println(str)
+		if len(vp.Group.Issues) > 0 {
+			fmt.Println("    " + strings.Join(vp.Group.Issues, " "))
+		}
+	}
+
+	return nil
+}
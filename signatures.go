@@ -0,0 +1,213 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	rpc "github.com/mikkeloscar/aur"
+)
+
+// signatureExts are the extensions makepkg treats as detached signatures.
+var signatureExts = []string{".sig", ".asc", ".sign"}
+
+// sourceTimeout bounds connecting to a source server and waiting for its
+// reply, so an unresponsive server does not hang the run.
+const sourceTimeout = 30 * time.Second
+
+// sourceClient fetches sources. Only the wait for a reply is bounded, as
+// downloading a large source can take any time.
+var sourceClient = &http.Client{
+	Transport: &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           (&net.Dialer{Timeout: sourceTimeout}).DialContext,
+		TLSHandshakeTimeout:   sourceTimeout,
+		ResponseHeaderTimeout: sourceTimeout,
+	},
+}
+
+// signedSource is a detached signature among the sources of a PKGBUILD
+// and the source it signs, both as source entries.
+type signedSource struct {
+	sig  string
+	file string
+}
+
+// signedSources returns the detached signatures among sources together
+// with the sources they sign, matched like makepkg does by the names the
+// sources are saved under. Signatures of no source are left out.
+func signedSources(sources []string) []signedSource {
+	byName := make(map[string]string)
+	for _, source := range sources {
+		byName[sourceFileName(source)] = source
+	}
+
+	var signed []signedSource
+	for _, source := range sources {
+		name := sourceFileName(source)
+		for _, ext := range signatureExts {
+			if !strings.HasSuffix(name, ext) {
+				continue
+			}
+			if file, ok := byName[strings.TrimSuffix(name, ext)]; ok {
+				signed = append(signed, signedSource{source, file})
+			}
+			break
+		}
+	}
+
+	return signed
+}
+
+// fetchSource returns where makepkg finds source for the PKGBUILD in dir:
+// in dir itself or its SRCDEST, downloading it there if needed so makepkg
+// does not download it again later.
+func fetchSource(dir string, source string) (string, error) {
+	path := dir + sourceFileName(source)
+	if _, err := os.Stat(path); err == nil {
+		return path, nil
+	}
+
+	path = sourceDest(filepath.Base(dir)) + sourceFileName(source)
+	if _, err := os.Stat(path); err == nil {
+		return path, nil
+	}
+
+	// VCS sources are only checked out by makepkg
+	u := sourceURL(source)
+	if u == nil || (u.Scheme != "http" && u.Scheme != "https") || len(sourceTools([]string{source})) > 0 {
+		return "", fmt.Errorf("cannot fetch %s before the build", sourceFileName(source))
+	}
+
+	resp, err := sourceClient.Get(u.String())
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%s: %s", u, resp.Status)
+	}
+
+	out, err := os.Create(path + ".part")
+	if err != nil {
+		return "", err
+	}
+	_, err = io.Copy(out, resp.Body)
+	if errc := out.Close(); err == nil {
+		err = errc
+	}
+	if err != nil {
+		os.Remove(path + ".part")
+		return "", err
+	}
+
+	return path, os.Rename(path+".part", path)
+}
+
+// signatureStatus reads the --status-fd output of gpg --verify. ok is true
+// when the signature is good and made by one of keys, or a subkey of one,
+// which is what makepkg accepts. Otherwise the problem is described.
+func signatureStatus(output []byte, keys []string) (string, bool) {
+	allowed := make(stringSet)
+	for _, key := range keys {
+		allowed.set(strings.ToUpper(key))
+	}
+
+	problem := "could not be verified"
+	for _, line := range strings.Split(string(output), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 3 || fields[0] != "[GNUPG:]" {
+			continue
+		}
+
+		switch fields[1] {
+		case "VALIDSIG":
+			primary := fields[len(fields)-1]
+			if allowed.get(fields[2]) || allowed.get(primary) {
+				return "", true
+			}
+			problem = "made by " + primary + ", which is not in validpgpkeys"
+		case "BADSIG":
+			return "bad signature", false
+		case "NO_PUBKEY":
+			problem = "key " + fields[2] + " not imported"
+		case "EXPKEYSIG", "REVKEYSIG":
+			problem = "key " + fields[2] + " expired or revoked"
+		}
+	}
+
+	return problem, false
+}
+
+// verifySignature checks one signed source in dir against keys, fetching
+// the signature and the file it signs first.
+func verifySignature(dir string, signed signedSource, keys []string) (string, bool) {
+	sig, err := fetchSource(dir, signed.sig)
+	if err != nil {
+		return err.Error(), false
+	}
+	file, err := fetchSource(dir, signed.file)
+	if err != nil {
+		return err.Error(), false
+	}
+
+	output, _ := gpgCommand("--batch", "--status-fd", "1", "--verify", sig, file).Output()
+	return signatureStatus(output, keys)
+}
+
+// verifySourceSignatures fetches the signed sources of the pkgbases in
+// pkgs and checks their signatures with gpg against the validpgpkeys of
+// their .SRCINFO, so a bad or missing signature shows up while reviewing
+// rather than halfway through the builds. Nothing of the PKGBUILD is run,
+// the sources are taken from the .SRCINFO and downloaded where makepkg
+// looks for them. Results are described per pkgbase.
+func verifySourceSignatures(pkgs []*rpc.Pkg) map[string]string {
+	results := make(map[string]string)
+	for i, pkg := range pkgs {
+		if config.SkipInteg.get(pkg.PackageBase) || config.SkipPGPCheck.get(pkg.PackageBase) {
+			continue
+		}
+
+		dir := config.BuildDir + pkg.PackageBase + "/"
+		srcinfo, err := parseSrcinfo(dir + ".SRCINFO")
+		if err != nil {
+			continue
+		}
+		signed := signedSources(srcinfo.Source)
+		if len(signed) == 0 {
+			continue
+		}
+
+		printProgress(i+1, len(pkgs), "Verifying signatures of "+pkg.PackageBase)
+
+		result, ok := "no validpgpkeys", false
+		if len(srcinfo.Validpgpkeys) > 0 {
+			result, ok = fmt.Sprintf("%d signatures verified", len(signed)), true
+			for _, s := range signed {
+				if problem, good := verifySignature(dir, s, srcinfo.Validpgpkeys); !good {
+					result, ok = sourceFileName(s.sig)+": "+problem, false
+					break
+				}
+			}
+		}
+
+		if ok {
+			results[pkg.PackageBase] = greenFg("(" + result + ")")
+			continue
+		}
+
+		results[pkg.PackageBase] = redFg("(" + result + ")")
+		if skipPrompt("edit") {
+			fmt.Println(boldRedFgBlackBg(arrow+" Warning:"),
+				blackBg(pkg.PackageBase+": "+result))
+		}
+	}
+
+	return results
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSignedSources(t *testing.T) {
+	sources := []string{
+		"https://example.org/foo-1.0.tar.gz",
+		"https://example.org/foo-1.0.tar.gz.sig",
+		"bar.tar.xz::https://example.org/bar-1.0.tar.xz",
+		"bar.tar.xz.asc::https://example.org/bar-1.0.tar.xz.asc",
+		"orphan.sign",
+		"foo.patch",
+	}
+
+	expected := []signedSource{
+		{"https://example.org/foo-1.0.tar.gz.sig", "https://example.org/foo-1.0.tar.gz"},
+		{"bar.tar.xz.asc::https://example.org/bar-1.0.tar.xz.asc", "bar.tar.xz::https://example.org/bar-1.0.tar.xz"},
+	}
+	if signed := signedSources(sources); !reflect.DeepEqual(signed, expected) {
+		t.Errorf("Expected %v, found %v", expected, signed)
+	}
+}
+
+func TestSignatureStatus(t *testing.T) {
+	const (
+		subkey  = "1111111111111111111111111111111111111111"
+		primary = "0123456789ABCDEF0123456789ABCDEF01234567"
+	)
+	validSig := "[GNUPG:] NEWSIG\n[GNUPG:] GOODSIG 89ABCDEF01234567 Foo <foo@example.org>\n" +
+		"[GNUPG:] VALIDSIG " + subkey + " 2024-01-01 1704067200 0 4 0 1 10 00 " + primary + "\n"
+
+	tests := []struct {
+		output   string
+		keys     []string
+		expected string
+		ok       bool
+	}{
+		{validSig, []string{primary}, "", true},
+		{validSig, []string{subkey}, "", true},
+		{validSig, []string{"FEDCBA9876543210FEDCBA9876543210FEDCBA98"}, "made by " + primary + ", which is not in validpgpkeys", false},
+		{"[GNUPG:] ERRSIG 89ABCDEF01234567 1 10 00 1704067200 9 -\n[GNUPG:] NO_PUBKEY 89ABCDEF01234567\n", []string{primary}, "key 89ABCDEF01234567 not imported", false},
+		{"[GNUPG:] BADSIG 89ABCDEF01234567 Foo <foo@example.org>\n", []string{primary}, "bad signature", false},
+		{"", []string{primary}, "could not be verified", false},
+	}
+
+	for _, test := range tests {
+		result, ok := signatureStatus([]byte(test.output), test.keys)
+		if result != test.expected || ok != test.ok {
+			t.Errorf("Expected %q %v, found %q %v", test.expected, test.ok, result, ok)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	alpm "github.com/jguer/go-alpm"
+	rpc "github.com/mikkeloscar/aur"
+)
+
+// sonameProviders maps the sonames AUR packages depend on to the AUR
+// packages providing them.
+var sonameProviders = make(map[string]string)
+
+// isSonameDep reports whether dep is on a shared library rather than a
+// package, like libfoo.so or libfoo.so=3-64. Packages provide the sonames
+// of the libraries they ship, with the soname version and the ELF class
+// as version.
+func isSonameDep(dep string) bool {
+	return strings.HasSuffix(getNameFromDep(dep), ".so")
+}
+
+// aurSonameProvider returns the name of the AUR package providing the
+// soname dep, the most voted one when several do. Only sonames the
+// PKGBUILD lists in provides are known to the AUR, makepkg adds the others
+// to the built packages alone.
+func aurSonameProvider(dep string) string {
+	found, err := aurSearchBy("provides", getNameFromDep(dep))
+	if err != nil || len(found) == 0 {
+		return ""
+	}
+
+	// Search results carry no provides to check the soname version against,
+	// info fills aurProvides
+	names := make([]string, 0, len(found))
+	for _, pkg := range found {
+		names = append(names, pkg.Name)
+	}
+	info, err := aurInfo(names)
+	if err != nil {
+		return ""
+	}
+
+	return bestSonameProvider(info, aurProvides, dep)
+}
+
+// bestSonameProvider returns the most voted of pkgs with a provide, looked
+// up in provides, satisfying the soname dep, version included, or "" if
+// none has.
+func bestSonameProvider(pkgs []rpc.Pkg, provides map[string][]string, dep string) string {
+	var candidates []rpc.Pkg
+	for _, pkg := range pkgs {
+		for _, provide := range provides[pkg.Name] {
+			if providesDep(provide, dep) {
+				candidates = append(candidates, pkg)
+				break
+			}
+		}
+	}
+	if len(candidates) == 0 {
+		return ""
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].NumVotes > candidates[j].NumVotes
+	})
+	return candidates[0].Name
+}
+
+// printMissingSonames explains the soname dependencies of missing. Those
+// that repo or installed packages provide at another version come from a
+// package built against an older or newer library, which has to be
+// rebuilt or updated.
+func printMissingSonames(missing stringSet) {
+	localDb, err := alpmHandle.LocalDb()
+	if err != nil {
+		return
+	}
+	dbList, err := alpmHandle.SyncDbs()
+	if err != nil {
+		return
+	}
+
+	deps := make([]string, 0, len(missing))
+	for dep := range missing {
+		if isSonameDep(dep) {
+			deps = append(deps, dep)
+		}
+	}
+	sort.Strings(deps)
+
+	for _, dep := range deps {
+		name := getNameFromDep(dep)
+
+		pkg, err := dbList.FindSatisfier(name)
+		if err != nil {
+			pkg, err = localDb.PkgCache().FindSatisfier(name)
+		}
+		if err != nil {
+			fmt.Println(boldRedFgBlackBg(arrow+" Warning:"),
+				blackBg("No package provides the library "+dep))
+			continue
+		}
+
+		provided := name
+		pkg.Provides().ForEach(func(provide alpm.Depend) error {
+			if provide.Name == name {
+				provided = provide.String()
+			}
+			return nil
+		})
+
+		fmt.Println(boldRedFgBlackBg(arrow+" Warning:"),
+			blackBg(dep+" is not met by "+pkg.Name()+", which provides "+provided+" -- rebuild or update what needs it"))
+	}
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"testing"
+
+	rpc "github.com/mikkeloscar/aur"
+)
+
+func TestBestSonameProvider(t *testing.T) {
+	pkgs := []rpc.Pkg{
+		{Name: "libfoo-old", NumVotes: 50},
+		{Name: "libfoo", NumVotes: 10},
+		{Name: "libfoo-git", NumVotes: 5},
+		{Name: "libfoo-bin", NumVotes: 100},
+	}
+	provides := map[string][]string{
+		"libfoo-old": {"libfoo.so=2-64"},
+		"libfoo":     {"libfoo=3.1", "libfoo.so=3-64"},
+		"libfoo-git": {"libfoo.so=3-64"},
+	}
+
+	if name := bestSonameProvider(pkgs, provides, "libfoo.so=3-64"); name != "libfoo" {
+		t.Errorf("Expected libfoo, found %q", name)
+	}
+	if name := bestSonameProvider(pkgs, provides, "libfoo.so"); name != "libfoo-old" {
+		t.Errorf("Expected libfoo-old, found %q", name)
+	}
+	if name := bestSonameProvider(pkgs, provides, "libfoo.so=4-64"); name != "" {
+		t.Errorf("Expected no provider, found %q", name)
+	}
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"debug/elf"
+	"fmt"
+	"sort"
+	"strings"
+
+	alpm "github.com/jguer/go-alpm"
+)
+
+// sonameVersions maps the soname provides of a package, like
+// libicuuc.so=75-64, to the soname version they stand for, 75.
+func sonameVersions(provides []alpm.Depend) map[string]string {
+	versions := make(map[string]string)
+	for _, provide := range provides {
+		if !strings.HasSuffix(provide.Name, ".so") || provide.Version == "" {
+			continue
+		}
+
+		version := provide.Version
+		if i := strings.LastIndex(version, "-"); i != -1 {
+			version = version[:i]
+		}
+		versions[provide.Name] = version
+	}
+
+	return versions
+}
+
+// replacedSonames returns the sonames an upgrade from a package providing
+// before to one providing after stops providing.
+func replacedSonames(before, after map[string]string) []string {
+	var sonames []string
+	for lib, version := range before {
+		if after[lib] != version {
+			sonames = append(sonames, lib+"."+version)
+		}
+	}
+
+	return sonames
+}
+
+// neededSonames returns the libraries the files of pkg are linked against.
+func neededSonames(root string, pkg alpm.Package) stringSet {
+	needed := make(stringSet)
+	forEachELF(root, pkg, func(path string, f *elf.File) {
+		libs, _ := f.ImportedLibraries()
+		for _, lib := range libs {
+			needed.set(lib)
+		}
+	})
+
+	return needed
+}
+
+// sonameRebuilds returns the installed foreign packages, other than the
+// ones in skip, linked against sonames that upgrading the repo packages
+// names removes.
+func sonameRebuilds(names []string, skip stringSet) ([]string, error) {
+	localDb, err := alpmHandle.LocalDb()
+	if err != nil {
+		return nil, err
+	}
+	dbList, err := alpmHandle.SyncDbs()
+	if err != nil {
+		return nil, err
+	}
+
+	replaced := make(stringSet)
+	for _, name := range names {
+		local, err := localDb.PkgByName(name)
+		if err != nil {
+			continue
+		}
+
+		found := false
+		_ = dbList.ForEach(func(db alpm.Db) error {
+			sync, err := db.PkgByName(name)
+			if found || err != nil {
+				return nil
+			}
+			found = true
+
+			before := sonameVersions(local.Provides().Slice())
+			after := sonameVersions(sync.Provides().Slice())
+			for _, soname := range replacedSonames(before, after) {
+				replaced.set(soname)
+			}
+			return nil
+		})
+	}
+
+	// looking into the files of the foreign packages is only worth it once
+	// a soname is known to go away
+	if len(replaced) == 0 {
+		return nil, nil
+	}
+
+	_, remote, _, _, err := filterPackages()
+	if err != nil {
+		return nil, err
+	}
+
+	root := strings.TrimSuffix(alpmConf.RootDir, "/")
+	var rebuilds []string
+	for _, pkg := range remote {
+		if skip.get(pkg.Name()) {
+			continue
+		}
+
+		for soname := range neededSonames(root, pkg) {
+			if replaced.get(soname) {
+				rebuilds = append(rebuilds, pkg.Name())
+				break
+			}
+		}
+	}
+
+	sort.Strings(rebuilds)
+	return rebuilds, nil
+}
+
+// askSonameRebuilds offers to rebuild the foreign packages that upgrading
+// the repo packages names breaks, returning the ones to add to the run.
+// They are built again even where their package files are still around.
+func askSonameRebuilds(names []string, skip stringSet) []string {
+	rebuilds, err := sonameRebuilds(names, skip)
+	if err != nil {
+		fmt.Println(err)
+		return nil
+	}
+	if len(rebuilds) == 0 {
+		return nil
+	}
+
+	fmt.Println(boldRedFgBlackBg(arrow+" Warning:"),
+		blackBg("This upgrade replaces libraries these packages link against: "+strings.Join(rebuilds, " ")))
+	if !continueTask("rebuilds", "Rebuild them in this run?", "nN") {
+		return nil
+	}
+
+	for _, name := range rebuilds {
+		forcedRebuilds.set(name)
+	}
+
+	return rebuilds
+}
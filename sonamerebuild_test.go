@@ -0,0 +1,62 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"sort"
+	"testing"
+
+	alpm "github.com/jguer/go-alpm"
+	rpc "github.com/mikkeloscar/aur"
+)
+
+func TestReplacedSonames(t *testing.T) {
+	before := sonameVersions([]alpm.Depend{
+		{Name: "libicuuc.so", Version: "75-64"},
+		{Name: "libicudata.so", Version: "75-64"},
+		{Name: "libkept.so", Version: "1-64"},
+		{Name: "icu", Version: "75.1"},
+	})
+	after := sonameVersions([]alpm.Depend{
+		{Name: "libicuuc.so", Version: "76-64"},
+		{Name: "libkept.so", Version: "1-64"},
+	})
+
+	replaced := replacedSonames(before, after)
+	sort.Strings(replaced)
+	expected := []string{"libicudata.so.75", "libicuuc.so.75"}
+	if !reflect.DeepEqual(replaced, expected) {
+		t.Errorf("Expected %v, found %v", expected, replaced)
+	}
+}
+
+func TestForcedRebuild(t *testing.T) {
+	dir, err := ioutil.TempDir("", "yay-rebuild")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	old := config
+	defer func() { config = old }()
+	config.BuildDir = dir + "/"
+	defer func() { forcedRebuilds = make(stringSet) }()
+
+	if err := os.Mkdir(dir+"/foo", 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(dir+"/foo/foo-1.0-1-x86_64.pkg.tar.zst", nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	bases := map[string][]*rpc.Pkg{"foo": {{Name: "foo", PackageBase: "foo"}}}
+
+	if built, err := builtBefore("foo", "1.0-1", bases); err != nil || !built {
+		t.Errorf("Expected foo-1.0-1 to be built already, found %v %v", built, err)
+	}
+
+	forcedRebuilds.set("foo")
+	if built, err := builtBefore("foo", "1.0-1", bases); err != nil || built {
+		t.Errorf("Expected foo to be rebuilt, found %v %v", built, err)
+	}
+}
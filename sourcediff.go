@@ -0,0 +1,181 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+
+	gopkg "github.com/mikkeloscar/gopkgbuild"
+)
+
+// sourceChange is a source or checksum entry added to or removed from a
+// PKGBUILD, along with the reasons it deserves attention.
+type sourceChange struct {
+	added bool
+	array string
+	value string
+	notes []string
+}
+
+// binaryExtensions are file extensions of prebuilt blobs in source arrays.
+var binaryExtensions = []string{
+	".bin", ".exe", ".so", ".dll", ".jar", ".deb", ".rpm",
+	".appimage", ".pkg.tar.xz", ".pkg.tar.zst", ".run", ".msi",
+}
+
+// sourceURL strips the name:: prefix and vcs+ scheme prefix from a source
+// entry and parses what is left. Local files return nil.
+func sourceURL(source string) *url.URL {
+	if i := strings.Index(source, "::"); i != -1 {
+		source = source[i+2:]
+	}
+
+	if !strings.Contains(source, "://") {
+		return nil
+	}
+
+	u, err := url.Parse(source)
+	if err != nil {
+		return nil
+	}
+
+	if i := strings.Index(u.Scheme, "+"); i != -1 {
+		u.Scheme = u.Scheme[i+1:]
+	}
+
+	return u
+}
+
+// diffSources compares the source and checksum arrays of two versions of
+// a PKGBUILD and returns every entry that changed.
+func diffSources(old, new *gopkg.PKGBUILD) (changes []sourceChange) {
+	oldHosts := make(stringSet)
+	secure := make(stringSet)
+	for _, source := range old.Source {
+		if u := sourceURL(source); u != nil {
+			oldHosts.set(u.Host)
+			if u.Scheme == "https" {
+				secure.set(u.Host)
+			}
+		}
+	}
+
+	removed, added := diffArray(old.Source, new.Source)
+	for _, source := range removed {
+		changes = append(changes, sourceChange{false, "source", source, nil})
+	}
+
+	for _, source := range added {
+		change := sourceChange{true, "source", source, nil}
+
+		u := sourceURL(source)
+		if u != nil {
+			if !oldHosts.get(u.Host) {
+				change.notes = append(change.notes, "new domain "+u.Host)
+			}
+			if u.Scheme == "http" || u.Scheme == "ftp" {
+				if secure.get(u.Host) {
+					change.notes = append(change.notes, "protocol downgraded to "+u.Scheme)
+				} else {
+					change.notes = append(change.notes, "insecure protocol "+u.Scheme)
+				}
+			}
+		}
+
+		name := strings.ToLower(source)
+		if u != nil {
+			name = strings.ToLower(path.Base(u.Path))
+		}
+		for _, ext := range binaryExtensions {
+			if strings.HasSuffix(name, ext) {
+				change.notes = append(change.notes, "binary file")
+				break
+			}
+		}
+
+		changes = append(changes, change)
+	}
+
+	sums := []struct {
+		name     string
+		old, new []string
+	}{
+		{"md5sums", old.Md5sums, new.Md5sums},
+		{"sha1sums", old.Sha1sums, new.Sha1sums},
+		{"sha224sums", old.Sha224sums, new.Sha224sums},
+		{"sha256sums", old.Sha256sums, new.Sha256sums},
+		{"sha384sums", old.Sha384sums, new.Sha384sums},
+		{"sha512sums", old.Sha512sums, new.Sha512sums},
+	}
+
+	sourcesChanged := len(removed)+len(added) > 0
+	for _, sum := range sums {
+		removed, added := diffArray(sum.old, sum.new)
+		for _, value := range removed {
+			changes = append(changes, sourceChange{false, sum.name, value, nil})
+		}
+		for _, value := range added {
+			change := sourceChange{true, sum.name, value, nil}
+			if value == "SKIP" {
+				change.notes = append(change.notes, "checksum skipped")
+			}
+			if !sourcesChanged {
+				change.notes = append(change.notes, "checksum changed without a source change")
+			}
+			changes = append(changes, change)
+		}
+	}
+
+	return
+}
+
+// diffArray returns the elements only present in old and only present in new.
+func diffArray(old, new []string) (removed, added []string) {
+	oldSet := make(stringSet)
+	newSet := make(stringSet)
+	for _, v := range old {
+		oldSet.set(v)
+	}
+	for _, v := range new {
+		newSet.set(v)
+	}
+
+	for _, v := range old {
+		if !newSet.get(v) {
+			removed = append(removed, v)
+		}
+	}
+	for _, v := range new {
+		if !oldSet.get(v) {
+			added = append(added, v)
+		}
+	}
+
+	return
+}
+
+// printSourceChanges highlights the source and checksum changes between
+// the previously built .SRCINFO and the one just downloaded.
+func printSourceChanges(pkgbase string, old, new *gopkg.PKGBUILD) {
+	changes := diffSources(old, new)
+	if len(changes) == 0 {
+		return
+	}
+
+	fmt.Println(boldCyanFg("::"), boldFg("Source changes in "+pkgbase+" since "+old.Version()+":"))
+	for _, change := range changes {
+		line := change.array + ": " + change.value
+		if change.added {
+			line = greenFg("+ " + line)
+		} else {
+			line = redFg("- " + line)
+		}
+
+		if len(change.notes) > 0 {
+			line += " " + boldRedFgBlackBg("("+strings.Join(change.notes, ", ")+")")
+		}
+
+		fmt.Println("\t" + line)
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"testing"
+
+	gopkg "github.com/mikkeloscar/gopkgbuild"
+)
+
+func TestDiffSources(t *testing.T) {
+	old := &gopkg.PKGBUILD{
+		Source:     []string{"https://example.com/foo-1.0.tar.gz", "foo.patch"},
+		Sha256sums: []string{"aaaa", "bbbb"},
+	}
+	new := &gopkg.PKGBUILD{
+		Source: []string{
+			"foo-1.1.tar.gz::http://example.com/foo-1.1.tar.gz",
+			"foo.patch",
+			"https://evil.example.org/helper.bin",
+		},
+		Sha256sums: []string{"cccc", "bbbb", "SKIP"},
+	}
+
+	changes := diffSources(old, new)
+
+	expected := []struct {
+		added bool
+		array string
+		notes int
+	}{
+		{false, "source", 0},
+		{true, "source", 1},
+		{true, "source", 2},
+		{false, "sha256sums", 0},
+		{true, "sha256sums", 0},
+		{true, "sha256sums", 1},
+	}
+
+	if len(changes) != len(expected) {
+		t.Fatalf("Expected %d changes, found %+v", len(expected), changes)
+	}
+
+	for i, e := range expected {
+		c := changes[i]
+		if c.added != e.added || c.array != e.array || len(c.notes) != e.notes {
+			t.Errorf("Expected %+v, found %+v", e, c)
+		}
+	}
+
+	if changes[1].notes[0] != "protocol downgraded to http" {
+		t.Errorf("Expected protocol downgrade, found %+v", changes[1].notes)
+	}
+}
+
+func TestDiffSourcesSumsOnly(t *testing.T) {
+	old := &gopkg.PKGBUILD{Source: []string{"foo.tar.gz"}, Md5sums: []string{"aaaa"}}
+	new := &gopkg.PKGBUILD{Source: []string{"foo.tar.gz"}, Md5sums: []string{"bbbb"}}
+
+	changes := diffSources(old, new)
+	if len(changes) != 2 || len(changes[1].notes) != 1 {
+		t.Fatalf("Expected a flagged checksum change, found %+v", changes)
+	}
+}
@@ -0,0 +1,309 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	rpc "github.com/mikkeloscar/aur"
+	gopkg "github.com/mikkeloscar/gopkgbuild"
+)
+
+// archFields are the .SRCINFO arrays that can be specific to an
+// architecture, e.g. depends_x86_64 or source_aarch64.
+var archFields = []string{
+	"source", "depends", "makedepends", "checkdepends", "optdepends",
+	"provides", "conflicts", "replaces",
+	"md5sums", "sha1sums", "sha224sums", "sha256sums", "sha384sums", "sha512sums",
+}
+
+// filterSrcinfoArch renames the architecture specific arrays of a .SRCINFO
+// built for arch to their generic names and drops the ones of every other
+// architecture, which the parser would reject.
+func filterSrcinfoArch(content []byte, arch string) []byte {
+	var out bytes.Buffer
+
+	for _, line := range strings.SplitAfter(string(content), "\n") {
+		i := strings.Index(line, " = ")
+		if i == -1 {
+			out.WriteString(line)
+			continue
+		}
+
+		key := strings.TrimSpace(line[:i])
+		indent := line[:strings.Index(line, key)]
+
+		keep := true
+		for _, field := range archFields {
+			if !strings.HasPrefix(key, field+"_") {
+				continue
+			}
+
+			keep = key[len(field)+1:] == arch
+			line = indent + field + line[i:]
+			break
+		}
+
+		if keep {
+			out.WriteString(line)
+		}
+	}
+
+	return out.Bytes()
+}
+
+// parseSrcinfoContent parses a .SRCINFO for the architecture pacman is
+// configured for.
+func parseSrcinfoContent(content []byte) (*gopkg.PKGBUILD, error) {
+	arch, err := alpmHandle.Arch()
+	if err != nil {
+		return nil, err
+	}
+
+	return gopkg.ParseSRCINFOContent(filterSrcinfoArch(content, arch))
+}
+
+// parseSrcinfo parses the .SRCINFO at path for the architecture pacman is
+// configured for.
+func parseSrcinfo(path string) (*gopkg.PKGBUILD, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseSrcinfoContent(content)
+}
+
+// srcinfoCommitted reports whether the .SRCINFO in dir was committed along
+// with or after the PKGBUILD there, and neither was edited since. File times
+// cannot tell, git sets them in checkout order.
+func srcinfoCommitted(dir string) bool {
+	if gitCommand(dir, "diff", "--quiet", "HEAD", "--", "PKGBUILD", ".SRCINFO").Run() != nil {
+		return false
+	}
+
+	pkgbuild, err := gitCommand(dir, "log", "-1", "--format=%H", "--", "PKGBUILD").Output()
+	if err != nil || len(bytes.TrimSpace(pkgbuild)) == 0 {
+		return false
+	}
+	srcinfo, err := gitCommand(dir, "log", "-1", "--format=%H", "--", ".SRCINFO").Output()
+	if err != nil || len(bytes.TrimSpace(srcinfo)) == 0 {
+		return false
+	}
+
+	return gitCommand(dir, "merge-base", "--is-ancestor",
+		string(bytes.TrimSpace(pkgbuild)), string(bytes.TrimSpace(srcinfo))).Run() == nil
+}
+
+// readSrcinfo returns the .SRCINFO shipped with the PKGBUILD in dir. It is
+// only generated through makepkg, which sources the PKGBUILD, when it is
+// missing or does not match the PKGBUILD anymore.
+func readSrcinfo(dir string) ([]byte, error) {
+	if srcinfoCommitted(dir) {
+		return ioutil.ReadFile(dir + ".SRCINFO")
+	}
+
+	content, err := ioutil.ReadFile(dir + "PKGBUILD")
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(content)
+	key := hex.EncodeToString(sum[:])
+	pkgbase := filepath.Base(dir)
+
+	if cached, ok := cachedSrcinfo(pkgbase, key); ok {
+		return cached, nil
+	}
+
+	cmd := pkgbuildCommand(makepkgCommand(dir, "--printsrcinfo"), nil)
+	cmd.Stderr = os.Stderr
+	generated, err := cmd.Output()
+	if err != nil {
+		return nil, err
+	}
+
+	cacheSrcinfo(pkgbase, key, generated)
+	return generated, nil
+}
+
+// cachedSrcinfo returns the .SRCINFO cached for pkgbase under key, which
+// identifies the PKGBUILD it was made from.
+func cachedSrcinfo(pkgbase string, key string) ([]byte, bool) {
+	content, err := ioutil.ReadFile(srcinfoCache + pkgbase + "/" + key)
+	return content, err == nil
+}
+
+// cacheSrcinfo stores content as the .SRCINFO of pkgbase, replacing any
+// made from another PKGBUILD. Failing to cache is not an error.
+func cacheSrcinfo(pkgbase string, key string, content []byte) {
+	dir := srcinfoCache + pkgbase + "/"
+	os.RemoveAll(dir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return
+	}
+
+	ioutil.WriteFile(dir+key, content, 0644)
+}
+
+// srcinfoValues returns the arrays of a .SRCINFO that apply to pkgname:
+// those of the pkgbase section, overridden by the ones its own section sets.
+func srcinfoValues(content []byte, pkgname string) map[string][]string {
+	values := make(map[string][]string)
+	overrides := make(map[string][]string)
+	section := ""
+
+	for _, line := range strings.Split(string(content), "\n") {
+		i := strings.Index(line, " = ")
+		if i == -1 {
+			continue
+		}
+
+		key := strings.TrimSpace(line[:i])
+		value := strings.TrimSpace(line[i+3:])
+
+		switch {
+		case key == "pkgbase" || key == "pkgname":
+			section = value
+			if key == "pkgbase" {
+				section = ""
+			}
+		case section == "":
+			values[key] = append(values[key], value)
+		case section == pkgname:
+			overrides[key] = append(overrides[key], value)
+		}
+	}
+
+	for key, value := range overrides {
+		// an empty override like "depends = " clears the array
+		if len(value) == 1 && value[0] == "" {
+			value = nil
+		}
+		values[key] = value
+	}
+
+	return values
+}
+
+// srcinfoVersion formats the full version a .SRCINFO describes.
+func srcinfoVersion(values map[string][]string) string {
+	version := ""
+	if len(values["pkgver"]) > 0 && len(values["pkgrel"]) > 0 {
+		version = values["pkgver"][0] + "-" + values["pkgrel"][0]
+	}
+	if len(values["epoch"]) > 0 && values["epoch"][0] != "0" {
+		version = values["epoch"][0] + ":" + version
+	}
+
+	return version
+}
+
+// fetchSrcinfo downloads the .SRCINFO of pkg from the AUR without cloning
+// it. The last modification time reported by the RPC identifies the
+// PKGBUILD, so a cached copy is used as long as the package is unchanged.
+// Packages of the local repos have theirs at hand.
+func fetchSrcinfo(pkg *rpc.Pkg) ([]byte, error) {
+	if local, ok := localPackages()[pkg.Name]; ok {
+		return local.srcinfo, nil
+	}
+
+	pkgbase := pkg.PackageBase
+	key := "aur-" + strconv.Itoa(pkg.LastModified)
+	if cached, ok := cachedSrcinfo(pkgbase, key); ok {
+		return cached, nil
+	}
+
+	resp, err := aurGet("/cgit/aur.git/plain/.SRCINFO?h=" + url.QueryEscape(pkgbase))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: .SRCINFO: %s", pkgbase, resp.Status)
+	}
+
+	content, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	cacheSrcinfo(pkgbase, key, content)
+	return content, nil
+}
+
+// srcinfoFetchResult is the .SRCINFO fetched for the pkgbase of pkg.
+type srcinfoFetchResult struct {
+	pkg     *rpc.Pkg
+	content []byte
+	err     error
+}
+
+// fetchSrcinfos downloads the .SRCINFO of every pkgbase of pkgs, fetching
+// downloadJobs of them at the same time. The results are keyed by pkgbase.
+func fetchSrcinfos(pkgs []rpc.Pkg) map[string]srcinfoFetchResult {
+	bases := make([]*rpc.Pkg, 0, len(pkgs))
+	seen := make(stringSet)
+	for i := range pkgs {
+		if !seen.get(pkgs[i].PackageBase) {
+			seen.set(pkgs[i].PackageBase)
+			bases = append(bases, &pkgs[i])
+		}
+	}
+
+	// loaded before the workers start, they all read it
+	localPackages()
+
+	queue := make(chan *rpc.Pkg)
+	results := make(chan srcinfoFetchResult)
+	for i := 0; i < downloadJobs && i < len(bases); i++ {
+		go func() {
+			for pkg := range queue {
+				content, err := fetchSrcinfo(pkg)
+				results <- srcinfoFetchResult{pkg, content, err}
+			}
+		}()
+	}
+	go func() {
+		for _, pkg := range bases {
+			queue <- pkg
+		}
+		close(queue)
+	}()
+
+	fetched := make(map[string]srcinfoFetchResult, len(bases))
+	for range bases {
+		result := <-results
+		fetched[result.pkg.PackageBase] = result
+	}
+
+	return fetched
+}
+
+// applySrcinfo replaces the version and dependencies the RPC reported for
+// pkg with the ones its .SRCINFO content gives for this architecture. The
+// RPC lists the dependencies of every architecture together.
+func applySrcinfo(pkg *rpc.Pkg, content []byte) error {
+	arch, err := alpmHandle.Arch()
+	if err != nil {
+		return err
+	}
+
+	values := srcinfoValues(filterSrcinfoArch(content, arch), pkg.Name)
+	if version := srcinfoVersion(values); version != "" {
+		pkg.Version = version
+	}
+	pkg.Depends = values["depends"]
+	pkg.MakeDepends = values["makedepends"]
+	aurGroups[pkg.Name] = values["groups"]
+
+	return nil
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"testing"
+
+	gopkg "github.com/mikkeloscar/gopkgbuild"
+)
+
+func TestFilterSrcinfoArch(t *testing.T) {
+	content := `pkgbase = foo
+	pkgver = 1.0
+	pkgrel = 1
+	arch = x86_64
+	arch = aarch64
+	depends = glibc
+	depends_x86_64 = lib32-glibc
+	makedepends_aarch64 = arm-toolchain
+	source = foo.tar.gz
+	source_aarch64 = foo-arm.patch
+	sha256sums = SKIP
+	sha256sums_aarch64 = SKIP
+
+pkgname = foo
+`
+
+	pkgbuild, err := gopkg.ParseSRCINFOContent(filterSrcinfoArch([]byte(content), "aarch64"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(pkgbuild.Depends) != 1 || pkgbuild.Depends[0].Name != "glibc" {
+		t.Errorf("Expected only glibc in depends, found %v", pkgbuild.Depends)
+	}
+
+	if len(pkgbuild.Makedepends) != 1 || pkgbuild.Makedepends[0].Name != "arm-toolchain" {
+		t.Errorf("Expected arm-toolchain in makedepends, found %v", pkgbuild.Makedepends)
+	}
+
+	if len(pkgbuild.Source) != 2 || len(pkgbuild.Sha256sums) != 2 {
+		t.Errorf("Expected the aarch64 source, found %v %v", pkgbuild.Source, pkgbuild.Sha256sums)
+	}
+}
+
+func TestSrcinfoValues(t *testing.T) {
+	content := []byte(`pkgbase = foo
+	pkgver = 1.0
+	pkgrel = 2
+	epoch = 1
+	depends = glibc
+	makedepends = cmake
+
+pkgname = foo
+
+pkgname = foo-docs
+	depends = 
+`)
+
+	values := srcinfoValues(content, "foo")
+	if len(values["depends"]) != 1 || values["depends"][0] != "glibc" {
+		t.Errorf("Expected foo to depend on glibc, found %v", values["depends"])
+	}
+
+	if version := srcinfoVersion(values); version != "1:1.0-2" {
+		t.Errorf("Expected version 1:1.0-2, found %s", version)
+	}
+
+	values = srcinfoValues(content, "foo-docs")
+	if len(values["depends"]) != 0 || len(values["makedepends"]) != 1 {
+		t.Errorf("Expected foo-docs to only have makedepends, found %v", values)
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// quietBuildLog returns where the output of building pkgbase goes with
+// --quietbuild, or "" for the terminal.
+func quietBuildLog(pkgbase string) string {
+	if !config.QuietBuild {
+		return ""
+	}
+
+	return config.BuildDir + pkgbase + "/build.log"
+}
+
+// failureLog returns what to point at for the output of a failed build of
+// pkgbase. Without a log makepkg wrote to the terminal, leaving only the
+// build directory.
+func failureLog(pkgbase, buildLog string) string {
+	if buildLog != "" {
+		return buildLog
+	}
+
+	return config.BuildDir + pkgbase
+}
+
+// showBuildStatus tells whether builds writing to a log show a status line,
+// which is not the case when several of them run at the same time.
+func showBuildStatus() bool {
+	return config.QuietBuild && (config.BatchInstall || config.BuildJobs <= 1)
+}
+
+// phaseWriter passes makepkg output through to w while keeping track of the
+// step makepkg is at.
+type phaseWriter struct {
+	w       io.Writer
+	mut     sync.Mutex
+	pending []byte
+	phase   string
+}
+
+func (pw *phaseWriter) Write(p []byte) (int, error) {
+	pw.mut.Lock()
+	pw.pending = append(pw.pending, p...)
+	for {
+		i := bytes.IndexByte(pw.pending, '\n')
+		if i == -1 {
+			break
+		}
+
+		if phase, ok := makepkgPhase(string(pw.pending[:i])); ok {
+			pw.phase = phase
+		}
+		pw.pending = pw.pending[i+1:]
+	}
+	pw.mut.Unlock()
+
+	return pw.w.Write(p)
+}
+
+func (pw *phaseWriter) current() string {
+	pw.mut.Lock()
+	defer pw.mut.Unlock()
+	return pw.phase
+}
+
+// makepkgPhase returns the step makepkg announces in line, such as
+// "Starting build()", if it announces one.
+func makepkgPhase(line string) (string, bool) {
+	line = strings.TrimSpace(ansiRegex.ReplaceAllString(line, ""))
+	if !strings.HasPrefix(line, "==> ") {
+		return "", false
+	}
+
+	line = strings.TrimPrefix(line, "==> ")
+	line = strings.TrimSuffix(line, "...")
+	return strings.TrimSpace(line), true
+}
+
+// formatElapsed formats d like a stopwatch.
+func formatElapsed(d time.Duration) string {
+	seconds := int(d / time.Second)
+	if seconds >= 3600 {
+		return fmt.Sprintf("%d:%02d:%02d", seconds/3600, seconds/60%60, seconds%60)
+	}
+
+	return fmt.Sprintf("%02d:%02d", seconds/60, seconds%60)
+}
+
+func statusLine(pkgbase, phase string, elapsed time.Duration) string {
+	if phase == "" {
+		phase = "Starting"
+	}
+
+	return boldGreenFg(arrow) + " " + boldFg(pkgbase) + " " + phase + " [" + formatElapsed(elapsed) + "]"
+}
+
+// startStatusLine keeps a line showing the step the build of pkgbase is at
+// and its running time up to date, if stdout is a terminal. The returned
+// function stops it, leaving the last state printed.
+func startStatusLine(pkgbase string, pw *phaseWriter) func() {
+	start := time.Now()
+
+	info, err := os.Stdout.Stat()
+	if err != nil || info.Mode()&os.ModeCharDevice == 0 {
+		return func() {
+			fmt.Println(statusLine(pkgbase, pw.current(), time.Since(start)))
+		}
+	}
+
+	redraw := func() {
+		fmt.Print("\r\x1b[K" + statusLine(pkgbase, pw.current(), time.Since(start)))
+	}
+
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+
+		for {
+			redraw()
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		<-stopped
+		redraw()
+		fmt.Println()
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestMakepkgPhase(t *testing.T) {
+	tests := []struct {
+		line  string
+		phase string
+		ok    bool
+	}{
+		{"==> Starting build()...", "Starting build()", true},
+		{"\x1b[1m\x1b[32m==>\x1b[m\x1b[1m Extracting sources...\x1b[m", "Extracting sources", true},
+		{"  -> Downloading foo-1.0.tar.gz...", "", false},
+		{"make[1]: Entering directory '/build'", "", false},
+	}
+
+	for _, test := range tests {
+		phase, ok := makepkgPhase(test.line)
+		if phase != test.phase || ok != test.ok {
+			t.Errorf("Expected %q to give %q %t, found %q %t", test.line, test.phase, test.ok, phase, ok)
+		}
+	}
+}
+
+func TestPhaseWriter(t *testing.T) {
+	var out bytes.Buffer
+	pw := &phaseWriter{w: &out}
+
+	pw.Write([]byte("==> Starting bu"))
+	if phase := pw.current(); phase != "" {
+		t.Errorf("Expected no phase from an unfinished line, found %q", phase)
+	}
+
+	pw.Write([]byte("ild()...\ngcc -c foo.c\n"))
+	if phase := pw.current(); phase != "Starting build()" {
+		t.Errorf("Expected %q, found %q", "Starting build()", phase)
+	}
+
+	if out.String() != "==> Starting build()...\ngcc -c foo.c\n" {
+		t.Errorf("Expected the output to be passed through, found %q", out.String())
+	}
+}
+
+func TestFormatElapsed(t *testing.T) {
+	tests := []struct {
+		d        time.Duration
+		expected string
+	}{
+		{0, "00:00"},
+		{75 * time.Second, "01:15"},
+		{time.Hour + 2*time.Minute + 3*time.Second, "1:02:03"},
+	}
+
+	for _, test := range tests {
+		if elapsed := formatElapsed(test.d); elapsed != test.expected {
+			t.Errorf("Expected %s to read %q, found %q", test.d, test.expected, elapsed)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// runSummary collects what went wrong or was left out during a run, to be
+// repeated at the end once it has scrolled away under the build output.
+var runSummary summary
+
+type summary struct {
+	mut      sync.Mutex
+	failed   []string
+	skipped  []string
+	ignored  []string
+	warnings []string
+}
+
+func (s *summary) add(list *[]string, str string) {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	*list = append(*list, str)
+}
+
+// failedBuild records a pkgbase that failed to build, with where to find
+// the build output.
+func (s *summary) failedBuild(pkgbase, log string) {
+	s.add(&s.failed, pkgbase+" (see "+log+")")
+}
+
+func (s *summary) skippedPkg(name, reason string) {
+	s.add(&s.skipped, name+" ("+reason+")")
+}
+
+func (s *summary) ignoredUpgrade(name, from, to string) {
+	s.add(&s.ignored, name+" ("+from+" => "+to+")")
+}
+
+func (s *summary) warning(str string) {
+	s.add(&s.warnings, str)
+}
+
+// print lists everything collected, if anything was.
+func (s *summary) print() {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+
+	sections := []struct {
+		title string
+		list  []string
+	}{
+		{"Failed to build:", s.failed},
+		{"Skipped:", s.skipped},
+		{"Ignored upgrades:", s.ignored},
+		{"Pacman warnings:", s.warnings},
+	}
+
+	printed := false
+	for _, section := range sections {
+		if len(section.list) == 0 {
+			continue
+		}
+
+		if !printed {
+			fmt.Println()
+			fmt.Println(boldCyanFg("::"), boldFg("Summary"))
+			printed = true
+		}
+
+		fmt.Println(boldFg(section.title))
+		for _, str := range section.list {
+			fmt.Println("    " + str)
+		}
+	}
+}
+
+// warningWriter passes output through to w while collecting the warnings
+// pacman prints into runSummary.
+type warningWriter struct {
+	w       io.Writer
+	pending []byte
+}
+
+func (ww *warningWriter) Write(p []byte) (int, error) {
+	ww.pending = append(ww.pending, p...)
+	for {
+		i := bytes.IndexByte(ww.pending, '\n')
+		if i == -1 {
+			break
+		}
+
+		if warning, ok := pacmanWarning(string(ww.pending[:i])); ok {
+			runSummary.warning(warning)
+		}
+		ww.pending = ww.pending[i+1:]
+	}
+
+	return ww.w.Write(p)
+}
+
+var ansiRegex = regexp.MustCompile("\x1b\\[[0-9;]*m")
+
+// pacmanWarning returns the text of line if it is a warning printed by
+// pacman, colored or not.
+func pacmanWarning(line string) (string, bool) {
+	line = ansiRegex.ReplaceAllString(line, "")
+	if !strings.HasPrefix(line, "warning: ") {
+		return "", false
+	}
+
+	return strings.TrimPrefix(line, "warning: "), true
+}
@@ -0,0 +1,22 @@
+package main
+
+import "testing"
+
+func TestPacmanWarning(t *testing.T) {
+	lines := []struct {
+		line, warning string
+		ok            bool
+	}{
+		{"warning: foo-1.0-1 is up to date -- skipping", "foo-1.0-1 is up to date -- skipping", true},
+		{"\x1b[1;33mwarning:\x1b[0m /etc/foo.conf installed as /etc/foo.conf.pacnew", "/etc/foo.conf installed as /etc/foo.conf.pacnew", true},
+		{"error: target not found: foo", "", false},
+		{"checking keyring...", "", false},
+	}
+
+	for _, l := range lines {
+		warning, ok := pacmanWarning(l.line)
+		if warning != l.warning || ok != l.ok {
+			t.Errorf("Expected %q to give %q %t, found %q %t", l.line, l.warning, l.ok, warning, ok)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// buildTimeoutError reports a build killed for running longer than
+// config.BuildTimeout.
+type buildTimeoutError struct {
+	limit time.Duration
+}
+
+func (e *buildTimeoutError) Error() string {
+	return fmt.Sprintf("build killed after running for %s", e.limit)
+}
+
+// killGrace is how long a timed out build gets to exit after SIGTERM
+// before what is left of it is killed.
+const killGrace = 10 * time.Second
+
+// runTimeLimited runs cmd, killing it and everything it started if it
+// runs longer than config.BuildTimeout.
+func runTimeLimited(cmd *exec.Cmd) error {
+	limit := time.Duration(config.BuildTimeout) * time.Minute
+	if limit <= 0 {
+		return cmd.Run()
+	}
+
+	start := time.Now()
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	pid := cmd.Process.Pid
+	unit := systemdUnit(cmd)
+	timer := time.AfterFunc(limit, func() {
+		fmt.Println(boldRedFgBlackBg(arrow+" Warning:"),
+			blackBg(fmt.Sprintf("Build running for longer than %s -- killing it", limit)))
+		// sandboxed builds run in their unit, not under systemd-run
+		if unit != "" {
+			_ = exec.Command("systemctl", "--user", "stop", unit).Run()
+		}
+		killProcessTree(pid)
+	})
+
+	// systemd-run also stops the unit itself once RuntimeMaxSec is reached
+	err := cmd.Wait()
+	timer.Stop()
+	if err != nil && time.Since(start) >= limit {
+		return &buildTimeoutError{limit}
+	}
+
+	return err
+}
+
+// systemdUnit returns the unit cmd runs its command as when it is a
+// systemd-run sandbox, "" otherwise.
+func systemdUnit(cmd *exec.Cmd) string {
+	if len(cmd.Args) == 0 || cmd.Args[0] != "systemd-run" {
+		return ""
+	}
+
+	for _, arg := range cmd.Args[1:] {
+		if strings.HasPrefix(arg, "--unit=") {
+			return strings.TrimPrefix(arg, "--unit=")
+		}
+	}
+
+	return ""
+}
+
+// killProcessTree sends SIGTERM to pid and its descendants, then SIGKILL
+// to the ones still around after killGrace.
+func killProcessTree(pid int) {
+	pids := append([]int{pid}, descendants(pid)...)
+	for _, p := range pids {
+		_ = syscall.Kill(p, syscall.SIGTERM)
+	}
+
+	time.Sleep(killGrace)
+
+	// children may have been started while the others were exiting
+	for _, p := range append(pids, descendants(pid)...) {
+		_ = syscall.Kill(p, syscall.SIGKILL)
+	}
+}
+
+// descendants returns the pids of the processes started by pid, their
+// children and so on.
+func descendants(pid int) []int {
+	var pids []int
+
+	tasks, err := ioutil.ReadDir("/proc/" + strconv.Itoa(pid) + "/task")
+	if err != nil {
+		return nil
+	}
+
+	for _, task := range tasks {
+		content, err := ioutil.ReadFile("/proc/" + strconv.Itoa(pid) + "/task/" + task.Name() + "/children")
+		if err != nil {
+			continue
+		}
+
+		for _, child := range parseChildren(string(content)) {
+			pids = append(pids, child)
+			pids = append(pids, descendants(child)...)
+		}
+	}
+
+	return pids
+}
+
+// parseChildren parses the content of a /proc/<pid>/task/<tid>/children
+// file.
+func parseChildren(content string) []int {
+	var pids []int
+	for _, field := range strings.Fields(content) {
+		if pid, err := strconv.Atoi(field); err == nil {
+			pids = append(pids, pid)
+		}
+	}
+
+	return pids
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func TestParseChildren(t *testing.T) {
+	tests := []struct {
+		content  string
+		expected []int
+	}{
+		{"", nil},
+		{"1234 ", []int{1234}},
+		{"1234 5678 91011 \n", []int{1234, 5678, 91011}},
+	}
+
+	for _, test := range tests {
+		if pids := parseChildren(test.content); !reflect.DeepEqual(pids, test.expected) {
+			t.Errorf("Expected %q to give %v, found %v", test.content, test.expected, pids)
+		}
+	}
+}
+
+func TestSystemdUnit(t *testing.T) {
+	config.Sandbox = SandboxSystemdRun
+	defer func() { config.Sandbox = SandboxNone }()
+
+	cmd := sandboxedMakepkgCommand("/tmp/yay/foo+bar/", "-f")
+	expected := "yay-foo_bar-" + strconv.Itoa(os.Getpid()) + ".service"
+	if unit := systemdUnit(cmd); unit != expected {
+		t.Errorf("Expected unit %q, found %q", expected, unit)
+	}
+
+	if unit := systemdUnit(exec.Command("makepkg", "-f")); unit != "" {
+		t.Errorf("Expected no unit, found %q", unit)
+	}
+}
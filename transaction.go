@@ -0,0 +1,171 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+
+	rpc "github.com/mikkeloscar/aur"
+)
+
+// transactionFile holds the path of the state of the last install that did
+// not finish.
+var transactionFile string
+
+// transaction is the state of an install of AUR packages, kept on disk
+// until it finishes so it can be resumed after a crash or interruption.
+type transaction struct {
+	// Args is the command line the install was started with and Targets
+	// its targets, including the ones read from stdin.
+	Args    []string `json:"args"`
+	Targets []string `json:"targets"`
+	// Bases are the pkgbases to build in build order and Installed the
+	// ones already installed.
+	Bases     []string `json:"bases"`
+	Installed []string `json:"installed"`
+}
+
+// currentTransaction is the transaction of this run, if it installs AUR
+// packages.
+var currentTransaction *transaction
+
+// resumedTransaction is the transaction continued with --resume.
+var resumedTransaction *transaction
+
+func loadTransaction() (*transaction, error) {
+	in, err := os.Open(transactionFile)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer in.Close()
+
+	tx := new(transaction)
+	if err := json.NewDecoder(in).Decode(tx); err != nil {
+		return nil, fmt.Errorf("%s: %s", transactionFile, err)
+	}
+
+	return tx, nil
+}
+
+func (tx *transaction) save() error {
+	marshalledinfo, err := json.MarshalIndent(tx, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(transactionFile, marshalledinfo, 0644)
+}
+
+// beginTransaction records that pkgs are about to be built, in order, for
+// the command line of this run.
+func beginTransaction(parser *arguments, pkgs []*rpc.Pkg) {
+	tx := &transaction{Args: os.Args[1:], Targets: parser.targets.toSlice()}
+	sort.Strings(tx.Targets)
+
+	if resumedTransaction != nil {
+		tx.Args = resumedTransaction.Args
+		tx.Installed = resumedTransaction.Installed
+	}
+
+	for _, pkg := range pkgs {
+		tx.Bases = append(tx.Bases, pkg.PackageBase)
+	}
+
+	currentTransaction = tx
+	if err := tx.save(); err != nil {
+		fmt.Println(err)
+	}
+}
+
+// installed records that the packages of pkgbase were installed.
+func (tx *transaction) installed(pkgbase string) {
+	if tx == nil {
+		return
+	}
+
+	tx.Installed = append(tx.Installed, pkgbase)
+	if err := tx.save(); err != nil {
+		fmt.Println(err)
+	}
+}
+
+// finishTransaction forgets the transaction of this run once it is done.
+func finishTransaction() {
+	if currentTransaction == nil {
+		return
+	}
+
+	currentTransaction = nil
+	if err := os.Remove(transactionFile); err != nil && !os.IsNotExist(err) {
+		fmt.Println(err)
+	}
+}
+
+// skipInstalledBases leaves out of dc the pkgbases a resumed transaction
+// already installed.
+func skipInstalledBases(dc *depCatagories, installed []string) {
+	done := make(stringSet)
+	for _, base := range installed {
+		done.set(base)
+	}
+
+	pkgs := dc.Aur[:0]
+	for _, pkg := range dc.Aur {
+		if done.get(pkg.PackageBase) {
+			fmt.Println(boldGreenFg(arrow), boldFg(pkg.PackageBase+" was installed before the interruption -- skipping"))
+			delete(dc.Bases, pkg.PackageBase)
+			continue
+		}
+
+		pkgs = append(pkgs, pkg)
+	}
+
+	dc.Aur = pkgs
+}
+
+// resumeTransaction runs the command line of the transaction that was
+// interrupted again, skipping what it already installed. Packages that were
+// built but not installed are reused from the build directory.
+func resumeTransaction() error {
+	tx, err := loadTransaction()
+	if err != nil {
+		return err
+	}
+	if tx == nil {
+		return fmt.Errorf("No interrupted transaction to resume")
+	}
+
+	fmt.Println(boldCyanFg("::"), boldFg(fmt.Sprintf("Resuming yay %s (%d of %d pkgbases installed)",
+		strings.Join(tx.Args, " "), len(tx.Installed), len(tx.Bases))))
+
+	args := makeArguments()
+	err = args.parseArgs(tx.Args)
+	if err != nil {
+		return err
+	}
+	if args.op == "" {
+		args.op = "Y"
+	}
+
+	// targets read from stdin are not there anymore
+	args.delArg("-")
+	args.targets = make(stringSet)
+	args.addTarget(tx.Targets...)
+	args.addArg("needed")
+
+	resumedTransaction = tx
+	cmdArgs = args
+
+	// the options of the interrupted command line may point alpm elsewhere
+	err = reopenAlpmHandle()
+	if err != nil {
+		return err
+	}
+
+	return handleCmd()
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"testing"
+
+	rpc "github.com/mikkeloscar/aur"
+)
+
+func TestSkipInstalledBases(t *testing.T) {
+	a := &rpc.Pkg{Name: "a", PackageBase: "a"}
+	b := &rpc.Pkg{Name: "b1", PackageBase: "b"}
+	c := &rpc.Pkg{Name: "c", PackageBase: "c"}
+
+	dc := makeDependCatagories()
+	dc.Aur = []*rpc.Pkg{a, b, c}
+	dc.Bases["a"] = []*rpc.Pkg{a}
+	dc.Bases["b"] = []*rpc.Pkg{b}
+	dc.Bases["c"] = []*rpc.Pkg{c}
+
+	skipInstalledBases(dc, []string{"b", "a"})
+
+	if len(dc.Aur) != 1 || dc.Aur[0] != c {
+		t.Errorf("Expected only c left to build, found %v", dc.Aur)
+	}
+	if _, ok := dc.Bases["b"]; ok {
+		t.Errorf("Expected b to be dropped from the bases")
+	}
+}
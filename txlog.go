@@ -0,0 +1,28 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// logFile holds the path of yay's transaction log.
+var logFile string
+
+// logTransaction appends a line to yay's transaction log, in the format of
+// pacman's log so both can be read side by side. Failing to write it is not
+// worth interrupting a transaction for, so errors are only printed.
+func logTransaction(format string, a ...interface{}) {
+	file, err := os.OpenFile(logFile, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer file.Close()
+
+	stamp := time.Now().Format("2006-01-02T15:04:05-0700")
+	_, err = fmt.Fprintf(file, "[%s] [YAY] %s\n", stamp, fmt.Sprintf(format, a...))
+	if err != nil {
+		fmt.Println(err)
+	}
+}
@@ -1,12 +1,14 @@
 package main
 
 import (
-	"bufio"
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"sort"
 	"strconv"
 	"strings"
+	"time"
 	"unicode"
 
 	alpm "github.com/jguer/go-alpm"
@@ -76,22 +78,18 @@ func (u upSlice) Print(start int) {
 
 		if errOld != nil {
 			left = redFg("Invalid Version")
+		} else if errNew != nil {
+			left = formatVersion(old, old, redFg)
 		} else {
-			if old.Version == new.Version {
-				left = string(old.Version) + "-" + redFg(string(old.Pkgrel))
-			} else {
-				left = redFg(string(old.Version)) + "-" + string(old.Pkgrel)
-			}
+			left = formatVersion(old, new, redFg)
 		}
 
 		if errNew != nil {
 			right = redFg("Invalid Version")
+		} else if errOld != nil {
+			right = formatVersion(new, new, boldGreenFg)
 		} else {
-			if old.Version == new.Version {
-				right = string(new.Version) + "-" + greenFg(string(new.Pkgrel))
-			} else {
-				right = boldGreenFg(string(new.Version)) + "-" + string(new.Pkgrel)
-			}
+			right = formatVersion(new, old, boldGreenFg)
 		}
 
 		w := 70 - len(i.Repository) - len(i.Name) + len(left)
@@ -100,6 +98,29 @@ func (u upSlice) Print(start int) {
 	}
 }
 
+// formatVersion renders v as [epoch:]version-rel, coloring the first of
+// those segments that differs from other. The epoch is shown whenever
+// either side has one so an epoch bump is not mistaken for a downgrade.
+func formatVersion(v *pkgb.CompleteVersion, other *pkgb.CompleteVersion, color func(string) string) string {
+	epoch := ""
+	if v.Epoch > 0 || other.Epoch > 0 {
+		epoch = strconv.Itoa(int(v.Epoch)) + ":"
+	}
+	version := string(v.Version)
+	rel := string(v.Pkgrel)
+
+	switch {
+	case v.Epoch != other.Epoch:
+		epoch = color(epoch)
+	case v.Version != other.Version:
+		version = color(version)
+	default:
+		rel = color(rel)
+	}
+
+	return epoch + version + "-" + rel
+}
+
 // upList returns lists of packages to upgrade from each source.
 func upList() (aurUp upSlice, repoUp upSlice, err error) {
 	local, remote, _, remoteNames, err := filterPackages()
@@ -150,25 +171,35 @@ loop:
 }
 
 func upDevel(remote []alpm.Package, packageC chan upgrade, done chan bool) {
-	for _, e := range savedInfo {
-		if e.needsUpdate() {
+	for base, e := range savedInfo.Packages {
+		if e.Pinned != "" {
+			fmt.Print(yellowFg("Note: "))
+			fmt.Printf("%s is pinned to %s -- skipping devel update\n",
+				strings.Join(e.Pkgnames, " "), shortSHA(e.Pinned))
+			continue
+		}
+
+		if e.needsUpdate(develInterval(base)) {
 			found := false
-			var pkg alpm.Package
-			for _, r := range remote {
-				if r.Name() == e.Package {
+			for _, name := range e.Pkgnames {
+				for _, pkg := range remote {
+					if pkg.Name() != name {
+						continue
+					}
+
 					found = true
-					pkg = r
+					if shouldIgnore(pkg) {
+						fmt.Print(yellowFg("Warning: "))
+						fmt.Printf("%s ignoring package upgrade (%s => %s)\n", pkg.Name(), pkg.Version(), "git")
+						runSummary.ignoredUpgrade(pkg.Name(), pkg.Version(), "git")
+					} else {
+						packageC <- upgrade{name, "devel", shortSHA(e.Sources[0].SHA), "git"}
+					}
 				}
 			}
-			if found {
-				if pkg.ShouldIgnore() {
-					fmt.Print(yellowFg("Warning: "))
-					fmt.Printf("%s ignoring package upgrade (%s => %s)\n", pkg.Name(), pkg.Version(), "git")
-				} else {
-					packageC <- upgrade{e.Package, "devel", e.SHA[0:6], "git"}
-				}
-			} else {
-				removeVCSPackage([]string{e.Package})
+
+			if !found {
+				removeVCSPackage(e.Pkgnames)
 			}
 		}
 	}
@@ -200,7 +231,7 @@ func upAUR(remote []alpm.Package, remoteNames []string) (toUpgrade upSlice, err
 
 		routines++
 		go func(local []alpm.Package, remote []string) {
-			qtemp, err := rpc.Info(remote)
+			qtemp, err := aurInfo(remote)
 			if err != nil {
 				fmt.Println(err)
 				done <- true
@@ -219,9 +250,10 @@ func upAUR(remote []alpm.Package, remoteNames []string) (toUpgrade upSlice, err
 				} else if qtemp[x].Name == local[i].Name() {
 					if (config.TimeUpdate && (int64(qtemp[x].LastModified) > local[i].BuildDate().Unix())) ||
 						(alpm.VerCmp(local[i].Version(), qtemp[x].Version) < 0) {
-						if local[i].ShouldIgnore() {
+						if shouldIgnore(local[i]) {
 							fmt.Print(yellowFg("Warning: "))
 							fmt.Printf("%s ignoring package upgrade (%s => %s)\n", local[i].Name(), local[i].Version(), qtemp[x].Version)
+							runSummary.ignoredUpgrade(local[i].Name(), local[i].Version(), qtemp[x].Version)
 						} else {
 							packageC <- upgrade{qtemp[x].Name, "aur", local[i].Version(), qtemp[x].Version}
 						}
@@ -267,9 +299,10 @@ func upRepo(local []alpm.Package) (upSlice, error) {
 	for _, pkg := range local {
 		newPkg := pkg.NewVersion(dbList)
 		if newPkg != nil {
-			if pkg.ShouldIgnore() {
+			if shouldIgnore(pkg) {
 				fmt.Print(yellowFg("Warning: "))
 				fmt.Printf("%s ignoring package upgrade (%s => %s)\n", pkg.Name(), pkg.Version(), newPkg.Version())
+				runSummary.ignoredUpgrade(pkg.Name(), pkg.Version(), newPkg.Version())
 			} else {
 				slice = append(slice, upgrade{pkg.Name(), newPkg.DB().Name(), pkg.Version(), newPkg.Version()})
 			}
@@ -278,27 +311,204 @@ func upRepo(local []alpm.Package) (upSlice, error) {
 	return slice, nil
 }
 
-//Contains returns whether e is present in s
-func containsInt(s []int, e int) bool {
-	for _, a := range s {
-		if a == e {
-			return true
+// replacement is an installed foreign package another AUR package
+// declares to replace.
+type replacement struct {
+	Old string
+	New string
+}
+
+// upReplaced finds installed foreign packages that an AUR package replaces.
+// Besides the replaces of the installed AUR packages, packages that vanished
+// from the AUR are looked up by name, as a rename leaves them stranded.
+func upReplaced() ([]replacement, error) {
+	_, _, _, remoteNames, err := filterPackages()
+	if err != nil {
+		return nil, err
+	}
+
+	q, err := aurInfoSplit(remoteNames)
+	if err != nil {
+		return nil, err
+	}
+
+	installed := make(stringSet)
+	for _, name := range remoteNames {
+		installed.set(name)
+	}
+
+	var replacements []replacement
+	found := make(stringSet)
+	add := func(pkg rpc.Pkg) {
+		for _, dep := range pkg.Replaces {
+			old := getNameFromDep(dep)
+			if old != pkg.Name && installed.get(old) && !found.get(old) {
+				replacements = append(replacements, replacement{old, pkg.Name})
+				found.set(old)
+			}
 		}
 	}
-	return false
+
+	inAur := make(stringSet)
+	for _, pkg := range q {
+		inAur.set(pkg.Name)
+		add(pkg)
+	}
+
+	var vanished []string
+	for _, name := range remoteNames {
+		if !inAur.get(name) && !found.get(name) {
+			vanished = append(vanished, name)
+		}
+	}
+
+	searches := loadReplacedSearches()
+	candidates, searchErr := replacedCandidates(vanished, searches, time.Now(), func(name string) ([]rpc.Pkg, error) {
+		return aurSearchBy("name-desc", name)
+	})
+	if err := saveReplacedSearches(searches); err != nil {
+		fmt.Println(err)
+	}
+
+	if len(candidates) == 0 {
+		return replacements, searchErr
+	}
+
+	// search results have no replaces, their info is fetched all at once
+	names := candidates.toSlice()
+	sort.Strings(names)
+	info, err := aurInfoSplit(names)
+	if err != nil {
+		return replacements, err
+	}
+	for _, pkg := range info {
+		add(pkg)
+	}
+
+	return replacements, searchErr
+}
+
+// replacedSearchFile holds the path of the record of the AUR searches for
+// the replacements of vanished packages.
+var replacedSearchFile string
+
+// replacedSearchInterval is how long the search for the replacements of a
+// vanished package is not repeated.
+const replacedSearchInterval = 24 * time.Hour
+
+// replacedSearch records the AUR packages whose names or descriptions
+// mention a vanished package, and when they were searched for.
+type replacedSearch struct {
+	Time       int64    `json:"time"`
+	Candidates []string `json:"candidates"`
+}
+
+func loadReplacedSearches() map[string]replacedSearch {
+	searches := make(map[string]replacedSearch)
+	in, err := os.Open(replacedSearchFile)
+	if err != nil {
+		return searches
+	}
+	defer in.Close()
+
+	_ = json.NewDecoder(in).Decode(&searches)
+	return searches
+}
+
+func saveReplacedSearches(searches map[string]replacedSearch) error {
+	marshalledinfo, err := json.MarshalIndent(searches, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(replacedSearchFile, marshalledinfo, 0644)
+}
+
+// replacedCandidates returns the AUR packages that may replace the vanished
+// packages, the first config.RequestSplitN results of searching for each
+// name. The AUR searches one term at a time, so the results are kept in
+// searches and reused for a day. Searches of packages no longer vanished
+// are dropped. A failed search is reported once the others are done.
+func replacedCandidates(vanished []string, searches map[string]replacedSearch, now time.Time, search func(string) ([]rpc.Pkg, error)) (stringSet, error) {
+	keep := make(stringSet)
+	candidates := make(stringSet)
+	var failed []string
+	var searchErr error
+
+	for _, name := range vanished {
+		keep.set(name)
+
+		cached, ok := searches[name]
+		if !ok || now.Sub(time.Unix(cached.Time, 0)) >= replacedSearchInterval {
+			results, err := search(name)
+			if err != nil {
+				failed = append(failed, name)
+				searchErr = err
+				delete(searches, name)
+				continue
+			}
+
+			cached = replacedSearch{Time: now.Unix()}
+			for i, pkg := range results {
+				if i == config.RequestSplitN {
+					break
+				}
+				cached.Candidates = append(cached.Candidates, pkg.Name)
+			}
+			searches[name] = cached
+		}
+
+		for _, candidate := range cached.Candidates {
+			candidates.set(candidate)
+		}
+	}
+
+	for name := range searches {
+		if !keep.get(name) {
+			delete(searches, name)
+		}
+	}
+
+	if searchErr != nil {
+		return candidates, fmt.Errorf("Could not search the AUR for the replacements of %s: %s", strings.Join(failed, ", "), searchErr)
+	}
+
+	return candidates, nil
 }
 
-// RemoveIntListFromList removes all src's elements that are present in target
-func removeIntListFromList(src, target []int) []int {
-	max := len(target)
-	for i := 0; i < max; i++ {
-		if containsInt(src, target[i]) {
-			target = append(target[:i], target[i+1:]...)
-			max--
-			i--
+// aurInfoSplit looks up names in the AUR, config.RequestSplitN at a time.
+func aurInfoSplit(names []string) (aurQuery, error) {
+	var q aurQuery
+	var j int
+	for i := len(names); i != 0; i = j {
+		j = i - config.RequestSplitN
+		if j < 0 {
+			j = 0
 		}
+		qtemp, err := aurInfo(names[j:i])
+		if err != nil {
+			return nil, err
+		}
+		q = append(q, qtemp...)
 	}
-	return target
+
+	return q, nil
+}
+
+// askReplacements asks which replacements to carry out and returns the
+// packages to install for them and the ones to remove afterwards.
+func askReplacements(replacements []replacement) (install []string, remove []string) {
+	for _, r := range replacements {
+		fmt.Println(boldCyanFg("::"), boldFg(r.Old+" is replaced by "+r.New+" in the AUR"))
+		if !continueTask("replace", "Replace "+r.Old+" with "+r.New+"?", "nN") {
+			continue
+		}
+
+		install = append(install, r.New)
+		remove = append(remove, r.Old)
+	}
+
+	return
 }
 
 // upgradePkgs handles updating the cache and installing updates.
@@ -306,78 +516,46 @@ func upgradePkgs(flags []string) error {
 	aurUp, repoUp, err := upList()
 	if err != nil {
 		return err
-	} else if len(aurUp)+len(repoUp) == 0 {
+	}
+
+	replacements, err := upReplaced()
+	if err != nil {
+		fmt.Println(err)
+	}
+	replaceNames, replacedNames := askReplacements(replacements)
+
+	if len(aurUp)+len(repoUp)+len(replaceNames) == 0 {
 		fmt.Println("\nThere is nothing to do")
-		return err
+		return nil
 	}
 
-	var repoNums []int
-	var aurNums []int
 	sort.Sort(repoUp)
 	fmt.Println(boldBlueFg("::"), len(aurUp)+len(repoUp), boldWhiteFg("Packages to upgrade."))
 	repoUp.Print(len(aurUp) + 1)
 	aurUp.Print(1)
 
-	if !config.NoConfirm {
-		fmt.Println(greenFg("Enter packages you don't want to upgrade."))
-		fmt.Print("Numbers: ")
-		reader := bufio.NewReader(os.Stdin)
+	total := len(aurUp) + len(repoUp)
+	var menu menuSelection
 
-		numberBuf, overflow, err := reader.ReadLine()
-		if err != nil || overflow {
-			fmt.Println(err)
+	if !skipPrompt("upgrade") {
+		fmt.Println(greenFg("Enter packages you don't want to upgrade."))
+		menu, err = readNumberMenuOpen("upgrade", ", aur, repo, all, none, abort", func(n int) {
+			if n >= 1 && n <= len(aurUp) {
+				openWebPage(aurUp[len(aurUp)-n].Name)
+			} else if n > len(aurUp) && n <= total {
+				openWebPage(repoUp[total-n].Name)
+			}
+		})
+		if err != nil {
 			return err
 		}
 
-		result := strings.Fields(string(numberBuf))
-		excludeAur := make([]int, 0)
-		excludeRepo := make([]int, 0)
-		for _, numS := range result {
-			negate := numS[0] == '^'
-			if negate {
-				numS = numS[1:]
-			}
-			var numbers []int
-			num, err := strconv.Atoi(numS)
-			if err != nil {
-				numbers, err = BuildRange(numS)
-				if err != nil {
-					continue
-				}
-			} else {
-				numbers = []int{num}
-			}
-			for _, target := range numbers {
-				if target > len(aurUp)+len(repoUp) || target <= 0 {
-					continue
-				} else if target <= len(aurUp) {
-					target = len(aurUp) - target
-					if negate {
-						excludeAur = append(excludeAur, target)
-					} else {
-						aurNums = append(aurNums, target)
-					}
-				} else {
-					target = len(aurUp) + len(repoUp) - target
-					if negate {
-						excludeRepo = append(excludeRepo, target)
-					} else {
-						repoNums = append(repoNums, target)
-					}
-				}
-			}
-		}
-		if len(repoNums) == 0 && len(aurNums) == 0 &&
-			(len(excludeRepo) > 0 || len(excludeAur) > 0) {
-			if len(repoUp) > 0 {
-				repoNums = BuildIntRange(0, len(repoUp)-1)
-			}
-			if len(aurUp) > 0 {
-				aurNums = BuildIntRange(0, len(aurUp)-1)
-			}
+		if menu.otherInclude.get("abort") {
+			return fmt.Errorf("Aborting due to user")
 		}
-		aurNums = removeIntListFromList(excludeAur, aurNums)
-		repoNums = removeIntListFromList(excludeRepo, repoNums)
+		menu.addKeyword("all", 1, total)
+		menu.addKeyword("aur", 1, len(aurUp))
+		menu.addKeyword("repo", len(aurUp)+1, total)
 	}
 
 	arguments := cmdArgs.copy()
@@ -386,33 +564,81 @@ func upgradePkgs(flags []string) error {
 
 	var repoNames []string
 	var aurNames []string
+	var skipped []string
 
-	if len(repoUp) != 0 {
-	repoloop:
-		for i, k := range repoUp {
-			for _, j := range repoNums {
-				if j == i {
-					continue repoloop
-				}
-			}
+	for i, k := range repoUp {
+		if menu.selected(total - i) {
+			skipped = append(skipped, k.Name)
+		} else {
 			repoNames = append(repoNames, k.Name)
 		}
 	}
 
-	if len(aurUp) != 0 {
-	aurloop:
-		for i, k := range aurUp {
-			for _, j := range aurNums {
-				if j == i {
-					continue aurloop
-				}
-			}
+	for i, k := range aurUp {
+		if menu.selected(len(aurUp) - i) {
+			skipped = append(skipped, k.Name)
+		} else {
 			aurNames = append(aurNames, k.Name)
 		}
 	}
 
+	for _, name := range skipped {
+		runSummary.skippedPkg(name, "left out of the upgrade")
+	}
+
+	if len(skipped) > 0 && !skipPrompt("addignore") {
+		askIgnorePkg(skipped)
+	}
+
+	upgrading := make(stringSet)
+	for _, name := range aurNames {
+		upgrading.set(name)
+	}
+	aurNames = append(aurNames, askSonameRebuilds(repoNames, upgrading)...)
+
 	arguments.addTarget(repoNames...)
 	arguments.addTarget(aurNames...)
-	err = install(arguments)
+	arguments.addTarget(replaceNames...)
+	err = install(arguments, false)
+	if err != nil {
+		return err
+	}
+
+	return removeReplaced(replacedNames)
+}
+
+// removeReplaced removes the replaced packages that are still installed,
+// as the replacement only conflicting with them is not guaranteed. The
+// handle is reopened first, pacman may have removed some of them already.
+func removeReplaced(names []string) error {
+	if len(names) == 0 {
+		return nil
+	}
+
+	if err := reopenAlpmHandle(); err != nil {
+		return err
+	}
+
+	localDb, err := alpmHandle.LocalDb()
+	if err != nil {
+		return err
+	}
+
+	arguments := makeArguments()
+	arguments.op = "R"
+	for _, name := range names {
+		if _, err := localDb.PkgByName(name); err == nil {
+			arguments.addTarget(name)
+		}
+	}
+
+	if len(arguments.targets) == 0 {
+		return nil
+	}
+
+	err = passToPacman(arguments)
+	if err == nil {
+		removeVCSPackage(arguments.formatTargets())
+	}
 	return err
 }
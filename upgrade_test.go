@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	rpc "github.com/mikkeloscar/aur"
+	pkgb "github.com/mikkeloscar/gopkgbuild"
+)
+
+func TestFormatVersion(t *testing.T) {
+	mark := func(s string) string { return "[" + s + "]" }
+
+	versions := []struct {
+		old, new string
+		left     string
+		right    string
+	}{
+		{"1.0-1", "1.0-2", "1.0-[1]", "1.0-[2]"},
+		{"1.0-1", "1.1-1", "[1.0]-1", "[1.1]-1"},
+		{"2.0-1", "1:1.0-1", "[0:]2.0-1", "[1:]1.0-1"},
+		{"1:2.0-1", "1:2.1-1", "1:[2.0]-1", "1:[2.1]-1"},
+	}
+
+	for _, v := range versions {
+		old, err := pkgb.NewCompleteVersion(v.old)
+		if err != nil {
+			t.Fatal(err)
+		}
+		new, err := pkgb.NewCompleteVersion(v.new)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if left := formatVersion(old, new, mark); left != v.left {
+			t.Errorf("Expected %s, found %s", v.left, left)
+		}
+		if right := formatVersion(new, old, mark); right != v.right {
+			t.Errorf("Expected %s, found %s", v.right, right)
+		}
+	}
+}
+
+func TestReplacedCandidates(t *testing.T) {
+	oldSplitN := config.RequestSplitN
+	defer func() { config.RequestSplitN = oldSplitN }()
+	config.RequestSplitN = 2
+
+	now := time.Unix(1000000, 0)
+	searches := map[string]replacedSearch{
+		"fresh": {Time: now.Add(-time.Hour).Unix(), Candidates: []string{"fresh-ng"}},
+		"stale": {Time: now.Add(-25 * time.Hour).Unix(), Candidates: []string{"stale-old"}},
+		"gone":  {Time: now.Unix(), Candidates: []string{"gone-ng"}},
+	}
+
+	var searched []string
+	search := func(name string) ([]rpc.Pkg, error) {
+		searched = append(searched, name)
+		if name == "broken" {
+			return nil, fmt.Errorf("timeout")
+		}
+		return []rpc.Pkg{{Name: name + "-ng"}, {Name: name + "2"}, {Name: name + "-extra"}}, nil
+	}
+
+	candidates, err := replacedCandidates([]string{"fresh", "stale", "new", "broken"}, searches, now, search)
+	if err == nil || !strings.Contains(err.Error(), "broken") {
+		t.Errorf("Expected the failed search of broken to be reported, found %v", err)
+	}
+
+	expected := []string{"stale", "new", "broken"}
+	if !reflect.DeepEqual(searched, expected) {
+		t.Errorf("Expected searches for %v, found %v", expected, searched)
+	}
+
+	names := candidates.toSlice()
+	sort.Strings(names)
+	expected = []string{"fresh-ng", "new-ng", "new2", "stale-ng", "stale2"}
+	if !reflect.DeepEqual(names, expected) {
+		t.Errorf("Expected candidates %v, found %v", expected, names)
+	}
+
+	for _, name := range []string{"gone", "broken"} {
+		if _, ok := searches[name]; ok {
+			t.Errorf("Expected the search of %s to be dropped", name)
+		}
+	}
+	if searches["stale"].Time != now.Unix() {
+		t.Errorf("Expected the search of stale to be renewed, found %v", searches["stale"])
+	}
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	alpm "github.com/jguer/go-alpm"
+)
+
+// upgradesFile holds the path of the record of what every system upgrade
+// changed.
+var upgradesFile string
+
+// versionChange is a package that was upgraded, downgraded, installed or
+// removed. The old version of installed packages and the new version of
+// removed ones are empty.
+type versionChange struct {
+	name string
+	old  string
+	new  string
+}
+
+func (c versionChange) String() string {
+	switch {
+	case c.old == "":
+		return c.name + " " + c.new + " (installed)"
+	case c.new == "":
+		return c.name + " " + c.old + " (removed)"
+	default:
+		return c.name + " " + c.old + " -> " + c.new
+	}
+}
+
+// installedVersions returns the versions of the installed packages.
+func installedVersions() (map[string]string, error) {
+	localDb, err := alpmHandle.LocalDb()
+	if err != nil {
+		return nil, err
+	}
+
+	versions := make(map[string]string)
+	err = localDb.PkgCache().ForEach(func(pkg alpm.Package) error {
+		versions[pkg.Name()] = pkg.Version()
+		return nil
+	})
+
+	return versions, err
+}
+
+// diffVersions returns the packages whose version differs between before
+// and after, sorted by name.
+func diffVersions(before, after map[string]string) []versionChange {
+	var changes []versionChange
+	for name, old := range before {
+		if after[name] != old {
+			changes = append(changes, versionChange{name, old, after[name]})
+		}
+	}
+	for name, version := range after {
+		if _, ok := before[name]; !ok {
+			changes = append(changes, versionChange{name, "", version})
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool { return changes[i].name < changes[j].name })
+	return changes
+}
+
+// upgradeSections splits changes into repo, AUR and devel packages. The
+// packages in foreign are not in the sync databases, devel tells which of
+// them are development packages.
+func upgradeSections(changes []versionChange, foreign stringSet, devel func(string) bool) (repo, aur, vcs []versionChange) {
+	for _, change := range changes {
+		switch {
+		case !foreign.get(change.name):
+			repo = append(repo, change)
+		case devel(change.name):
+			vcs = append(vcs, change)
+		default:
+			aur = append(aur, change)
+		}
+	}
+
+	return
+}
+
+func isDevelPkg(name string) bool {
+	if base, _ := vcsEntry(name); base != "" {
+		return true
+	}
+
+	return isDevelName(name)
+}
+
+// reportUpgrade prints what a system upgrade changed compared to the
+// versions installed before, and appends it to upgradesFile.
+func reportUpgrade(before map[string]string) error {
+	if err := reopenAlpmHandle(); err != nil {
+		return err
+	}
+
+	after, err := installedVersions()
+	if err != nil {
+		return err
+	}
+
+	changes := diffVersions(before, after)
+	if len(changes) == 0 {
+		return nil
+	}
+
+	// removed packages are not installed anymore and are only foreign if
+	// they are not in the sync databases either
+	_, _, _, remoteNames, err := filterPackages()
+	if err != nil {
+		return err
+	}
+	foreign := make(stringSet)
+	for _, name := range remoteNames {
+		foreign.set(name)
+	}
+	dbList, err := alpmHandle.SyncDbs()
+	if err != nil {
+		return err
+	}
+	for _, change := range changes {
+		if change.new != "" {
+			continue
+		}
+
+		found := false
+		_ = dbList.ForEach(func(db alpm.Db) error {
+			if _, err := db.PkgByName(change.name); err == nil {
+				found = true
+			}
+			return nil
+		})
+		if !found {
+			foreign.set(change.name)
+		}
+	}
+
+	repo, aur, vcs := upgradeSections(changes, foreign, isDevelPkg)
+	sections := []struct {
+		title   string
+		changes []versionChange
+	}{
+		{"Repo", repo},
+		{"AUR", aur},
+		{"Devel", vcs},
+	}
+
+	var log strings.Builder
+	fmt.Fprintf(&log, "[%s] upgrade\n", time.Now().Format("2006-01-02T15:04:05-0700"))
+
+	fmt.Println()
+	fmt.Println(boldCyanFg("::"), boldFg(fmt.Sprintf("%d packages changed", len(changes))))
+	for _, section := range sections {
+		if len(section.changes) == 0 {
+			continue
+		}
+
+		fmt.Println(boldFg(fmt.Sprintf("%s (%d):", section.title, len(section.changes))))
+		for _, change := range section.changes {
+			fmt.Println("    " + change.String())
+			fmt.Fprintf(&log, "%-6s %s\n", strings.ToLower(section.title), change)
+		}
+	}
+
+	file, err := os.OpenFile(upgradesFile, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = file.WriteString(log.String())
+	return err
+}
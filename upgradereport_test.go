@@ -0,0 +1,57 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiffVersions(t *testing.T) {
+	before := map[string]string{"foo": "1.0-1", "bar": "2.0-1", "gone": "0.1-1"}
+	after := map[string]string{"foo": "1.1-1", "bar": "2.0-1", "new": "3.0-1"}
+
+	expected := []versionChange{
+		{"foo", "1.0-1", "1.1-1"},
+		{"gone", "0.1-1", ""},
+		{"new", "", "3.0-1"},
+	}
+	if changes := diffVersions(before, after); !reflect.DeepEqual(changes, expected) {
+		t.Errorf("Expected %v, found %v", expected, changes)
+	}
+}
+
+func TestUpgradeSections(t *testing.T) {
+	changes := []versionChange{
+		{"foo", "1.0-1", "1.1-1"},
+		{"yay-git", "1-1", "2-1"},
+		{"yay", "9-1", "10-1"},
+	}
+	foreign := make(stringSet)
+	foreign.set("yay-git")
+	foreign.set("yay")
+	devel := func(name string) bool { return name == "yay-git" }
+
+	repo, aur, vcs := upgradeSections(changes, foreign, devel)
+	if len(repo) != 1 || repo[0].name != "foo" {
+		t.Errorf("Expected foo among the repo packages, found %v", repo)
+	}
+	if len(aur) != 1 || aur[0].name != "yay" {
+		t.Errorf("Expected yay among the AUR packages, found %v", aur)
+	}
+	if len(vcs) != 1 || vcs[0].name != "yay-git" {
+		t.Errorf("Expected yay-git among the devel packages, found %v", vcs)
+	}
+}
+
+func TestVersionChangeString(t *testing.T) {
+	tests := map[versionChange]string{
+		{"foo", "1.0-1", "1.1-1"}: "foo 1.0-1 -> 1.1-1",
+		{"foo", "", "1.1-1"}:      "foo 1.1-1 (installed)",
+		{"foo", "1.0-1", ""}:      "foo 1.0-1 (removed)",
+	}
+
+	for change, expected := range tests {
+		if str := change.String(); str != expected {
+			t.Errorf("Expected %q, found %q", expected, str)
+		}
+	}
+}
@@ -1,171 +1,407 @@
 package main
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
-	"net/http"
 	"os"
+	"sort"
 	"strings"
+	"time"
+
+	gopkg "github.com/mikkeloscar/gopkgbuild"
 )
 
-// branch contains the information of a repository branch
-type branch struct {
-	Name   string `json:"name"`
-	Commit struct {
-		SHA string `json:"sha"`
-	} `json:"commit"`
+// vcsStoreVersion is the format version of the vcs file.
+const vcsStoreVersion = 1
+
+// vcsStore records the upstream commits development packages were built from.
+type vcsStore struct {
+	Version  int                    `json:"version"`
+	Packages map[string]*vcsPackage `json:"packages"`
+}
+
+// vcsPackage holds the tracked sources of a pkgbase.
+type vcsPackage struct {
+	Pkgnames []string    `json:"pkgnames"`
+	Sources  []vcsSource `json:"sources"`
+	Pinned   string      `json:"pinned,omitempty"`
 }
 
-type branches []branch
+// vcsSource is the last seen commit of a git source.
+type vcsSource struct {
+	URL      string `json:"url"`
+	Protocol string `json:"protocol"`
+	Branch   string `json:"branch"`
+	SHA      string `json:"sha"`
+
+	// Remote and Checked cache the last upstream answer for the devel
+	// interval of the package.
+	Remote  string `json:"remote,omitempty"`
+	Checked int64  `json:"checked,omitempty"`
+}
 
-// Info contains the last commit sha of a repo
-type Info struct {
+// legacyInfo is an entry of the vcs file before it was versioned.
+type legacyInfo struct {
 	Package string `json:"pkgname"`
 	URL     string `json:"url"`
 	SHA     string `json:"sha"`
+	Pinned  string `json:"pinned,omitempty"`
 }
 
-type infos []Info
+// gitSource is a git entry of a PKGBUILD source array.
+type gitSource struct {
+	name     string
+	url      string
+	protocol string
+	branch   string
+}
 
-// Repo contains information about the repository
-type repo struct {
-	Name          string `json:"name"`
-	FullName      string `json:"full_name"`
-	DefaultBranch string `json:"default_branch"`
+func makeVCSStore() vcsStore {
+	return vcsStore{vcsStoreVersion, make(map[string]*vcsPackage)}
 }
 
-// createDevelDB forces yay to create a DB of the existing development packages
+// develSuffixes are the package name suffixes of development packages.
+var develSuffixes = []string{"-git", "-svn", "-hg", "-bzr", "-darcs", "-fossil"}
+
+func isDevelName(name string) bool {
+	for _, suffix := range develSuffixes {
+		if strings.HasSuffix(name, suffix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// createDevelDB seeds the VCS store with the installed development packages
+// that are not tracked yet, assuming they were built from the current
+// upstream commit. Nothing is built or installed.
 func createDevelDB() error {
 	_, _, _, remoteNames, err := filterPackages()
 	if err != nil {
 		return err
 	}
 
+	var names []string
+	for _, name := range remoteNames {
+		if base, _ := vcsEntry(name); base == "" && isDevelName(name) {
+			names = append(names, name)
+		}
+	}
+
+	var q aurQuery
+	var j int
+	for i := len(names); i != 0; i = j {
+		j = i - config.RequestSplitN
+		if j < 0 {
+			j = 0
+		}
+		qtemp, err := aurInfo(names[j:i])
+		if err != nil {
+			return err
+		}
+		q = append(q, qtemp...)
+	}
+
 	config.NoConfirm = true
-	arguments := makeArguments()
-	arguments.addArg("gendb")
-	arguments.addTarget(remoteNames...)
-	err = install(arguments)
-	return err
+	seen := make(stringSet)
+	for _, pkg := range q {
+		if seen.get(pkg.PackageBase) {
+			continue
+		}
+		seen.set(pkg.PackageBase)
+
+		fmt.Println(boldGreenFg(arrow), boldFg("Resolving "+pkg.PackageBase))
+		err = aurGitDownload(pkg.PackageBase)
+		if err != nil {
+			fmt.Println(err)
+			continue
+		}
+
+		srcinfo, err := parseSrcinfo(config.BuildDir + pkg.PackageBase + "/.SRCINFO")
+		if err != nil {
+			fmt.Println(pkg.PackageBase+":", err)
+			continue
+		}
+
+		updateVCSInfo(pkg.PackageBase, srcinfo)
+	}
+
+	fmt.Println("GenDB finished. No packages were installed")
+	return nil
 }
 
-// parseSource returns owner and repo from source
-func parseSource(source string) (owner string, repo string) {
-	if !(strings.Contains(source, "git://") ||
-		strings.Contains(source, ".git") ||
-		strings.Contains(source, "git+https://")) {
+// parseGitSource parses a git entry of a source array. ok is false for
+// anything that is not a git source or is pinned to a commit or tag, as
+// those never change upstream.
+func parseGitSource(source string) (src gitSource, ok bool) {
+	if i := strings.Index(source, "::"); i != -1 {
+		src.name = source[:i]
+		source = source[i+2:]
+	}
+
+	if !strings.HasPrefix(source, "git+") && !strings.HasPrefix(source, "git://") {
 		return
 	}
-	split := strings.Split(source, "github.com/")
-	if len(split) > 1 {
-		secondSplit := strings.Split(split[1], "/")
-		if len(secondSplit) > 1 {
-			owner = secondSplit[0]
-			thirdSplit := strings.Split(secondSplit[1], ".git")
-			if len(thirdSplit) > 0 {
-				repo = thirdSplit[0]
-			}
+	source = strings.TrimPrefix(source, "git+")
+
+	src.branch = "HEAD"
+	if i := strings.Index(source, "#"); i != -1 {
+		fragment := source[i+1:]
+		source = source[:i]
+
+		switch {
+		case strings.HasPrefix(fragment, "branch="):
+			src.branch = fragment[len("branch="):]
+		case strings.HasPrefix(fragment, "commit="), strings.HasPrefix(fragment, "tag="):
+			return
 		}
 	}
-	return
-}
+	if i := strings.Index(source, "?"); i != -1 {
+		source = source[:i]
+	}
 
-func (info *Info) needsUpdate() bool {
-	var newRepo repo
-	var newBranches branches
-	if strings.HasSuffix(info.URL, "/branches") {
-		info.URL = info.URL[:len(info.URL)-9]
+	i := strings.Index(source, "://")
+	if i == -1 {
+		return
 	}
-	infoResp, infoErr := http.Get(info.URL)
-	if infoErr != nil {
-		fmt.Println(infoErr)
-		return false
+	src.protocol = source[:i]
+	src.url = source
+
+	if src.name == "" {
+		src.name = strings.TrimSuffix(source[strings.LastIndex(source, "/")+1:], ".git")
 	}
-	defer infoResp.Body.Close()
 
-	infoBody, _ := ioutil.ReadAll(infoResp.Body)
-	var err = json.Unmarshal(infoBody, &newRepo)
+	return src, src.name != ""
+}
+
+// remoteSHA asks the upstream of src for the commit its branch points to.
+func remoteSHA(src vcsSource) (string, error) {
+	ref := src.Branch
+	if ref != "HEAD" {
+		ref = "refs/heads/" + ref
+	}
+
+	cmd := gitCommand("", "ls-remote", src.URL, ref)
+	// never hang on a credentials prompt for a repository that went away
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	out, err := cmd.Output()
 	if err != nil {
-		fmt.Printf("Cannot update '%v'\nError: %v\nStatus code: %v\nBody: %v\n",
-			info.Package, err, infoResp.StatusCode, string(infoBody))
-		return false
+		return "", fmt.Errorf("%s: %s", src.URL, err)
 	}
 
-	defaultBranch := newRepo.DefaultBranch
-	branchesURL := info.URL + "/branches"
+	fields := strings.Fields(string(out))
+	if len(fields) == 0 {
+		return "", fmt.Errorf("%s: no such branch %s", src.URL, src.Branch)
+	}
 
-	branchResp, branchErr := http.Get(branchesURL)
-	if branchErr != nil {
-		fmt.Println(branchErr)
-		return false
+	return fields[0], nil
+}
+
+// develInterval returns how long the upstream answers for pkgbase are
+// reused. A per package override takes precedence over the global setting.
+func develInterval(pkgbase string) time.Duration {
+	if hours, ok := config.DevelIntervals[pkgbase]; ok {
+		return time.Duration(hours) * time.Hour
 	}
-	defer branchResp.Body.Close()
 
-	branchBody, _ := ioutil.ReadAll(branchResp.Body)
-	err = json.Unmarshal(branchBody, &newBranches)
+	return time.Duration(config.DevelInterval) * time.Hour
+}
+
+// cachedRemoteSHA is remoteSHA, reusing the last answer if it is younger
+// than interval.
+func cachedRemoteSHA(src *vcsSource, interval time.Duration) (string, error) {
+	now := time.Now()
+	if src.Remote != "" && now.Sub(time.Unix(src.Checked, 0)) < interval {
+		return src.Remote, nil
+	}
+
+	sha, err := remoteSHA(*src)
 	if err != nil {
-		fmt.Printf("Cannot update '%v'\nError: %v\nStatus code: %v\nBody: %v\n",
-			info.Package, err, branchResp.StatusCode, string(branchBody))
-		return false
+		return "", err
 	}
 
-	for _, e := range newBranches {
-		if e.Name == defaultBranch {
-			return e.Commit.SHA != info.SHA
+	src.Remote = sha
+	src.Checked = now.Unix()
+	updated = true
+	return sha, nil
+}
+
+// needsUpdate reports whether any tracked source moved upstream, reusing
+// upstream answers younger than interval.
+func (p *vcsPackage) needsUpdate(interval time.Duration) bool {
+	for i := range p.Sources {
+		src := &p.Sources[i]
+		sha, err := cachedRemoteSHA(src, interval)
+		if err != nil {
+			fmt.Println(err)
+			continue
+		}
+
+		if sha != src.SHA {
+			return true
 		}
 	}
+
 	return false
 }
 
-func inStore(pkgName string) *Info {
-	for i, e := range savedInfo {
-		if pkgName == e.Package {
-			return &savedInfo[i]
+// vcsEntry finds the tracked pkgbase providing pkgName.
+func vcsEntry(pkgName string) (string, *vcsPackage) {
+	for base, e := range savedInfo.Packages {
+		for _, name := range e.Pkgnames {
+			if name == pkgName {
+				return base, e
+			}
 		}
 	}
+
+	return "", nil
+}
+
+// updateVCSInfo records the current upstream commit of every git source
+// of pkgbase. Sources that can not be reached are reported and skipped.
+func updateVCSInfo(pkgbase string, srcinfo *gopkg.PKGBUILD) {
+	var sources []vcsSource
+
+	for _, source := range srcinfo.Source {
+		src, ok := parseGitSource(source)
+		if !ok {
+			continue
+		}
+
+		info := vcsSource{URL: src.url, Protocol: src.protocol, Branch: src.branch}
+		sha, err := remoteSHA(info)
+		if err != nil {
+			fmt.Println(err)
+			continue
+		}
+
+		info.SHA = sha
+		sources = append(sources, info)
+	}
+
+	if len(sources) == 0 {
+		return
+	}
+
+	entry := &vcsPackage{Pkgnames: srcinfo.Pkgnames, Sources: sources}
+	if old, ok := savedInfo.Packages[pkgbase]; ok {
+		entry.Pinned = old.Pinned
+	}
+
+	savedInfo.Packages[pkgbase] = entry
+	updated = true
+}
+
+// pinVCSPackages pins the given devel packages so --devel upgrades leave
+// them alone. Targets are package names, optionally followed by =commit;
+// without a commit the currently installed one is pinned.
+func pinVCSPackages(targets []string) error {
+	for _, target := range targets {
+		name, commit := target, ""
+		if i := strings.Index(target, "="); i != -1 {
+			name, commit = target[:i], target[i+1:]
+		}
+
+		_, info := vcsEntry(name)
+		if info == nil {
+			return fmt.Errorf("%s is not a tracked development package", name)
+		}
+
+		if commit == "" {
+			commit = info.Sources[0].SHA
+		}
+
+		info.Pinned = commit
+		fmt.Println(boldGreenFg(arrow), boldFg(name+" pinned to "+shortSHA(commit)))
+	}
+
+	updated = true
 	return nil
 }
 
-// branchInfo updates saved information
-func branchInfo(pkgName string, owner string, repoName string) (err error) {
+// unpinVCSPackages removes the pins of the given devel packages.
+func unpinVCSPackages(targets []string) error {
+	for _, name := range targets {
+		_, info := vcsEntry(name)
+		if info == nil || info.Pinned == "" {
+			return fmt.Errorf("%s is not pinned", name)
+		}
+
+		info.Pinned = ""
+		fmt.Println(boldGreenFg(arrow), boldFg(name+" unpinned"))
+	}
+
 	updated = true
-	var newRepo repo
-	var newBranches branches
-	url := "https://api.github.com/repos/" + owner + "/" + repoName
-	repoResp, err := http.Get(url)
-	if err != nil {
-		return
+	return nil
+}
+
+func shortSHA(sha string) string {
+	if len(sha) > 7 {
+		return sha[:7]
+	}
+	return sha
+}
+
+// loadVCSInfo reads the vcs file, migrating it from the unversioned
+// format if needed.
+func loadVCSInfo() error {
+	savedInfo = makeVCSStore()
+
+	content, err := ioutil.ReadFile(vcsFile)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
 	}
-	defer repoResp.Body.Close()
 
-	_ = json.NewDecoder(repoResp.Body).Decode(&newRepo)
-	defaultBranch := newRepo.DefaultBranch
-	branchesURL := url + "/branches"
+	content = bytes.TrimSpace(content)
+	if len(content) == 0 {
+		return nil
+	}
 
-	branchResp, err := http.Get(branchesURL)
+	if content[0] == '[' {
+		return migrateVCSInfo(content)
+	}
+
+	err = json.Unmarshal(content, &savedInfo)
 	if err != nil {
-		return
+		return fmt.Errorf("Error reading vcs file: %s", err)
+	}
+
+	if savedInfo.Packages == nil {
+		savedInfo.Packages = make(map[string]*vcsPackage)
 	}
-	defer branchResp.Body.Close()
 
-	_ = json.NewDecoder(branchResp.Body).Decode(&newBranches)
+	return nil
+}
 
-	packinfo := inStore(pkgName)
+// migrateVCSInfo converts the unversioned vcs file, which only tracked the
+// default branch of GitHub repositories through the GitHub API.
+func migrateVCSInfo(content []byte) error {
+	var legacy []legacyInfo
 
-	for _, e := range newBranches {
-		if e.Name == defaultBranch {
-			if packinfo != nil {
-				packinfo.Package = pkgName
-				packinfo.URL = url
-				packinfo.SHA = e.Commit.SHA
-			} else {
-				savedInfo = append(savedInfo, Info{Package: pkgName, URL: url, SHA: e.Commit.SHA})
-			}
+	err := json.Unmarshal(content, &legacy)
+	if err != nil {
+		return fmt.Errorf("Error migrating vcs file: %s", err)
+	}
+
+	for _, info := range legacy {
+		url := strings.Replace(info.URL, "https://api.github.com/repos/", "https://github.com/", 1)
+		url = strings.TrimSuffix(url, "/branches") + ".git"
+
+		savedInfo.Packages[info.Package] = &vcsPackage{
+			Pkgnames: []string{info.Package},
+			Sources:  []vcsSource{{URL: url, Protocol: "https", Branch: "HEAD", SHA: info.SHA}},
+			Pinned:   info.Pinned,
 		}
 	}
 
-	return
+	updated = true
+	return nil
 }
 
 func saveVCSInfo() error {
@@ -185,3 +421,116 @@ func saveVCSInfo() error {
 	err = in.Sync()
 	return err
 }
+
+// sortedVCSBases returns the tracked pkgbases in a stable order.
+func sortedVCSBases() []string {
+	bases := make([]string, 0, len(savedInfo.Packages))
+	for base := range savedInfo.Packages {
+		bases = append(bases, base)
+	}
+	sort.Strings(bases)
+
+	return bases
+}
+
+// printVCSStatus lists every tracked pkgbase with the state of its sources.
+func printVCSStatus() error {
+	for _, base := range sortedVCSBases() {
+		e := savedInfo.Packages[base]
+
+		fmt.Print(boldFg(base))
+		if e.Pinned != "" {
+			fmt.Print(yellowFg(" [pinned " + shortSHA(e.Pinned) + "]"))
+		}
+		fmt.Println(" (" + strings.Join(e.Pkgnames, " ") + ")")
+
+		for _, src := range e.Sources {
+			fmt.Printf("    %s %s %s ", src.URL, src.Branch, shortSHA(src.SHA))
+
+			sha, err := remoteSHA(src)
+			switch {
+			case err != nil:
+				fmt.Println(redFg("unreachable"))
+			case sha != src.SHA:
+				fmt.Println(yellowFg("outdated => " + shortSHA(sha)))
+			default:
+				fmt.Println(greenFg("up to date"))
+			}
+		}
+	}
+
+	return nil
+}
+
+// sameSources reports whether e tracks exactly the git sources of srcinfo.
+func sameSources(e *vcsPackage, srcinfo *gopkg.PKGBUILD) bool {
+	var urls []string
+	for _, source := range srcinfo.Source {
+		if src, ok := parseGitSource(source); ok {
+			urls = append(urls, src.url+"#"+src.branch)
+		}
+	}
+
+	if len(urls) != len(e.Sources) {
+		return false
+	}
+
+	for i, src := range e.Sources {
+		if urls[i] != src.URL+"#"+src.Branch {
+			return false
+		}
+	}
+
+	return true
+}
+
+// pruneVCSInfo drops packages that are no longer installed, tracks sources
+// again when the PKGBUILD in the build directory changed them and reports
+// upstreams that can not be reached.
+func pruneVCSInfo() error {
+	_, _, _, remoteNames, err := filterPackages()
+	if err != nil {
+		return err
+	}
+
+	installed := make(stringSet)
+	for _, name := range remoteNames {
+		installed.set(name)
+	}
+
+	for _, base := range sortedVCSBases() {
+		e := savedInfo.Packages[base]
+
+		names := e.Pkgnames[:0]
+		for _, name := range e.Pkgnames {
+			if installed.get(name) {
+				names = append(names, name)
+			}
+		}
+		e.Pkgnames = names
+
+		if len(e.Pkgnames) == 0 {
+			fmt.Println(boldGreenFg(arrow), "Removing", boldFg(base), "which is not installed")
+			delete(savedInfo.Packages, base)
+			continue
+		}
+
+		srcinfo, err := parseSrcinfo(config.BuildDir + base + "/.SRCINFO")
+		if err == nil && !sameSources(e, srcinfo) {
+			fmt.Println(boldGreenFg(arrow), "Sources of", boldFg(base), "changed, tracking them again")
+			pkgnames := e.Pkgnames
+			updateVCSInfo(base, srcinfo)
+			savedInfo.Packages[base].Pkgnames = pkgnames
+			e = savedInfo.Packages[base]
+		}
+
+		for _, src := range e.Sources {
+			if _, err := remoteSHA(src); err != nil {
+				fmt.Println(boldRedFgBlackBg(arrow+" Warning:"),
+					blackBg(base+" has an unreachable source "+err.Error()))
+			}
+		}
+	}
+
+	return saveVCSInfo()
+}
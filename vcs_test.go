@@ -2,31 +2,85 @@ package main
 
 import (
 	"testing"
+	"time"
 )
 
 func TestParsing(t *testing.T) {
 	type source struct {
 		sourceurl string
-		owner     string
-		repo      string
+		name      string
+		url       string
+		protocol  string
+		branch    string
+		ok        bool
 	}
 
-	neovim := source{sourceurl: "git+https://github.com/neovim/neovim.git"}
-	neovim.owner, neovim.repo = parseSource(neovim.sourceurl)
+	sources := []source{
+		{"git+https://github.com/neovim/neovim.git", "neovim", "https://github.com/neovim/neovim.git", "https", "HEAD", true},
+		{"git://github.com/jguer/yay.git#branch=master", "yay", "git://github.com/jguer/yay.git", "git", "master", true},
+		{"git://github.com/davidgiven/ack", "ack", "git://github.com/davidgiven/ack", "git", "HEAD", true},
+		{"foo::git+ssh://aur@aur.archlinux.org/foo.git", "foo", "ssh://aur@aur.archlinux.org/foo.git", "ssh", "HEAD", true},
+		{"git+https://github.com/davidgiven/ack#commit=abc123", "", "", "", "", false},
+		{"git+https://github.com/davidgiven/ack#tag=v1.0", "", "", "", "", false},
+		{"https://example.com/foo.tar.gz", "", "", "", "", false},
+	}
+
+	for _, s := range sources {
+		src, ok := parseGitSource(s.sourceurl)
+		if ok != s.ok {
+			t.Errorf("Expected %s to parse %v, found %v", s.sourceurl, s.ok, ok)
+			continue
+		}
+		if !ok {
+			continue
+		}
+
+		if src.name != s.name || src.url != s.url || src.protocol != s.protocol || src.branch != s.branch {
+			t.Errorf("Expected %s to give %s %s %s %s, found %+v",
+				s.sourceurl, s.name, s.url, s.protocol, s.branch, src)
+		}
+	}
+}
+
+func TestMigrateVCSInfo(t *testing.T) {
+	savedInfo = makeVCSStore()
+	legacy := `[{"pkgname": "yay-git", "url": "https://api.github.com/repos/jguer/yay", "sha": "abc123", "pinned": "abc000"}]`
 
-	if neovim.owner != "neovim" || neovim.repo != "neovim" {
-		t.Fatalf("Expected to find neovim/neovim, found %+v/%+v", neovim.owner, neovim.repo)
+	err := migrateVCSInfo([]byte(legacy))
+	if err != nil {
+		t.Fatal(err)
 	}
 
-	yay := source{sourceurl: "git://github.com/jguer/yay.git#branch=master"}
-	yay.owner, yay.repo = parseSource(yay.sourceurl)
-	if yay.owner != "jguer" || yay.repo != "yay" {
-		t.Fatalf("Expected to find jguer/yay, found %+v/%+v", yay.owner, yay.repo)
+	e, ok := savedInfo.Packages["yay-git"]
+	if !ok || len(e.Sources) != 1 {
+		t.Fatalf("Expected yay-git to be migrated, found %+v", savedInfo)
 	}
 
-	ack := source{sourceurl: "git://github.com/davidgiven/ack"}
-	ack.owner, ack.repo = parseSource(ack.sourceurl)
-	if ack.owner != "davidgiven" || ack.repo != "ack" {
-		t.Fatalf("Expected to find davidgiven/ack, found %+v/%+v", ack.owner, ack.repo)
+	src := e.Sources[0]
+	if src.URL != "https://github.com/jguer/yay.git" || src.SHA != "abc123" || src.Branch != "HEAD" {
+		t.Fatalf("Expected the GitHub repo of yay at abc123, found %+v", src)
+	}
+	if e.Pinned != "abc000" {
+		t.Errorf("Expected yay-git to stay pinned to abc000, found %q", e.Pinned)
+	}
+}
+
+func TestDevelInterval(t *testing.T) {
+	oldInterval, oldIntervals := config.DevelInterval, config.DevelIntervals
+	defer func() {
+		config.DevelInterval, config.DevelIntervals = oldInterval, oldIntervals
+	}()
+
+	config.DevelInterval = 6
+	config.DevelIntervals = map[string]int{"linux-git": 24, "yay-git": 0}
+
+	for pkgbase, expected := range map[string]time.Duration{
+		"linux-git": 24 * time.Hour,
+		"yay-git":   0,
+		"foo-git":   6 * time.Hour,
+	} {
+		if interval := develInterval(pkgbase); interval != expected {
+			t.Errorf("Expected %s to be checked every %s, found %s", pkgbase, expected, interval)
+		}
 	}
 }
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+)
+
+// savedVotes holds the pkgbases the AUR account was seen voting for.
+var savedVotes = make(stringSet)
+
+// votesFile holds yay vote info file path.
+var votesFile string
+
+// sessionFile holds the AURSID cookie of the AUR session. It is kept out
+// of the config file, as the session grants access to the account.
+var sessionFile string
+
+// aurAccountClient does not follow redirects, aurweb redirects to its
+// login page when the session is not valid.
+var aurAccountClient = &http.Client{
+	Timeout: aurTimeout,
+	CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
+
+// aurAccountRequest sends a request for path to the AUR as the user whose
+// session is configured, with form as its body if it is not nil.
+func aurAccountRequest(method string, path string, form url.Values) (*http.Response, error) {
+	if config.AURSession == "" {
+		return nil, fmt.Errorf("No AUR session, write the AURSID cookie of a logged in "+
+			"browser to %s", sessionFile)
+	}
+
+	var req *http.Request
+	var err error
+	if form != nil {
+		req, err = http.NewRequest(method, config.AURURL+path, strings.NewReader(form.Encode()))
+		if err == nil {
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		}
+	} else {
+		req, err = http.NewRequest(method, config.AURURL+path, nil)
+	}
+	if err != nil {
+		return nil, err
+	}
+	req.AddCookie(&http.Cookie{Name: "AURSID", Value: config.AURSession})
+
+	resp, err := aurAccountClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	location, _ := resp.Location()
+	if location != nil && strings.HasPrefix(location.Path, "/login") {
+		resp.Body.Close()
+		return nil, fmt.Errorf("The AUR session has expired, update %s", sessionFile)
+	}
+
+	return resp, nil
+}
+
+// votePkgs votes for the pkgbases of pkgs, or removes the votes if up is
+// false.
+func votePkgs(pkgs []string, up bool) error {
+	info, err := aurInfo(pkgs)
+	if err != nil {
+		return err
+	}
+
+	bases := make(stringSet)
+	found := make(stringSet)
+	for _, pkg := range info {
+		bases.set(pkg.PackageBase)
+		found.set(pkg.Name)
+	}
+
+	for _, pkg := range pkgs {
+		if !found.get(pkg) {
+			fmt.Println(boldRedFgBlackBg(arrow+" Warning:"),
+				blackBg(pkg+" is not in the AUR"))
+		}
+	}
+
+	action, button := "vote", "do_Vote"
+	if !up {
+		action, button = "unvote", "do_UnVote"
+	}
+
+	for _, base := range bases.toSlice() {
+		// the session id doubles as the form token of aurweb
+		form := url.Values{}
+		form.Set("token", config.AURSession)
+		form.Set(button, "1")
+
+		resp, err := aurAccountRequest("POST", "/pkgbase/"+url.PathEscape(base)+"/"+action, form)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode >= http.StatusBadRequest {
+			return fmt.Errorf("%s: %s", base, resp.Status)
+		}
+
+		if up {
+			savedVotes.set(base)
+			fmt.Println(boldGreenFg(arrow), "Voted for", base)
+		} else {
+			savedVotes.remove(base)
+			fmt.Println(boldGreenFg(arrow), "Removed vote for", base)
+		}
+	}
+
+	return saveVotes()
+}
+
+// votedFor asks the AUR whether the configured account voted for pkgbase
+// and records the answer.
+func votedFor(pkgbase string) (bool, error) {
+	resp, err := aurAccountRequest("GET", "/pkgbase/"+url.PathEscape(pkgbase)+"/", nil)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("%s: %s", pkgbase, resp.Status)
+	}
+
+	page, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return false, err
+	}
+
+	// the page offers to remove the vote once there is one
+	voted := strings.Contains(string(page), "/unvote")
+	if voted != savedVotes.get(pkgbase) {
+		if voted {
+			savedVotes.set(pkgbase)
+		} else {
+			savedVotes.remove(pkgbase)
+		}
+		_ = saveVotes()
+	}
+
+	return voted, nil
+}
+
+func loadVotes() {
+	in, err := os.Open(votesFile)
+	if err != nil {
+		return
+	}
+	defer in.Close()
+
+	var bases []string
+	if json.NewDecoder(in).Decode(&bases) != nil {
+		return
+	}
+
+	for _, base := range bases {
+		savedVotes.set(base)
+	}
+}
+
+// loadAURSession reads the AUR session from sessionFile.
+func loadAURSession() {
+	content, err := ioutil.ReadFile(sessionFile)
+	if err != nil {
+		return
+	}
+
+	config.AURSession = strings.TrimSpace(string(content))
+}
+
+func saveVotes() error {
+	bases := savedVotes.toSlice()
+	sort.Strings(bases)
+
+	marshalledinfo, err := json.MarshalIndent(bases, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(votesFile, marshalledinfo, 0644)
+}